@@ -0,0 +1,88 @@
+package proxysql
+
+// this file is for which of ProxySQL's tables can be written
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTableReadOnly is matched by every *TableAccessError
+var ErrTableReadOnly = errors.New("Bad table, it is read only")
+
+// TableAccessError is returned when a statement would write to a table that
+// can only be read. It is returned before any SQL is sent
+type TableAccessError struct {
+	// Table is the table, as it was named
+	Table string
+	// Op is the statement that was refused, one of insert, update or delete
+	Op string
+	// Reason is why the table is read only, and how to change it instead
+	Reason string
+}
+
+func (e *TableAccessError) Error() string {
+	target := e.Table
+	switch e.Op {
+	case "insert":
+		target = "into " + e.Table
+	case "delete":
+		target = "from " + e.Table
+	}
+	return fmt.Sprintf("can not %s %s, %s", e.Op, target, e.Reason)
+}
+
+// Is reports whether target is ErrTableReadOnly
+func (e *TableAccessError) Is(target error) bool {
+	return target == ErrTableReadOnly
+}
+
+// tables are in one of these schemas. main is the memory that the admin
+// interface changes, disk is what SAVE ... TO DISK writes, and the rest are
+// written by ProxySQL itself
+var readOnlySchemas = map[string]string{
+	"disk":          "save the table in memory to disk instead",
+	"stats":         "stats tables are written by ProxySQL",
+	"stats_history": "stats tables are written by ProxySQL",
+	"monitor":       "monitor tables are written by ProxySQL's monitor",
+}
+
+// the tables of the monitor schema, which ProxySQL also finds by their names
+// alone. monitor.mysql_servers is left out, as mysql_servers is in main
+var monitorTables = map[string]bool{
+	"mysql_server_connect_log":             true,
+	"mysql_server_ping_log":                true,
+	"mysql_server_read_only_log":           true,
+	"mysql_server_replication_lag_log":     true,
+	"mysql_server_group_replication_log":   true,
+	"mysql_server_galera_log":              true,
+	"mysql_server_aws_aurora_log":          true,
+	"mysql_server_aws_aurora_check_status": true,
+	"mysql_server_aws_aurora_failovers":    true,
+}
+
+// CheckWritable returns a *TableAccessError if the statement op, one of
+// insert, update or delete, can not be run on the table. Only tables in
+// memory can be changed: runtime_, stats_, monitor and disk tables are read
+// only. Monitor tables are known by their names, with or without the schema
+func CheckWritable(table, op string) error {
+	schema, name := "main", table
+	if i := strings.Index(table, "."); i >= 0 {
+		schema, name = strings.ToLower(table[:i]), table[i+1:]
+	} else if monitorTables[strings.ToLower(table)] {
+		schema = "monitor"
+	}
+	reason, readOnly := readOnlySchemas[schema]
+	lower := strings.ToLower(name)
+	switch {
+	case readOnly:
+	case strings.HasPrefix(lower, "runtime_"):
+		reason = "load the table in memory to runtime instead"
+	case strings.HasPrefix(lower, "stats_"):
+		reason = "stats tables are written by ProxySQL"
+	default:
+		return nil
+	}
+	return &TableAccessError{Table: table, Op: op, Reason: reason}
+}
@@ -0,0 +1,82 @@
+package proxysql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckWritable(t *testing.T) {
+	writable := []string{"mysql_servers", "main.mysql_servers", "mysql_users", "global_variables", "mysql_query_rules"}
+	for _, table := range writable {
+		if err := CheckWritable(table, "insert"); err != nil {
+			t.Errorf("%s was not writable: %v", table, err)
+		}
+	}
+	readOnly := []string{
+		"runtime_mysql_servers", "main.runtime_mysql_users", "RUNTIME_GLOBAL_VARIABLES", "disk.mysql_servers",
+		"stats_mysql_connection_pool", "stats.stats_mysql_query_digest", "stats_history.mysql_connections",
+		"monitor.mysql_server_ping_log", "mysql_server_ping_log", "MYSQL_SERVER_CONNECT_LOG",
+	}
+	for _, table := range readOnly {
+		if err := CheckWritable(table, "delete"); !errors.Is(err, ErrTableReadOnly) {
+			t.Errorf("%s was writable: %v", table, err)
+		}
+	}
+	err := CheckWritable("runtime_mysql_servers", "insert")
+	if err.Error() != "can not insert into runtime_mysql_servers, load the table in memory to runtime instead" {
+		t.Errorf("unexpected message: %v", err)
+	}
+	err = CheckWritable("mysql_server_read_only_log", "delete")
+	if err.Error() != "can not delete from mysql_server_read_only_log, monitor tables are written by ProxySQL's monitor" {
+		t.Errorf("unexpected message: %v", err)
+	}
+	err = CheckWritable("disk.mysql_users", "update")
+	if err.Error() != "can not update disk.mysql_users, save the table in memory to disk instead" {
+		t.Errorf("unexpected message: %v", err)
+	}
+}
+
+func TestWritesToReadOnlyTablesSendNothing(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	before := len(server.Queries())
+	if err := conn.AddHost(Table("runtime_mysql_servers"), Hostname("db-1")); !errors.Is(err, ErrTableReadOnly) {
+		t.Errorf("AddHost to runtime was not rejected: %v", err)
+	}
+	if err := conn.RemoveHostsLike(Table("disk.mysql_servers"), HostgroupID(1)); !errors.Is(err, ErrTableReadOnly) {
+		t.Errorf("RemoveHostsLike from disk was not rejected: %v", err)
+	}
+	if err := conn.NewChangeSet().AddHost(Table("runtime_mysql_servers"), Hostname("db-1")).Apply(); !errors.Is(err, ErrTableReadOnly) {
+		t.Errorf("ChangeSet.AddHost to runtime was not rejected: %v", err)
+	}
+	if err := conn.NewChangeSet().RemoveHostsLike(Table("runtime_mysql_servers")).Apply(); !errors.Is(err, ErrTableReadOnly) {
+		t.Errorf("ChangeSet.RemoveHostsLike from runtime was not rejected: %v", err)
+	}
+	pool, _ := NewTypedTable[testPoolStats](conn, "stats_mysql_connection_pool")
+	if err := pool.Insert(&testPoolStats{}); !errors.Is(err, ErrTableReadOnly) {
+		t.Errorf("insert into stats was not rejected: %v", err)
+	}
+	if _, err := pool.Delete(); !errors.Is(err, ErrTableReadOnly) {
+		t.Errorf("delete from stats was not rejected: %v", err)
+	}
+	if _, err := pool.Update(&testPoolStats{}); !errors.Is(err, ErrTableReadOnly) {
+		t.Errorf("update of stats was not rejected: %v", err)
+	}
+	if queries := server.Queries(); len(queries) != before {
+		t.Fatalf("statements were sent: %v", queries[before:])
+	}
+}
+
+func TestReadDiskServers(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.AddHost(Hostname("db-1"))
+	if disk, err := conn.All(Table("disk.mysql_servers")); err != nil || len(disk) != 0 {
+		t.Fatalf("host was on disk before saving: %v, %v", disk, err)
+	}
+	conn.PersistChanges()
+	disk, err := conn.HostsLike(Table("disk.mysql_servers"), Hostname("db-1"))
+	if err != nil || len(disk) != 1 {
+		t.Fatalf("host was not on disk after saving: %v, %v", disk, err)
+	}
+}
@@ -9,7 +9,8 @@ func NewProxySQL(dsn string) (*ProxySQL, error) {
 		return nil, err
 	}
 	return &ProxySQL{
-		dsn:  dsn,
-		conn: conn,
+		dsn:       dsn,
+		conn:      conn,
+		batchSize: DefaultInsertBatchSize,
 	}, nil
 }
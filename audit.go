@@ -0,0 +1,306 @@
+package proxysql
+
+// this file is for recording every change that a client makes in an append
+// only journal, and replaying the journal on another ProxySQL
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReplayNoConn is returned by Replay for a client without a connection to
+// run statements on, like the in-memory one from proxysqlfake
+var ErrReplayNoConn = errors.New("Bad client, must have a connection to replay statements on")
+
+// AuditEntry is a call of a method that changes ProxySQL, as it is written to
+// an AuditJournal
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is who made the change, from WithActor or SetAuditJournal
+	Actor string `json:"actor,omitempty"`
+	// Op is the method, like AddHost or ChangeSet.Apply
+	Op string `json:"op"`
+	// Params are the arguments of the method that describe the change, like
+	// the host for AddHost. Passwords are never recorded
+	Params map[string]interface{} `json:"params,omitempty"`
+	// SQL is each statement that the method ran successfully, in order, with
+	// passwords, credentials and secrets redacted. Statements that failed
+	// are not included
+	SQL []string `json:"sql"`
+	// Outcome is ok, or the ErrorClass of the error the method returned
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// DryRun is true if the client was in dry run mode, and SQL was only
+	// recorded
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// JournalError is returned when an audit journal can not be read or
+// replayed. Line is the line of the entry, starting from 1
+type JournalError struct {
+	Line int
+	Err  error
+}
+
+func (e *JournalError) Error() string {
+	return fmt.Sprintf("audit journal line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the error from reading or replaying the entry
+func (e *JournalError) Unwrap() error {
+	return e.Err
+}
+
+// AuditError is returned by a method when its change was made, but could not
+// be written to the client's AuditJournal
+type AuditError struct {
+	Entry AuditEntry
+	Err   error
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("%s was not written to the audit journal: %v", e.Entry.Op, e.Err)
+}
+
+// Unwrap returns the error from writing the entry
+func (e *AuditError) Unwrap() error {
+	return e.Err
+}
+
+// AuditJournal writes AuditEntries as JSON, one per line. It is safe to use
+// from several clients at once
+type AuditJournal struct {
+	mut sync.Mutex
+	w   io.Writer
+}
+
+// NewAuditJournal returns a journal that writes to w. If w has a Sync method,
+// like *os.File, it is called after each entry
+func NewAuditJournal(w io.Writer) *AuditJournal {
+	return &AuditJournal{w: w}
+}
+
+// OpenAuditJournal opens the file at path for appending, creating it if it
+// does not exist, and returns a journal that writes to it. Each entry is
+// synced to disk before the method that made it returns.
+// This propagates errors from os.OpenFile
+func OpenAuditJournal(path string) (*AuditJournal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditJournal(file), nil
+}
+
+// Write appends an entry to the journal
+func (j *AuditJournal) Write(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	// the line is written in one call, so that entries are not interleaved
+	// with those of other processes appending to the same file
+	if _, err := j.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if syncer, ok := j.w.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// Close closes the writer of the journal, if it has a Close method
+func (j *AuditJournal) Close() error {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	if closer, ok := j.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SetAuditJournal writes an AuditEntry to journal for each call of a method
+// that changes ProxySQL, including calls that fail. Changes are attributed
+// to actor, unless the context they are made with has another from
+// WithActor. Passing a nil journal stops auditing.
+func (p *ProxySQL) SetAuditJournal(journal *AuditJournal, actor string) {
+	p.settingsMut.Lock()
+	defer p.settingsMut.Unlock()
+	p.audit, p.auditActor = journal, actor
+}
+
+func (p *ProxySQL) auditor() (*AuditJournal, string) {
+	p.settingsMut.RLock()
+	defer p.settingsMut.RUnlock()
+	return p.audit, p.auditActor
+}
+
+type actorKey struct{}
+
+// WithActor returns a context that attributes the changes made with it, by
+// methods like AddHostContext, to actor in the audit journal
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// the operations that change ProxySQL, which are audited
+var auditedOps = map[string]bool{
+	"PersistChanges":        true,
+	"AddHost":               true,
+	"AddHosts":              true,
+	"Clear":                 true,
+	"RemoveHost":            true,
+	"RemoveHostsLike":       true,
+	"ChangeSet.Apply":       true,
+	"TypedTable.Insert":     true,
+	"TypedTable.Delete":     true,
+	"TypedTable.Update":     true,
+	"SetMonitorCredentials": true,
+	"SetUserCredentials":    true,
+	"Register":              true,
+	"Replay":                true,
+}
+
+// param records an argument of the operation for its audit entry
+func (o *operation) param(key string, value interface{}) {
+	if o.params == nil {
+		o.params = make(map[string]interface{})
+	}
+	o.params[key] = value
+}
+
+// ran records a statement that the operation ran successfully
+func (o *operation) ran(statement string) {
+	o.statements = append(o.statements, redact(statement))
+}
+
+// audit writes the entry of the operation to the client's journal, if it
+// changes ProxySQL, and returns the error from writing it
+func (o *operation) audit(err error) error {
+	journal, actor := o.p.auditor()
+	if journal == nil || !auditedOps[o.name] {
+		return nil
+	}
+	entry := AuditEntry{
+		Time:    o.start,
+		Actor:   actor,
+		Op:      o.name,
+		Params:  o.params,
+		SQL:     o.statements,
+		Outcome: "ok",
+		DryRun:  o.dryRun,
+	}
+	if actor, ok := o.ctx.Value(actorKey{}).(string); ok {
+		entry.Actor = actor
+	}
+	if entry.SQL == nil {
+		entry.SQL = []string{}
+	}
+	if err != nil {
+		entry.Outcome, entry.Error = ErrorClass(err), err.Error()
+	}
+	if werr := journal.Write(entry); werr != nil {
+		return &AuditError{Entry: entry, Err: werr}
+	}
+	return nil
+}
+
+// filterOf returns the where, order by and limit of a query, like
+// where hostname = 'a' limit 1, with secrets redacted
+func filterOf(q *tableQuery) string {
+	return redact(strings.TrimSpace(q.whereClause() + q.orderAndLimit()))
+}
+
+// ReadAuditJournal reads the entries of a journal, in order.
+// This will return a *JournalError for a line that is not an entry
+func ReadAuditJournal(journal io.Reader) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(journal)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, &JournalError{Line: line, Err: err}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Replay runs the statements of each entry of a journal on client, in order,
+// to rebuild the state that the journal recorded on another ProxySQL, such as
+// a new instance. Every statement that ran successfully is replayed, even
+// those of methods that failed afterwards, as they took effect. Entries made
+// in dry run mode are skipped, and so are statements with redacted secrets,
+// like those of SetUserCredentials, so set credentials on client again. When
+// client is a *ProxySQL, the statements that were skipped are in the audit
+// entry of the replay, and statements are retried by its policy. Other
+// clients run the statements on their Conn. The journal is read completely
+// before anything is run.
+// This will return a *JournalError for the entry that could not be read or
+// replayed, which wraps an *OpError when a statement failed, and
+// ErrReplayNoConn if client has no connection
+func Replay(journal io.Reader, client Client) error {
+	entries, err := ReadAuditJournal(journal)
+	if err != nil {
+		return err
+	}
+	if p, ok := client.(*ProxySQL); ok {
+		return p.replay(context.Background(), entries)
+	}
+	conn := client.Conn()
+	if conn == nil {
+		return ErrReplayNoConn
+	}
+	_, err = replayEntries(entries, func(statement string) error {
+		_, err := conn.Exec(statement)
+		return err
+	})
+	return err
+}
+
+func (p *ProxySQL) replay(ctx context.Context, entries []AuditEntry) (err error) {
+	op := p.begin(ctx, "Replay")
+	defer op.end(&err)
+	defer op.lockThroughout()()
+	op.param("entries", len(entries))
+	skipped, err := replayEntries(entries, func(statement string) error {
+		_, err := execRetrying(op.ctx, p, statement, nil)
+		return err
+	})
+	if len(skipped) > 0 {
+		op.param("skipped", skipped)
+	}
+	return err
+}
+
+// replayEntries runs the statements of the entries with run, and returns the
+// statements that were skipped as they have redacted secrets
+func replayEntries(entries []AuditEntry, run func(statement string) error) (skipped []string, err error) {
+	for line, entry := range entries {
+		if entry.DryRun {
+			continue
+		}
+		for _, statement := range entry.SQL {
+			if strings.Contains(statement, redacted) {
+				skipped = append(skipped, statement)
+				continue
+			}
+			_, table := statementTarget(statement)
+			if err := run(statement); err != nil {
+				return skipped, &JournalError{Line: line + 1, Err: opError(table, statement, err)}
+			}
+		}
+	}
+	return skipped, nil
+}
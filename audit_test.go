@@ -0,0 +1,211 @@
+package proxysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditJournal(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	journal, err := OpenAuditJournal(path)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	conn.SetAuditJournal(journal, "sidecar")
+	ctx := WithActor(context.Background(), "orders")
+	conn.AddHostContext(ctx, Hostname("db-1"), HostgroupID(1))
+	conn.AddHost(Hostname("db-2"), Port(-1))
+	conn.HostsLike(HostgroupID(1))
+	conn.RemoveHostsLike(Hostname("db-1"), Limit(1))
+	users, _ := NewTypedTable[testUser](conn, "mysql_users")
+	users.Insert(&testUser{Username: "app"})
+	conn.SetUserCredentials(StaticCredentials("app", "secretpw"))
+	journal.Close()
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if strings.Contains(string(file), "secretpw") {
+		t.Fatalf("password was written to the journal: %s", file)
+	}
+	entries, err := ReadAuditJournal(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ops := make([]string, len(entries))
+	for i, entry := range entries {
+		ops[i] = entry.Op
+	}
+	if !reflect.DeepEqual(ops, []string{"AddHost", "AddHost", "RemoveHostsLike", "TypedTable.Insert", "SetUserCredentials"}) {
+		t.Fatalf("unexpected operations: %v", ops)
+	}
+	added := entries[0]
+	if added.Actor != "orders" || added.Outcome != "ok" || len(added.SQL) != 1 || !strings.HasPrefix(added.SQL[0], "insert into mysql_servers") || added.Time.IsZero() {
+		t.Fatalf("unexpected entry: %+v", added)
+	}
+	if host, _ := added.Params["host"].(map[string]interface{}); host["hostname"] != "db-1" || host["hostgroup_id"] != float64(1) {
+		t.Fatalf("host was not recorded: %v", added.Params)
+	}
+	failed := entries[1]
+	if failed.Actor != "sidecar" || failed.Outcome != ErrorClassValidation || failed.Error == "" || len(failed.SQL) != 0 {
+		t.Fatalf("unexpected entry for failed call: %+v", failed)
+	}
+	// the host is selected, then deleted by a where clause that matches it
+	if removed := entries[2]; removed.Params["where"] != "where hostname = 'db-1' limit 1" || len(removed.SQL) != 1 {
+		t.Fatalf("unexpected entry: %+v", removed)
+	}
+	if credentials := entries[4]; credentials.Params["user"] != "app" || len(credentials.SQL) != 3 || !strings.Contains(credentials.SQL[0], redacted) {
+		t.Fatalf("unexpected entry: %+v", credentials)
+	}
+}
+
+func TestAuditJournalRedactsParams(t *testing.T) {
+	conn, users, teardown := usersSetup(t)
+	defer teardown()
+	var out bytes.Buffer
+	conn.SetAuditJournal(NewAuditJournal(&out), "sidecar")
+	users.Insert(&testUser{Username: "app", Password: "s3cret-old"})
+	if _, err := users.Update(&testUser{Username: "app", Password: "s3cret-new"}, Where(Eq("password", "s3cret-old"))); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := users.Delete(Where(Or(Eq("password", "s3cret-new"), In("password", "s3cret-old")))); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.Contains(line, "s3cret") {
+			t.Errorf("password was written to the journal: %s", line)
+		}
+	}
+	entries, err := ReadAuditJournal(&out)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("unexpected entries: %+v, %v", entries, err)
+	}
+	if updated := entries[1]; !reflect.DeepEqual(updated.Params["columns"], []interface{}{"username", "password", "active", "default_hostgroup", "max_connections"}) {
+		t.Fatalf("columns of the row were not recorded: %v", updated.Params)
+	}
+	if deleted := entries[2]; !strings.Contains(deleted.Params["where"].(string), "password = "+redacted) {
+		t.Fatalf("where was not recorded: %v", deleted.Params)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	source, sourceServer := serverSetup(t)
+	defer serverTeardown(source, sourceServer)
+	var journal bytes.Buffer
+	source.SetAuditJournal(NewAuditJournal(&journal), "sidecar")
+	source.AddHosts(DefaultHost().SetHostname("db-1"), DefaultHost().SetHostname("db-2").SetHostgroupID(1))
+	source.AddHost(Hostname("db-3"), Comment("temporary"))
+	source.AddHost(Hostname("db-4"), Comment("rotate the secret monthly"))
+	source.RemoveHost(DefaultHost().SetHostname("db-3").SetComment("temporary"))
+	source.NewChangeSet().UpdateHost(DefaultHost().SetHostname("db-1"), DefaultHost().SetHostname("db-1").SetWeight(5)).Apply()
+	source.SetDryRun(true)
+	source.AddHost(Hostname("planned"))
+	source.SetDryRun(false)
+	source.PersistChanges()
+	source.SetUserCredentials(StaticCredentials("missing", "pw"))
+
+	target, targetServer := serverSetup(t)
+	defer serverTeardown(target, targetServer)
+	var targetJournal bytes.Buffer
+	target.SetAuditJournal(NewAuditJournal(&targetJournal), "restore")
+	if err := Replay(bytes.NewReader(journal.Bytes()), target); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	replays, _ := ReadAuditJournal(&targetJournal)
+	if skipped, _ := replays[0].Params["skipped"].([]interface{}); len(replays) != 1 || len(skipped) != 1 || !strings.HasPrefix(skipped[0].(string), "update mysql_users set password") {
+		t.Fatalf("skipped statements were not reported: %+v", replays)
+	}
+	for _, table := range []string{"mysql_servers", "runtime_mysql_servers"} {
+		expected, _ := source.All(Table(table))
+		replayed, err := target.All(Table(table))
+		if err != nil || !reflect.DeepEqual(expected, replayed) {
+			t.Fatalf("%s was not rebuilt: %v, expected %v, %v", table, replayed, expected, err)
+		}
+	}
+	if hosts, _ := target.HostsLike(Hostname("planned")); len(hosts) != 0 {
+		t.Fatal("dry run entry was replayed")
+	}
+	// replaying again fails on the first insert of a host that exists
+	err := Replay(bytes.NewReader(journal.Bytes()), target)
+	var journalErr *JournalError
+	var opErr *OpError
+	if !errors.As(err, &journalErr) || journalErr.Line != 1 || !errors.As(err, &opErr) {
+		t.Fatalf("failed statement was not reported: %v", err)
+	}
+}
+
+func TestReplayOnClient(t *testing.T) {
+	journal := `{"time":"2020-01-01T00:00:00Z","op":"AddHost","sql":["insert into mysql_servers (hostname) values ('db-1')"],"outcome":"ok"}`
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	owned, _ := NewOwnedClient(conn, "orders")
+	if err := Replay(strings.NewReader(journal), owned); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 1 || hosts[0].Hostname() != "db-1" {
+		t.Fatalf("journal was not replayed on the client's connection: %v", hosts)
+	}
+	if err := Replay(strings.NewReader(journal), noConnClient{conn}); err != ErrReplayNoConn {
+		t.Fatalf("expected ErrReplayNoConn, got %v", err)
+	}
+}
+
+// noConnClient is a Client without a connection, like proxysqlfake's
+type noConnClient struct {
+	*ProxySQL
+}
+
+func (noConnClient) Conn() *sql.DB {
+	return nil
+}
+
+func TestReadAuditJournalReportsLine(t *testing.T) {
+	journal := `{"time":"2020-01-01T00:00:00Z","op":"Clear","sql":["delete from mysql_servers"],"outcome":"ok"}` + "\nnot json\n"
+	_, err := ReadAuditJournal(strings.NewReader(journal))
+	var journalErr *JournalError
+	if !errors.As(err, &journalErr) || journalErr.Line != 2 {
+		t.Fatalf("bad line was not reported: %v", err)
+	}
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.AddHost(Hostname("db-1"))
+	if err := Replay(strings.NewReader(journal), conn); !errors.As(err, &journalErr) {
+		t.Fatalf("bad journal was replayed: %v", err)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 1 {
+		t.Fatal("entries before the bad line were replayed")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAuditErrorReportsUnwrittenChange(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.SetAuditJournal(NewAuditJournal(failingWriter{}), "sidecar")
+	err := conn.AddHost(Hostname("db-1"))
+	var auditErr *AuditError
+	if !errors.As(err, &auditErr) || auditErr.Entry.Op != "AddHost" {
+		t.Fatalf("unwritten entry was not reported: %v", err)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 1 {
+		t.Fatal("the change was not made")
+	}
+	conn.SetAuditJournal(nil, "")
+	if err := conn.AddHost(Hostname("db-2")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
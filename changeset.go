@@ -0,0 +1,307 @@
+package proxysql
+
+// this file is for applying several changes to ProxySQL as one unit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ChangeSet is a list of changes that are applied to ProxySQL together by
+// Apply. Either every change is applied and persisted, or none of them are.
+// Build one with ProxySQL.NewChangeSet, and chain calls to add changes:
+//
+//	err := conn.NewChangeSet().
+//	  RemoveHost(old).
+//	  AddHost(Hostname("new-host")).
+//	  Apply()
+type ChangeSet struct {
+	p       *ProxySQL
+	changes []change
+	err     error
+	// checks run under the lock before anything else, and stop Apply if
+	// they fail
+	checks []func(ctx context.Context, p *ProxySQL) error
+}
+
+type change struct {
+	table string
+	run   func(ctx context.Context, p *ProxySQL) error
+}
+
+// RollbackError is returned by ChangeSet.Apply when a change failed, and
+// the tables it touched could not be restored to their state before Apply.
+// Err is the error from the change, and RollbackErr the error from restoring
+type RollbackError struct {
+	Err         error
+	RollbackErr error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%v (rollback failed: %v)", e.Err, e.RollbackErr)
+}
+
+// Unwrap returns the error from the change
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// the statements that persist changes to each table that a change set
+// can touch, run in order after every change has been applied
+var persistQueries = map[string][]string{
+	"mysql_servers":    {"save mysql servers to disk", "load mysql servers to runtime"},
+	"mysql_users":      {"save mysql users to disk", "load mysql users to runtime"},
+	"global_variables": {"save mysql variables to disk", "load mysql variables to runtime"},
+}
+
+// NewChangeSet returns an empty ChangeSet that applies its changes to p
+func (p *ProxySQL) NewChangeSet() *ChangeSet {
+	return &ChangeSet{p: p}
+}
+
+// AddHost adds a change that inserts a host with the configuration provided,
+// like ProxySQL.AddHost. A validation error, or a *TableAccessError, is
+// returned by Apply
+func (c *ChangeSet) AddHost(opts ...HostOpts) *ChangeSet {
+	hostq, err := buildAndParseHostQueryWithHostname(opts...)
+	if err != nil {
+		return c.fail(err)
+	}
+	if err := CheckWritable(hostq.table, "insert"); err != nil {
+		return c.fail(err)
+	}
+	return c.addInsert(hostq.table, buildInsertQuery(hostq), buildInsertedWhere(hostq))
+}
+
+// AddHosts adds a change that inserts each of the hosts, like
+// ProxySQL.AddHosts. A validation error is returned by Apply
+func (c *ChangeSet) AddHosts(hosts ...*Host) *ChangeSet {
+	for _, host := range hosts {
+		if err := host.Valid(); err != nil {
+			return c.fail(err)
+		}
+		c.addInsert("mysql_servers", servers(nil, "mysql_servers").insertQuery([]*serverRow{rowFromHost(host)}), " where "+host.where())
+	}
+	return c
+}
+
+// RemoveHost adds a change that removes the host that matches the provided
+// host's configuration exactly, like ProxySQL.RemoveHost
+func (c *ChangeSet) RemoveHost(host *Host) *ChangeSet {
+	return c.addQuery("mysql_servers", fmt.Sprintf("delete from mysql_servers where %s", host.where()))
+}
+
+// RemoveHostsLike adds a change that removes all hosts that match the
+// specified configuration when the change is applied, like
+// ProxySQL.RemoveHostsLike. A validation error, or a *TableAccessError, is
+// returned by Apply
+func (c *ChangeSet) RemoveHostsLike(opts ...HostOpts) *ChangeSet {
+	hostq, err := buildAndParseHostQuery(opts...)
+	if err != nil {
+		return c.fail(err)
+	}
+	if err := CheckWritable(hostq.table, "delete"); err != nil {
+		return c.fail(err)
+	}
+	return c.add(hostq.table, func(ctx context.Context, p *ProxySQL) error {
+		_, err := removeHostsLike(ctx, p, hostq)
+		return err
+	})
+}
+
+// UpdateHost adds a change that replaces the configuration of the host that
+// matches old exactly with the configuration of updated.
+// A validation error in updated is returned by Apply
+func (c *ChangeSet) UpdateHost(old, updated *Host) *ChangeSet {
+	if err := updated.Valid(); err != nil {
+		return c.fail(err)
+	}
+	return c.addQuery("mysql_servers", fmt.Sprintf("update mysql_servers set %s where %s", updated.assignments(), old.where()))
+}
+
+// Len returns the number of changes in the change set
+func (c *ChangeSet) Len() int {
+	return len(c.changes)
+}
+
+// Apply runs every change in the order they were added, and then persists
+// them as PersistChanges does. The tables that the changes touch are read
+// before anything is run, and if any change or the persisting fails, the
+// tables are restored to what was read. Changes to the disk that were saved
+// before loading to runtime failed are not undone.
+// This returns the first validation error from building the change set
+// without running anything, and otherwise the error from the failed
+// statement. If restoring fails as well, this returns a *RollbackError.
+// This propagates errors from sql.Exec, sql.Query, sql.Rows.Scan and
+// sql.Rows.Err
+func (c *ChangeSet) Apply() error {
+	return c.ApplyContext(context.Background())
+}
+
+// ApplyContext is Apply with a context, which the statements of the changes,
+// the rollback and the persisting are run with
+func (c *ChangeSet) ApplyContext(ctx context.Context) (err error) {
+	op := c.p.begin(ctx, "ChangeSet.Apply")
+	defer op.end(&err)
+	if c.err != nil {
+		return c.err
+	}
+	if len(c.changes) == 0 {
+		return nil
+	}
+	op.annotate(Attribute{AttributeRows, int64(len(c.changes))})
+	op.param("changes", len(c.changes))
+	defer op.lockThroughout()()
+	for _, check := range c.checks {
+		if err := check(op.ctx, c.p); err != nil {
+			return err
+		}
+	}
+	var tables []string
+	snapshots := make(map[string]*tableSnapshot)
+	for _, ch := range c.changes {
+		if _, ok := snapshots[ch.table]; ok {
+			continue
+		}
+		snapshot, err := takeSnapshot(op.ctx, c.p, ch.table)
+		if err != nil {
+			return err
+		}
+		snapshots[ch.table] = snapshot
+		tables = append(tables, ch.table)
+	}
+	rollback := func(err error) error {
+		for _, table := range tables {
+			if rerr := snapshots[table].restore(op.ctx, c.p); rerr != nil {
+				return &RollbackError{Err: err, RollbackErr: rerr}
+			}
+		}
+		return err
+	}
+	for _, ch := range c.changes {
+		if err := ch.run(op.ctx, c.p); err != nil {
+			return rollback(err)
+		}
+	}
+	for _, table := range tables {
+		for _, persistQuery := range persistQueries[table] {
+			if _, err := execRetrying(op.ctx, c.p, persistQuery, nil); err != nil {
+				return rollback(opError("", persistQuery, err))
+			}
+		}
+	}
+	return nil
+}
+
+func (c *ChangeSet) add(table string, run func(ctx context.Context, p *ProxySQL) error) *ChangeSet {
+	c.changes = append(c.changes, change{table, run})
+	return c
+}
+
+func (c *ChangeSet) addQuery(table, query string) *ChangeSet {
+	return c.add(table, func(ctx context.Context, p *ProxySQL) error {
+		_, err := execRetrying(ctx, p, query, nil)
+		return opError(table, query, err)
+	})
+}
+
+// addInsert adds an insert of the row that where matches, so that it can be
+// retried when it fails
+func (c *ChangeSet) addInsert(table, insertQuery, where string) *ChangeSet {
+	return c.add(table, func(ctx context.Context, p *ProxySQL) error {
+		_, err := execRetrying(ctx, p, insertQuery, rowsLanded(ctx, p, table, where, 1))
+		return opError(table, insertQuery, err)
+	})
+}
+
+// require adds a check that Apply runs after taking the lock, before it reads
+// or changes anything, so that nothing else changes ProxySQL between the
+// check and the changes. Apply returns the error of a failed check
+func (c *ChangeSet) require(check func(ctx context.Context, p *ProxySQL) error) *ChangeSet {
+	c.checks = append(c.checks, check)
+	return c
+}
+
+// fail records the first error, which Apply returns
+func (c *ChangeSet) fail(err error) *ChangeSet {
+	if c.err == nil {
+		c.err = err
+	}
+	return c
+}
+
+// tableSnapshot is every row of a table, read as strings so that it can be
+// written back regardless of the table's columns
+type tableSnapshot struct {
+	table   string
+	columns []string
+	rows    [][]sql.NullString
+}
+
+func takeSnapshot(ctx context.Context, p *ProxySQL, table string) (*tableSnapshot, error) {
+	selectQuery := fmt.Sprintf("select * from %s", table)
+	rows, err := queryRetrying(ctx, p, selectQuery)
+	if err != nil {
+		return nil, opError(table, selectQuery, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, opError(table, selectQuery, err)
+	}
+	snapshot := &tableSnapshot{table: table, columns: columns}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := scanRows(rows, dest...); err != nil {
+			return nil, opError(table, selectQuery, err)
+		}
+		snapshot.rows = append(snapshot.rows, values)
+	}
+	if rowsErr(rows) != nil && rowsErr(rows) != sql.ErrNoRows {
+		return nil, opError(table, selectQuery, rowsErr(rows))
+	}
+	return snapshot, nil
+}
+
+// restore replaces the contents of the table with the rows in the snapshot
+func (s *tableSnapshot) restore(ctx context.Context, p *ProxySQL) error {
+	deleteQuery := fmt.Sprintf("delete from %s", s.table)
+	if _, err := execRetrying(ctx, p, deleteQuery, nil); err != nil {
+		return opError(s.table, deleteQuery, err)
+	}
+	columns := fmt.Sprintf("(%s)", strings.Join(s.columns, ", "))
+	for _, row := range s.rows {
+		var buffer bytes.Buffer
+		conditions := make([]string, len(row))
+		for pos, value := range row {
+			if value.Valid {
+				buffer.WriteString(quote(value.String))
+				conditions[pos] = fmt.Sprintf("%s = %s", s.columns[pos], quote(value.String))
+			} else {
+				buffer.WriteString("NULL")
+				conditions[pos] = fmt.Sprintf("%s is null", s.columns[pos])
+			}
+			if pos != len(row)-1 {
+				buffer.WriteString(", ")
+			}
+		}
+		insertQuery := fmt.Sprintf("insert into %s %s values (%s)", s.table, columns, buffer.String())
+		landed := rowsLanded(ctx, p, s.table, " where "+strings.Join(conditions, " and "), 1)
+		if _, err := execRetrying(ctx, p, insertQuery, landed); err != nil {
+			return opError(s.table, insertQuery, err)
+		}
+	}
+	return nil
+}
+
+// quote returns s as an SQL string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,138 @@
+package proxysql
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChangeSetAppliesAndPersists(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	old := DefaultHost().SetHostname("old")
+	if err := conn.AddHosts(old, DefaultHost().SetHostname("kept")); err != nil {
+		t.Fatalf("could not add hosts: %v", err)
+	}
+	updated := DefaultHost().SetHostname("old").SetWeight(5)
+	err := conn.NewChangeSet().
+		AddHost(Hostname("new")).
+		UpdateHost(old, updated).
+		RemoveHostsLike(Hostname("kept")).
+		Apply()
+	if err != nil {
+		t.Fatalf("change set failed: %v", err)
+	}
+	expected := []*Host{updated, DefaultHost().SetHostname("new")}
+	runtime, err := conn.All(Table("runtime_mysql_servers"))
+	if err != nil {
+		t.Fatalf("could not read runtime: %v", err)
+	}
+	if !reflect.DeepEqual(runtime, expected) {
+		t.Fatalf("runtime was not changed: %v", runtime)
+	}
+}
+
+func TestChangeSetRestoresOnFailure(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	existing := DefaultHost().SetHostname("existing").SetComment("it's here")
+	// comments are not escaped by AddHosts, so insert this one directly
+	_, err := conn.Conn().Exec("insert into mysql_servers (hostname, comment) values ('existing', 'it''s here')")
+	if err != nil {
+		t.Fatalf("could not add host: %v", err)
+	}
+	// the second insert violates the primary key
+	err = conn.NewChangeSet().
+		RemoveHostsLike(Hostname("existing")).
+		AddHost(Hostname("new")).
+		AddHost(Hostname("new")).
+		Apply()
+	if err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		t.Fatalf("expected the constraint error, got: %v", err)
+	}
+	entries, err := conn.All()
+	if err != nil {
+		t.Fatalf("could not read hosts: %v", err)
+	}
+	if !reflect.DeepEqual(entries, []*Host{existing}) {
+		t.Fatalf("mysql_servers was not restored: %v", entries)
+	}
+	for _, q := range server.Queries() {
+		if strings.HasPrefix(q, "save") || strings.HasPrefix(q, "load") {
+			t.Fatalf("failed change set was persisted with: %s", q)
+		}
+	}
+}
+
+func TestChangeSetRestoresWhenPersistFails(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(func(q string) error {
+		if strings.HasPrefix(q, "load mysql servers") {
+			return errors.New("load failed")
+		}
+		return nil
+	})
+	err := conn.NewChangeSet().AddHost(Hostname("new")).Apply()
+	if err == nil || !strings.Contains(err.Error(), "load failed") {
+		t.Fatalf("expected the load error, got: %v", err)
+	}
+	entries, err := conn.All()
+	if err != nil {
+		t.Fatalf("could not read hosts: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("mysql_servers was not restored: %v", entries)
+	}
+}
+
+func TestChangeSetRollbackError(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(func(q string) error {
+		if strings.HasPrefix(q, "insert") || strings.HasPrefix(q, "delete") {
+			return errors.New("read only")
+		}
+		return nil
+	})
+	err := conn.NewChangeSet().AddHost(Hostname("new")).Apply()
+	rerr, ok := err.(*RollbackError)
+	if !ok {
+		t.Fatalf("expected a RollbackError, got: %v", err)
+	}
+	if rerr.Err == nil || rerr.RollbackErr == nil {
+		t.Fatalf("RollbackError is missing an error: %v", rerr)
+	}
+}
+
+func TestChangeSetValidationRunsNothing(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	err := conn.NewChangeSet().
+		AddHost(Hostname("fine")).
+		AddHost(Hostname("bad"), Port(-1)).
+		UpdateHost(DefaultHost(), DefaultHost().SetStatus("bad")).
+		Apply()
+	if !errors.Is(err, ErrConfigBadPort) {
+		t.Fatalf("expected the first validation error, got: %v", err)
+	}
+	if len(server.Queries()) != 0 {
+		t.Fatalf("queries were run for an invalid change set: %v", server.Queries())
+	}
+}
+
+func TestEmptyChangeSet(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	cs := conn.NewChangeSet()
+	if cs.Len() != 0 {
+		t.Fatalf("new change set has %d changes", cs.Len())
+	}
+	if err := cs.Apply(); err != nil {
+		t.Fatalf("empty change set failed: %v", err)
+	}
+	if len(server.Queries()) != 0 {
+		t.Fatalf("queries were run for an empty change set: %v", server.Queries())
+	}
+}
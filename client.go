@@ -0,0 +1,28 @@
+package proxysql
+
+// this file is for the Client interface that ProxySQL satisfies
+
+import (
+	"database/sql"
+)
+
+// Client is the set of functions that ProxySQL provides. Accept a Client
+// instead of a *ProxySQL in your own code so that you can substitute the
+// in-memory implementation from the proxysqlfake package in tests
+type Client interface {
+	Ping() error
+	Close()
+	Conn() *sql.DB
+	PersistChanges() error
+	AddHost(...HostOpts) error
+	AddHosts(...*Host) error
+	Clear() error
+	RemoveHost(*Host) error
+	RemoveHostsLike(...HostOpts) error
+	RemoveHosts(...*Host) error
+	HostsLike(...HostOpts) ([]*Host, error)
+	All(...HostOpts) ([]*Host, error)
+}
+
+// ensure ProxySQL keeps satisfying Client
+var _ Client = (*ProxySQL)(nil)
@@ -0,0 +1,68 @@
+package proxysql
+
+// this file is for structured metadata kept in the comment column of hosts
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// commentMarker starts the metadata in a comment
+const commentMarker = "proxysql-go:"
+
+// CommentMeta is metadata that the client keeps in the comment column of a
+// host, as JSON after any other text, like
+//
+//	replica in rack 2 proxysql-go:{"owner":"orders"}
+type CommentMeta map[string]string
+
+// ParseComment splits a comment into its text and its metadata. A comment
+// without metadata is all text, and its metadata is empty, but not nil
+func ParseComment(comment string) (string, CommentMeta) {
+	meta := make(CommentMeta)
+	i := strings.LastIndex(comment, commentMarker)
+	if i < 0 || json.Unmarshal([]byte(comment[i+len(commentMarker):]), &meta) != nil {
+		return comment, make(CommentMeta)
+	}
+	return strings.TrimSuffix(comment[:i], " "), meta
+}
+
+// FormatComment returns a comment with the text followed by the metadata, or
+// just the text if there is no metadata. Keys are written in sorted order
+func FormatComment(text string, meta CommentMeta) string {
+	if len(meta) == 0 {
+		return text
+	}
+	encoded, _ := json.Marshal(meta)
+	if text == "" {
+		return commentMarker + string(encoded)
+	}
+	return text + " " + commentMarker + string(encoded)
+}
+
+// Meta returns the value of a key in the metadata of the host's comment, or
+// an empty string if it is not set
+func (h *Host) Meta(key string) string {
+	_, meta := ParseComment(h.comment)
+	return meta[key]
+}
+
+// SetMeta sets a key in the metadata of the host's comment, or removes it if
+// value is empty. The text of the comment is kept
+func (h *Host) SetMeta(key, value string) *Host {
+	text, meta := ParseComment(h.comment)
+	if value == "" {
+		delete(meta, key)
+	} else {
+		meta[key] = value
+	}
+	h.comment = FormatComment(text, meta)
+	return h
+}
+
+// metaLike returns a Like pattern that selects the comments whose metadata
+// has the key set to value. value must not need escaping in JSON, or hold
+// % or _
+func metaLike(key, value string) string {
+	return "%" + commentMarker + "{%" + `"` + key + `":"` + value + `"%`
+}
@@ -0,0 +1,46 @@
+package proxysql
+
+import (
+	"testing"
+)
+
+func TestParseComment(t *testing.T) {
+	comments := map[string]struct {
+		text string
+		meta CommentMeta
+	}{
+		"":                               {"", CommentMeta{}},
+		"replica":                        {"replica", CommentMeta{}},
+		`proxysql-go:{"owner":"orders"}`: {"", CommentMeta{"owner": "orders"}},
+		`rack 2 proxysql-go:{"a":"1","owner":"x"}`: {"rack 2", CommentMeta{"a": "1", "owner": "x"}},
+		"proxysql-go:not json":                     {"proxysql-go:not json", CommentMeta{}},
+	}
+	for comment, expected := range comments {
+		text, meta := ParseComment(comment)
+		if text != expected.text || len(meta) != len(expected.meta) {
+			t.Errorf("%q parsed as %q, %v", comment, text, meta)
+		}
+		for key, value := range expected.meta {
+			if meta[key] != value {
+				t.Errorf("%q parsed as %q, %v", comment, text, meta)
+			}
+		}
+		if formatted := FormatComment(text, meta); len(meta) > 0 && formatted != comment {
+			t.Errorf("%q formatted as %q", comment, formatted)
+		}
+	}
+}
+
+func TestHostMeta(t *testing.T) {
+	host := DefaultHost().SetComment("rack 2").SetMeta("owner", "orders").SetMeta("ttl", "30s")
+	if host.Comment() != `rack 2 proxysql-go:{"owner":"orders","ttl":"30s"}` {
+		t.Fatalf("unexpected comment: %s", host.Comment())
+	}
+	if host.Meta("ttl") != "30s" || host.Owner() != "orders" {
+		t.Fatalf("metadata was not read: %s", host.Comment())
+	}
+	host.SetMeta("ttl", "").SetOwner("")
+	if host.Comment() != "rack 2" {
+		t.Fatalf("metadata was not removed: %s", host.Comment())
+	}
+}
@@ -0,0 +1,250 @@
+package proxysql
+
+// this file is for connecting to the admin interface from a structured config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DefaultAdminPort is the port of ProxySQL's admin interface, unless
+// admin-mysql_ifaces is changed
+const DefaultAdminPort = 6032
+
+// AdminConfig is how NewProxySQLFromConfig connects to ProxySQL's admin
+// interface. Zero values leave the driver's and database/sql's defaults
+type AdminConfig struct {
+	// Address is a host:port, a host, which uses DefaultAdminPort, or the
+	// absolute path of the admin unix socket
+	Address string
+	// Fallbacks are addresses that the client fails over to, in order, when
+	// Address stops answering, as a client from NewProxySQLFailover does
+	Fallbacks []string
+	// User and Password are the admin credentials, unless Credentials is set
+	User     string
+	Password string
+	// Credentials provides the user and password each time a connection is
+	// opened, instead of User and Password
+	Credentials CredentialsProvider
+	// TLS encrypts connections when it is set
+	TLS *AdminTLSConfig
+	// DialTimeout, ReadTimeout and WriteTimeout limit connecting, and each
+	// read and write on a connection
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime size the pool of
+	// connections to each address, as the sql.DB functions of the same names
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// AdminTLSConfig is how connections to the admin interface are encrypted
+type AdminTLSConfig struct {
+	// CAFile is a PEM file of the certificates that the server's certificate
+	// is verified against, instead of the system's
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and its key
+	CertFile string
+	KeyFile  string
+	// ServerName is the name verified in the server's certificate. It
+	// defaults to the host of the address
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// NewProxySQLFromConfig validates the config, and returns a client that
+// connects with it. The password is never written in to a DSN string, so it
+// can hold any character.
+// This will return a *ValidationError listing every invalid field, including
+// TLS files that can not be read
+func NewProxySQLFromConfig(config AdminConfig) (*ProxySQL, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.TLS.load()
+	if err != nil {
+		return nil, err
+	}
+	addresses := append([]string{config.Address}, config.Fallbacks...)
+	endpoints := make([]*endpoint, len(addresses))
+	var tlsKeys []string
+	for i, address := range addresses {
+		c := config.driverConfig(address)
+		if tlsConfig != nil {
+			endpointTLS := tlsConfig.Clone()
+			if endpointTLS.ServerName == "" && c.Net == "tcp" {
+				endpointTLS.ServerName, _, _ = net.SplitHostPort(c.Addr)
+			}
+			c.TLSConfig = fmt.Sprintf("proxysql-go-%d", atomic.AddUint64(&tlsConfigs, 1))
+			mysql.RegisterTLSConfig(c.TLSConfig, endpointTLS)
+			tlsKeys = append(tlsKeys, c.TLSConfig)
+		}
+		conn := sql.OpenDB(&adminConnector{config: c, credentials: config.credentials()})
+		conn.SetMaxOpenConns(config.MaxOpenConns)
+		if config.MaxIdleConns > 0 {
+			conn.SetMaxIdleConns(config.MaxIdleConns)
+		}
+		conn.SetConnMaxLifetime(config.ConnMaxLifetime)
+		// the DSN of the endpoint is kept without credentials
+		endpoints[i] = &endpoint{Endpoint{c.Net, c.Addr}, c.FormatDSN(), conn}
+	}
+	p := &ProxySQL{
+		dsn:       endpoints[0].dsn,
+		conn:      endpoints[0].conn,
+		batchSize: DefaultInsertBatchSize,
+		tlsKeys:   tlsKeys,
+	}
+	if len(endpoints) > 1 {
+		p.endpoints = endpoints
+	}
+	return p, nil
+}
+
+// Validate returns a *ValidationError listing every invalid field of the
+// config, or nil if it is valid. TLS files are not read
+func (c AdminConfig) Validate() error {
+	invalid := &ValidationError{}
+	if c.Address == "" {
+		invalid.add(invalidField("address", c.Address, ErrConfigNoAddress))
+	} else if _, _, err := parseAddress(c.Address); err != nil {
+		invalid.add(invalidField("address", c.Address, err))
+	}
+	for i, address := range c.Fallbacks {
+		if _, _, err := parseAddress(address); err != nil {
+			invalid.add(invalidField(fmt.Sprintf("fallbacks[%d]", i), address, err))
+		}
+	}
+	switch {
+	case c.Credentials != nil:
+	case c.User == "":
+		invalid.add(invalidField("user", c.User, ErrConfigNoUser))
+	case strings.Contains(c.User, ":"):
+		invalid.add(invalidField("user", c.User, ErrConfigBadUser))
+	}
+	for _, timeout := range []struct {
+		field string
+		value time.Duration
+	}{{"dial_timeout", c.DialTimeout}, {"read_timeout", c.ReadTimeout}, {"write_timeout", c.WriteTimeout}, {"conn_max_lifetime", c.ConnMaxLifetime}} {
+		if timeout.value < 0 {
+			invalid.add(invalidField(timeout.field, timeout.value.String(), ErrConfigBadTimeout))
+		}
+	}
+	if c.MaxOpenConns < 0 {
+		invalid.add(invalidField("max_open_conns", c.MaxOpenConns, ErrConfigBadPoolSize))
+	}
+	if c.MaxIdleConns < 0 {
+		invalid.add(invalidField("max_idle_conns", c.MaxIdleConns, ErrConfigBadPoolSize))
+	}
+	if c.TLS != nil && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid.add(invalidField("tls", nil, ErrConfigBadTLS))
+	}
+	return invalid.err()
+}
+
+func (c AdminConfig) credentials() CredentialsProvider {
+	if c.Credentials != nil {
+		return c.Credentials
+	}
+	return StaticCredentials(c.User, c.Password)
+}
+
+// driverConfig returns the driver's config for an address, without
+// credentials
+func (c AdminConfig) driverConfig(address string) *mysql.Config {
+	config := mysql.NewConfig()
+	config.Net, config.Addr, _ = parseAddress(address)
+	config.Timeout = c.DialTimeout
+	config.ReadTimeout = c.ReadTimeout
+	config.WriteTimeout = c.WriteTimeout
+	return config
+}
+
+// parseAddress returns the network and address of an admin interface
+func parseAddress(address string) (string, string, error) {
+	if isSocketPath(address) {
+		if ValidateHostname(address) != nil {
+			return "", "", ErrConfigBadAddress
+		}
+		return "unix", address, nil
+	}
+	host, port := address, strconv.Itoa(DefaultAdminPort)
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host, port = h, p
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 || ValidateHostname(host) != nil {
+		return "", "", ErrConfigBadAddress
+	}
+	return "tcp", net.JoinHostPort(host, port), nil
+}
+
+// the number of TLS configs registered with the driver, which names them
+var tlsConfigs uint64
+
+// load reads the files of the TLS config. A nil config loads as nil
+func (t *AdminTLSConfig) load() (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: t.ServerName, InsecureSkipVerify: t.InsecureSkipVerify}
+	invalid := &ValidationError{}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		config.RootCAs = x509.NewCertPool()
+		if err != nil {
+			invalid.add(&FieldError{Field: "tls.ca_file", Value: t.CAFile, Rule: err.Error(), Err: ErrConfigBadTLS})
+		} else if !config.RootCAs.AppendCertsFromPEM(pem) {
+			invalid.add(invalidField("tls.ca_file", t.CAFile, ErrConfigBadTLS))
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			invalid.add(&FieldError{Field: "tls.cert_file", Value: t.CertFile, Rule: err.Error(), Err: ErrConfigBadTLS})
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if err := invalid.err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// adminConnector opens connections with the credentials that its provider
+// returns at the time, so that new connections use changed credentials
+type adminConnector struct {
+	config      *mysql.Config
+	credentials CredentialsProvider
+}
+
+// Connect dials with ctx, so that the dial and handshake stop when it is done
+func (c *adminConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	credentials, err := c.credentials.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	config := c.config.Clone()
+	config.User, config.Passwd = credentials.User, credentials.Password
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *adminConnector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
@@ -0,0 +1,195 @@
+package proxysql
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kirinrastogi/proxysql-go/proxysqltest"
+)
+
+func TestAdminConfigValidate(t *testing.T) {
+	valid := AdminConfig{Address: "127.0.0.1:6032", User: "admin"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid config failed validation: %v", err)
+	}
+	invalid := AdminConfig{
+		Fallbacks:    []string{"proxysql:6032", "bad host:6032"},
+		User:         "ad:min",
+		ReadTimeout:  -time.Second,
+		MaxIdleConns: -1,
+		TLS:          &AdminTLSConfig{CertFile: "client.pem"},
+	}
+	err := invalid.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) != 6 {
+		t.Fatalf("expected 6 invalid fields, got: %v", err)
+	}
+	for _, sentinel := range []error{ErrConfigNoAddress, ErrConfigBadAddress, ErrConfigBadUser, ErrConfigBadTimeout, ErrConfigBadPoolSize, ErrConfigBadTLS} {
+		if !errors.Is(err, sentinel) {
+			t.Errorf("%v was not reported: %v", sentinel, err)
+		}
+	}
+	if validationErr.Fields[1].Field != "fallbacks[1]" {
+		t.Errorf("unexpected field: %v", validationErr.Fields[1])
+	}
+	if err := (AdminConfig{Address: "proxysql"}).Validate(); !errors.Is(err, ErrConfigNoUser) {
+		t.Errorf("missing user was not reported: %v", err)
+	}
+	if err := (AdminConfig{Address: "proxysql", Credentials: StaticCredentials("admin", "admin")}).Validate(); err != nil {
+		t.Errorf("credentials provider was not accepted: %v", err)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	addresses := map[string][2]string{
+		"127.0.0.1:6033":           {"tcp", "127.0.0.1:6033"},
+		"proxysql":                 {"tcp", "proxysql:6032"},
+		"[::1]:6032":               {"tcp", "[::1]:6032"},
+		"/tmp/proxysql_admin.sock": {"unix", "/tmp/proxysql_admin.sock"},
+		"proxysql.svc.local:16032": {"tcp", "proxysql.svc.local:16032"},
+	}
+	for address, expected := range addresses {
+		network, addr, err := parseAddress(address)
+		if err != nil || network != expected[0] || addr != expected[1] {
+			t.Errorf("%s parsed as %s %s, %v", address, network, addr, err)
+		}
+	}
+	for _, address := range []string{"proxysql:0", "proxysql:70000", "proxysql:port", "bad_host", "/tmp/bad socket"} {
+		if _, _, err := parseAddress(address); err != ErrConfigBadAddress {
+			t.Errorf("%s was accepted: %v", address, err)
+		}
+	}
+}
+
+func TestNewProxySQLFromConfig(t *testing.T) {
+	password := "p@ss/w:rd?x=1"
+	server := startServer(t, proxysqltest.Credentials("admin", password))
+	defer server.Close()
+	conn, err := NewProxySQLFromConfig(AdminConfig{
+		Address:      server.Addr(),
+		User:         "admin",
+		Password:     password,
+		DialTimeout:  time.Second,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+		MaxOpenConns: 3,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.AddHost(Hostname("db-1")); err != nil {
+		t.Fatalf("could not connect with the config: %v", err)
+	}
+	if stats := conn.Conn().Stats(); stats.MaxOpenConnections != 3 {
+		t.Fatalf("pool was not sized: %+v", stats)
+	}
+	if conn.ActiveEndpoint() != (Endpoint{"tcp", server.Addr()}) {
+		t.Fatalf("unexpected endpoint: %v", conn.ActiveEndpoint())
+	}
+	if _, err := NewProxySQLFromConfig(AdminConfig{Address: server.Addr()}); !errors.Is(err, ErrConfigNoUser) {
+		t.Fatalf("invalid config was not rejected: %v", err)
+	}
+}
+
+func TestNewProxySQLFromConfigFallbacks(t *testing.T) {
+	socket := startServer(t, proxysqltest.Socket(filepath.Join(t.TempDir(), "admin.sock")))
+	defer socket.Close()
+	closed := startServer(t)
+	closed.Close()
+	conn, err := NewProxySQLFromConfig(AdminConfig{
+		Address:     closed.Addr(),
+		Fallbacks:   []string{socket.Addr()},
+		Credentials: StaticCredentials("admin", "admin"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(); err != nil || conn.ActiveEndpoint() != (Endpoint{"unix", socket.Addr()}) {
+		t.Fatalf("did not fail over to the socket: %v, %v", conn.ActiveEndpoint(), err)
+	}
+}
+
+// writeCertificate writes a self signed certificate and its key to dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "proxysql"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestAdminConnectorUsesContext(t *testing.T) {
+	silent := silentListener(t)
+	defer silent.Close()
+	conn, err := NewProxySQLFromConfig(AdminConfig{Address: silent.Addr().String(), User: "admin"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := conn.PingContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the connection to time out, got: %v", err)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Fatalf("connecting did not stop when the context was done, waited %v", waited)
+	}
+}
+
+func TestAdminTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	config, err := (&AdminTLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}).load()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if config.RootCAs == nil || len(config.Certificates) != 1 {
+		t.Fatalf("files were not loaded: %+v", config)
+	}
+	_, err = (&AdminTLSConfig{CAFile: keyFile, CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile}).load()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 || !errors.Is(err, ErrConfigBadTLS) {
+		t.Fatalf("bad files were not reported: %v", err)
+	}
+	conn, err := NewProxySQLFromConfig(AdminConfig{Address: "proxysql", User: "admin", TLS: &AdminTLSConfig{CAFile: certFile}})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(conn.tlsKeys) != 1 || conn.dsn != "tcp(proxysql:6032)/?tls="+conn.tlsKeys[0] {
+		t.Fatalf("TLS config was not registered: %v, %s", conn.tlsKeys, conn.dsn)
+	}
+	conn.Close()
+}
@@ -0,0 +1,154 @@
+package proxysql
+
+// this file is for the users and passwords that clients connect with, and
+// that they configure ProxySQL with
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrCredentialsNotSet = errors.New("Bad credentials, the user and password must be set")
+	ErrUserNotFound      = errors.New("Bad user, must be the username of a row of mysql_users")
+)
+
+// Credentials are a user and the password it authenticates with. They print
+// without the password
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// String returns the user, with the password redacted
+func (c Credentials) String() string {
+	return c.User + ":<redacted>"
+}
+
+// CredentialsProvider returns the credentials to use. Clients ask for them
+// each time they open a connection, so a provider whose credentials change
+// is picked up when the client next reconnects
+type CredentialsProvider interface {
+	Credentials() (Credentials, error)
+}
+
+type staticCredentials Credentials
+
+// StaticCredentials returns a provider that always returns the same user and
+// password
+func StaticCredentials(user, password string) CredentialsProvider {
+	return staticCredentials{user, password}
+}
+
+func (s staticCredentials) Credentials() (Credentials, error) {
+	return Credentials(s), nil
+}
+
+type fileCredentials struct {
+	user, passwordFile string
+}
+
+// FileCredentials returns a provider of the user, and of the password in a
+// file, such as one that a secrets system writes and rotates. The file is
+// read each time, and whitespace around the password is trimmed.
+// The provider returns ErrCredentialsNotSet if the file is empty, and
+// propagates errors from reading it
+func FileCredentials(user, passwordFile string) CredentialsProvider {
+	return fileCredentials{user, passwordFile}
+}
+
+func (f fileCredentials) Credentials() (Credentials, error) {
+	contents, err := os.ReadFile(f.passwordFile)
+	if err != nil {
+		return Credentials{}, err
+	}
+	password := strings.TrimSpace(string(contents))
+	if f.user == "" || password == "" {
+		return Credentials{}, ErrCredentialsNotSet
+	}
+	return Credentials{f.user, password}, nil
+}
+
+type envCredentials struct {
+	userVar, passwordVar string
+}
+
+// EnvCredentials returns a provider of the user and password in environment
+// variables, which are read each time.
+// The provider returns ErrCredentialsNotSet if either is not set
+func EnvCredentials(userVar, passwordVar string) CredentialsProvider {
+	return envCredentials{userVar, passwordVar}
+}
+
+func (e envCredentials) Credentials() (Credentials, error) {
+	user, userSet := os.LookupEnv(e.userVar)
+	password, passwordSet := os.LookupEnv(e.passwordVar)
+	if !userSet || !passwordSet || user == "" {
+		return Credentials{}, fmt.Errorf("%w: %s, %s", ErrCredentialsNotSet, e.userVar, e.passwordVar)
+	}
+	return Credentials{user, password}, nil
+}
+
+// SetMonitorCredentials sets the user and password that ProxySQL's monitor
+// connects to the backends with to the ones from the provider, loads them to
+// runtime, and saves them to disk.
+// This will propagate errors from the provider, and from sql.Exec
+func (p *ProxySQL) SetMonitorCredentials(provider CredentialsProvider) error {
+	return p.SetMonitorCredentialsContext(context.Background(), provider)
+}
+
+// SetMonitorCredentialsContext is SetMonitorCredentials with a context
+func (p *ProxySQL) SetMonitorCredentialsContext(ctx context.Context, provider CredentialsProvider) (err error) {
+	op := p.begin(ctx, "SetMonitorCredentials")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, "global_variables"})
+	credentials, err := provider.Credentials()
+	if err != nil {
+		return err
+	}
+	op.param("user", credentials.User)
+	defer op.lock()()
+	variables := [][2]string{{"mysql-monitor_username", credentials.User}, {"mysql-monitor_password", credentials.Password}}
+	for _, variable := range variables {
+		statement := fmt.Sprintf("update global_variables set variable_value = %s where variable_name = %s", quote(variable[1]), quote(variable[0]))
+		if _, err := execRetrying(op.ctx, p, statement, nil); err != nil {
+			return opError("global_variables", statement, err)
+		}
+	}
+	return persist(op.ctx, p, "global_variables")
+}
+
+// SetUserCredentials sets the password of the user from the provider in
+// mysql_users, for both its frontend and backend rows, loads the users to
+// runtime, and saves them to disk.
+// This will return ErrUserNotFound if there is no such user, and propagate
+// errors from the provider, and from sql.Exec
+func (p *ProxySQL) SetUserCredentials(provider CredentialsProvider) error {
+	return p.SetUserCredentialsContext(context.Background(), provider)
+}
+
+// SetUserCredentialsContext is SetUserCredentials with a context
+func (p *ProxySQL) SetUserCredentialsContext(ctx context.Context, provider CredentialsProvider) (err error) {
+	op := p.begin(ctx, "SetUserCredentials")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, "mysql_users"})
+	credentials, err := provider.Credentials()
+	if err != nil {
+		return err
+	}
+	op.param("user", credentials.User)
+	defer op.lock()()
+	statement := fmt.Sprintf("update mysql_users set password = %s where username = %s", quote(credentials.Password), quote(credentials.User))
+	n, err := affected(execRetrying(op.ctx, p, statement, nil))
+	if err != nil {
+		return opError("mysql_users", statement, err)
+	}
+	// changes in dry run mode change no rows
+	if n == 0 && !op.dryRun {
+		return invalidField("username", credentials.User, ErrUserNotFound)
+	}
+	return persist(op.ctx, p, "mysql_users")
+}
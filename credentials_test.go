@@ -0,0 +1,122 @@
+package proxysql
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kirinrastogi/proxysql-go/proxysqltest"
+)
+
+type testVariable struct {
+	Name  string `db:"variable_name"`
+	Value string `db:"variable_value"`
+}
+
+func TestCredentialsString(t *testing.T) {
+	credentials, _ := StaticCredentials("admin", "secret").Credentials()
+	if s := credentials.String(); s != "admin:<redacted>" {
+		t.Fatalf("password was printed: %s", s)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	provider := FileCredentials("admin", path)
+	if _, err := provider.Credentials(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing file was not reported: %v", err)
+	}
+	os.WriteFile(path, []byte("first\n"), 0600)
+	if credentials, err := provider.Credentials(); err != nil || credentials != (Credentials{"admin", "first"}) {
+		t.Fatalf("unexpected credentials: %v, %v", credentials, err)
+	}
+	os.WriteFile(path, []byte("second"), 0600)
+	if credentials, _ := provider.Credentials(); credentials.Password != "second" {
+		t.Fatalf("rotated password was not read: %v", credentials)
+	}
+	os.WriteFile(path, nil, 0600)
+	if _, err := provider.Credentials(); err != ErrCredentialsNotSet {
+		t.Fatalf("empty file was not reported: %v", err)
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+	provider := EnvCredentials("PROXYSQL_TEST_USER", "PROXYSQL_TEST_PASSWORD")
+	t.Setenv("PROXYSQL_TEST_USER", "admin")
+	if _, err := provider.Credentials(); !errors.Is(err, ErrCredentialsNotSet) {
+		t.Fatalf("unset password was not reported: %v", err)
+	}
+	t.Setenv("PROXYSQL_TEST_PASSWORD", "secret")
+	if credentials, err := provider.Credentials(); err != nil || credentials != (Credentials{"admin", "secret"}) {
+		t.Fatalf("unexpected credentials: %v, %v", credentials, err)
+	}
+}
+
+func TestCredentialsRotateOnReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(path, []byte("first"), 0600)
+	server := startServer(t, proxysqltest.Credentials("admin", "first"))
+	defer server.Close()
+	conn, err := NewProxySQLFromConfig(AdminConfig{Address: server.Addr(), Credentials: FileCredentials("admin", path)})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	conn.Conn().SetMaxIdleConns(0)
+	if err := conn.Ping(); err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	server.SetCredentials("admin", "second")
+	if err := conn.Ping(); err == nil {
+		t.Fatal("connected with the old password")
+	}
+	os.WriteFile(path, []byte("second"), 0600)
+	if err := conn.Ping(); err != nil {
+		t.Fatalf("did not reconnect with the rotated password: %v", err)
+	}
+}
+
+func TestSetMonitorCredentials(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	if err := conn.SetMonitorCredentials(StaticCredentials("monitor2", "s3cret")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	variables, _ := NewTypedTable[testVariable](conn, "runtime_global_variables")
+	rows, err := variables.Select(Where(Like("variable_name", "mysql-monitor_%name")))
+	if err != nil || len(rows) != 1 || rows[0].Value != "monitor2" {
+		t.Fatalf("monitor user was not loaded to runtime: %v, %v", rows, err)
+	}
+	rows, _ = variables.Select(Where(Eq("variable_name", "mysql-monitor_password")))
+	if len(rows) != 1 || rows[0].Value != "s3cret" {
+		t.Fatalf("monitor password was not loaded to runtime: %v", rows)
+	}
+	server.SetQueryHook(failFirst(1, "update global_variables set variable_value = 'n3w'", errors.New("read only")))
+	err = conn.SetMonitorCredentials(StaticCredentials("monitor2", "n3w"))
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "SetMonitorCredentials" || strings.Contains(opErr.SQL, "n3w") {
+		t.Fatalf("password was not redacted: %v", err)
+	}
+}
+
+func TestSetUserCredentials(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	users, _ := NewTypedTable[testUser](conn, "mysql_users")
+	if err := users.Insert(&testUser{Username: "app", Password: "old", Active: true}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := conn.SetUserCredentials(StaticCredentials("app", "new")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	runtime, _ := NewTypedTable[testUser](conn, "runtime_mysql_users")
+	rows, err := runtime.Select()
+	if err != nil || len(rows) != 1 || rows[0].Password != "new" {
+		t.Fatalf("password was not loaded to runtime: %v, %v", rows, err)
+	}
+	if err := conn.SetUserCredentials(StaticCredentials("nobody", "pw")); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown user was not reported: %v", err)
+	}
+}
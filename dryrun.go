@@ -0,0 +1,80 @@
+package proxysql
+
+// this file is for recording the statements that would change ProxySQL,
+// instead of running them
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+// DryRunEntry is a statement that a client in dry run mode did not run
+type DryRunEntry struct {
+	Time time.Time
+	// Op is the method that would have run the statement, like AddHost
+	Op string
+	// Table is the table the statement would have changed, if it names one
+	Table string
+	// SQL is the statement, with passwords, credentials and secrets redacted
+	SQL string
+}
+
+// SetDryRun turns dry run mode on or off. In dry run mode, methods that
+// change ProxySQL, such as AddHost, RemoveHostsLike, Clear, PersistChanges
+// and ChangeSet.Apply, validate their input as usual, but record each
+// statement they would run in DryRunJournal instead of running it. Reads,
+// including the ones that changes make first, still query ProxySQL. Changes
+// are reported as changing no rows. Calls that are running when the mode is
+// changed finish in the mode they began in.
+func (p *ProxySQL) SetDryRun(dryRun bool) {
+	p.settingsMut.Lock()
+	defer p.settingsMut.Unlock()
+	p.dryRun = dryRun
+}
+
+// DryRun reports whether the client is in dry run mode
+func (p *ProxySQL) DryRun() bool {
+	p.settingsMut.RLock()
+	defer p.settingsMut.RUnlock()
+	return p.dryRun
+}
+
+// dryRunning reports whether statements run with ctx are recorded instead of
+// being run, as decided when the operation they belong to began
+func dryRunning(ctx context.Context, p *ProxySQL) bool {
+	if o := operationOf(ctx); o != nil {
+		return o.dryRun
+	}
+	return p.DryRun()
+}
+
+// DryRunJournal returns the statements recorded in dry run mode, in the
+// order they would have run
+func (p *ProxySQL) DryRunJournal() []DryRunEntry {
+	p.journalMut.Lock()
+	defer p.journalMut.Unlock()
+	return append([]DryRunEntry(nil), p.journal...)
+}
+
+// ResetDryRunJournal discards the statements recorded in dry run mode
+func (p *ProxySQL) ResetDryRunJournal() {
+	p.journalMut.Lock()
+	defer p.journalMut.Unlock()
+	p.journal = nil
+}
+
+// record adds a statement to the dry run journal, and returns the result of
+// a statement that changed nothing
+func (p *ProxySQL) record(ctx context.Context, statement string) sql.Result {
+	entry := DryRunEntry{Time: time.Now(), SQL: redact(statement)}
+	_, entry.Table = statementTarget(statement)
+	if o := operationOf(ctx); o != nil {
+		entry.Op = o.name
+	}
+	p.journalMut.Lock()
+	defer p.journalMut.Unlock()
+	p.journal = append(p.journal, entry)
+	return driver.RowsAffected(0)
+}
@@ -0,0 +1,108 @@
+package proxysql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDryRunRecordsChanges(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	if err := conn.AddHost(Hostname("db-1"), HostgroupID(1)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	conn.SetDryRun(true)
+	if !conn.DryRun() {
+		t.Fatal("dry run mode was not turned on")
+	}
+	before := len(server.Queries())
+	conn.AddHost(Hostname("db-2"), HostgroupID(1))
+	conn.AddHosts(DefaultHost().SetHostname("db-3"), DefaultHost().SetHostname("db-4"))
+	conn.RemoveHostsLike(Hostname("db-1"), Limit(1))
+	conn.Clear()
+	conn.PersistChanges()
+	conn.SetUserCredentials(StaticCredentials("app", "secretpw"))
+	journal := conn.DryRunJournal()
+	expected := []struct{ op, table, prefix string }{
+		{"AddHost", "mysql_servers", "insert into mysql_servers"},
+		{"AddHosts", "mysql_servers", "insert into mysql_servers"},
+		{"RemoveHostsLike", "mysql_servers", "delete from mysql_servers where"},
+		{"Clear", "mysql_servers", "delete from mysql_servers"},
+		{"PersistChanges", "", "save mysql servers to disk"},
+		{"PersistChanges", "", "load mysql servers to runtime"},
+		{"SetUserCredentials", "mysql_users", "update mysql_users set password = '<redacted>'"},
+		{"SetUserCredentials", "", "save mysql users to disk"},
+		{"SetUserCredentials", "", "load mysql users to runtime"},
+	}
+	if len(journal) != len(expected) {
+		t.Fatalf("expected %d statements, got %+v", len(expected), journal)
+	}
+	for i, entry := range journal {
+		if entry.Op != expected[i].op || entry.Table != expected[i].table || !strings.HasPrefix(entry.SQL, expected[i].prefix) || entry.Time.IsZero() {
+			t.Errorf("unexpected statement %d: %+v", i, entry)
+		}
+	}
+	// reads still run, but nothing that changes ProxySQL does
+	for _, q := range server.Queries()[before:] {
+		if !strings.HasPrefix(q, "select") {
+			t.Errorf("statement was run in dry run mode: %s", q)
+		}
+	}
+	hosts, err := conn.All()
+	if err != nil || len(hosts) != 1 || hosts[0].Hostname() != "db-1" {
+		t.Fatalf("dry run changed ProxySQL: %v, %v", hosts, err)
+	}
+	conn.ResetDryRunJournal()
+	if len(conn.DryRunJournal()) != 0 {
+		t.Fatal("journal was not reset")
+	}
+}
+
+func TestDryRunTurnedOnDuringChange(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(func(q string) error {
+		if strings.HasPrefix(q, "insert into mysql_servers") {
+			conn.SetDryRun(true)
+		}
+		return nil
+	})
+	err := conn.NewChangeSet().
+		AddHost(Hostname("db-1"), HostgroupID(1)).
+		AddHost(Hostname("db-2"), HostgroupID(1)).
+		Apply()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// the change set began before dry run mode was turned on, so it runs
+	if journal := conn.DryRunJournal(); len(journal) != 0 {
+		t.Fatalf("statements of a change set that began before dry run were recorded: %+v", journal)
+	}
+	if hosts, err := conn.All(); err != nil || len(hosts) != 2 {
+		t.Fatalf("change set did not finish: %v, %v", hosts, err)
+	}
+	conn.AddHost(Hostname("db-3"), HostgroupID(1))
+	if journal := conn.DryRunJournal(); len(journal) != 1 || journal[0].Op != "AddHost" {
+		t.Fatalf("change after dry run was turned on was not recorded: %+v", journal)
+	}
+}
+
+func TestDryRunValidates(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.SetDryRun(true)
+	if err := conn.AddHost(Hostname("db-1"), Port(-1)); !errors.Is(err, ErrConfigBadPort) {
+		t.Fatalf("invalid host was not rejected: %v", err)
+	}
+	if err := conn.AddHost(Table("runtime_mysql_servers"), Hostname("db-1")); !errors.Is(err, ErrTableReadOnly) {
+		t.Fatalf("write to runtime was not rejected: %v", err)
+	}
+	if len(conn.DryRunJournal()) != 0 {
+		t.Fatalf("invalid changes were recorded: %v", conn.DryRunJournal())
+	}
+	conn.SetDryRun(false)
+	if err := conn.AddHost(Hostname("db-1")); err != nil || len(conn.DryRunJournal()) != 0 {
+		t.Fatalf("statement was recorded after dry run mode was turned off: %v", err)
+	}
+}
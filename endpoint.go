@@ -0,0 +1,157 @@
+package proxysql
+
+// this file is for failing over between the admin interfaces of ProxySQL
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrNoEndpoints is returned by NewProxySQLFailover when it is given no DSNs
+var ErrNoEndpoints = errors.New("Bad endpoints, must give at least one DSN")
+
+// Endpoint is an admin interface of ProxySQL that a client connects to
+type Endpoint struct {
+	// Net is tcp, or unix for the admin socket
+	Net string
+	// Addr is the host:port, or the path of the socket
+	Addr string
+}
+
+// String returns the endpoint as it is written in a DSN, like
+// tcp(127.0.0.1:6032) or unix(/tmp/proxysql_admin.sock)
+func (e Endpoint) String() string {
+	return fmt.Sprintf("%s(%s)", e.Net, e.Addr)
+}
+
+// EndpointError is returned when none of a client's endpoints answer a ping
+type EndpointError struct {
+	Endpoints []Endpoint
+	// Errs is the error from pinging each of the Endpoints
+	Errs []error
+}
+
+func (e *EndpointError) Error() string {
+	failures := make([]string, len(e.Endpoints))
+	for i, endpoint := range e.Endpoints {
+		failures[i] = fmt.Sprintf("%s: %v", endpoint, e.Errs[i])
+	}
+	return "no admin endpoint is healthy: " + strings.Join(failures, "; ")
+}
+
+// Unwrap returns the error from pinging each endpoint
+func (e *EndpointError) Unwrap() []error {
+	return e.Errs
+}
+
+type endpoint struct {
+	Endpoint
+	dsn  string
+	conn *sql.DB
+}
+
+// endpointOf reads the endpoint from a DSN, or returns the zero Endpoint if
+// the DSN can not be parsed
+func endpointOf(dsn string) Endpoint {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return Endpoint{}
+	}
+	return Endpoint{Net: config.Net, Addr: config.Addr}
+}
+
+// NewProxySQLFailover returns a client that uses the first of the DSNs, and
+// fails over to the next one that answers a ping when the one it is using
+// stops answering, such as the admin interface on localhost, then one on
+// the node's address, then the admin unix socket. Set a timeout in each DSN
+// so that an endpoint that does not answer is given up on quickly.
+// This will return ErrNoEndpoints if there are no DSNs, and propagate errors
+// from sql.Open
+func NewProxySQLFailover(dsns ...string) (*ProxySQL, error) {
+	if len(dsns) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	endpoints := make([]*endpoint, len(dsns))
+	for i, dsn := range dsns {
+		conn, err := open("mysql", dsn)
+		if err != nil {
+			for _, e := range endpoints[:i] {
+				e.conn.Close()
+			}
+			return nil, err
+		}
+		endpoints[i] = &endpoint{endpointOf(dsn), dsn, conn}
+	}
+	return &ProxySQL{
+		dsn:       endpoints[0].dsn,
+		conn:      endpoints[0].conn,
+		batchSize: DefaultInsertBatchSize,
+		endpoints: endpoints,
+	}, nil
+}
+
+// Endpoints returns the endpoints of the client, in the order they are
+// preferred
+func (p *ProxySQL) Endpoints() []Endpoint {
+	if len(p.endpoints) == 0 {
+		return []Endpoint{endpointOf(p.dsn)}
+	}
+	endpoints := make([]Endpoint, len(p.endpoints))
+	for i, e := range p.endpoints {
+		endpoints[i] = e.Endpoint
+	}
+	return endpoints
+}
+
+// ActiveEndpoint returns the endpoint that the client is using
+func (p *ProxySQL) ActiveEndpoint() Endpoint {
+	p.endpointMut.RLock()
+	defer p.endpointMut.RUnlock()
+	return endpointOf(p.dsn)
+}
+
+// CheckEndpoints pings each endpoint in order, and uses the first that
+// answers. Call this periodically to return to a preferred endpoint once it
+// has recovered.
+// This will return an *EndpointError if no endpoint answers
+func (p *ProxySQL) CheckEndpoints() error {
+	return p.CheckEndpointsContext(context.Background())
+}
+
+// CheckEndpointsContext is CheckEndpoints with a context, which each ping is
+// run with, so that an endpoint that does not answer can be given up on
+func (p *ProxySQL) CheckEndpointsContext(ctx context.Context) error {
+	if len(p.endpoints) == 0 {
+		return p.db().PingContext(ctx)
+	}
+	errs := make([]error, len(p.endpoints))
+	for i, e := range p.endpoints {
+		if errs[i] = e.conn.PingContext(ctx); errs[i] == nil {
+			p.endpointMut.Lock()
+			p.dsn, p.conn = e.dsn, e.conn
+			p.endpointMut.Unlock()
+			return nil
+		}
+	}
+	return &EndpointError{Endpoints: p.Endpoints(), Errs: errs}
+}
+
+// failover is called when a statement fails with a transient error, and
+// switches to the first endpoint that answers, if there are others
+func (p *ProxySQL) failover(ctx context.Context) {
+	if len(p.endpoints) > 1 {
+		p.CheckEndpointsContext(ctx)
+	}
+}
+
+// db returns the connection of the active endpoint
+func (p *ProxySQL) db() *sql.DB {
+	p.endpointMut.RLock()
+	defer p.endpointMut.RUnlock()
+	return p.conn
+}
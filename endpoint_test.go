@@ -0,0 +1,163 @@
+package proxysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kirinrastogi/proxysql-go/proxysqltest"
+)
+
+func startServer(t *testing.T, opts ...proxysqltest.ServerOpts) *proxysqltest.Server {
+	server, err := proxysqltest.NewServer(opts...)
+	if err != nil {
+		t.Fatalf("could not start test server: %v", err)
+	}
+	return server
+}
+
+func TestNewProxySQLFailover(t *testing.T) {
+	if _, err := NewProxySQLFailover(); err != ErrNoEndpoints {
+		t.Fatalf("expected ErrNoEndpoints, got: %v", err)
+	}
+	if _, err := NewProxySQLFailover("admin:admin@tcp(127.0.0.1:6032)/", "not a dsn"); err == nil {
+		t.Fatal("bad dsn was accepted")
+	}
+	conn, err := NewProxySQLFailover("admin:admin@tcp(127.0.0.1:6032)/", "admin:admin@unix(/tmp/proxysql_admin.sock)/")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	expected := []Endpoint{{"tcp", "127.0.0.1:6032"}, {"unix", "/tmp/proxysql_admin.sock"}}
+	if endpoints := conn.Endpoints(); len(endpoints) != 2 || endpoints[0] != expected[0] || endpoints[1] != expected[1] {
+		t.Fatalf("unexpected endpoints: %v", endpoints)
+	}
+	if active := conn.ActiveEndpoint(); active.String() != "tcp(127.0.0.1:6032)" {
+		t.Fatalf("first endpoint is not active: %v", active)
+	}
+}
+
+func TestFailoverOnPing(t *testing.T) {
+	tcp := startServer(t)
+	socket := startServer(t, proxysqltest.Socket(filepath.Join(t.TempDir(), "admin.sock")))
+	defer socket.Close()
+	conn, err := NewProxySQLFailover(tcp.DSN(), socket.DSN())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(); err != nil || conn.ActiveEndpoint().Addr != tcp.Addr() {
+		t.Fatalf("did not use the first endpoint: %v, %v", conn.ActiveEndpoint(), err)
+	}
+	tcp.Close()
+	if err := conn.Ping(); err != nil {
+		t.Fatalf("did not fail over: %v", err)
+	}
+	if active := conn.ActiveEndpoint(); active.Net != "unix" || active.Addr != socket.Addr() {
+		t.Fatalf("socket is not active: %v", active)
+	}
+	if err := conn.AddHost(Hostname("db-1")); err != nil {
+		t.Fatalf("could not add host after failing over: %v", err)
+	}
+	socket.Close()
+	var endpointErr *EndpointError
+	if err := conn.Ping(); !errors.As(err, &endpointErr) || len(endpointErr.Errs) != 2 {
+		t.Fatalf("expected an EndpointError, got: %v", err)
+	}
+}
+
+func TestFailoverOnTransientError(t *testing.T) {
+	first, second := startServer(t), startServer(t)
+	defer second.Close()
+	conn, err := NewProxySQLFailover(first.DSN(), second.DSN())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	conn.SetRetryPolicy(RetryPolicy{MaxAttempts: 2})
+	sleep = func(context.Context, time.Duration) error { return nil }
+	defer resetHelpers()
+	if err := conn.AddHost(Hostname("db-1")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	first.Close()
+	if err := conn.AddHost(Hostname("db-2")); err != nil {
+		t.Fatalf("insert was not retried on the second endpoint: %v", err)
+	}
+	if conn.ActiveEndpoint().Addr != second.Addr() {
+		t.Fatalf("did not fail over: %v", conn.ActiveEndpoint())
+	}
+	if hosts, _ := conn.All(); len(hosts) != 1 || hosts[0].Hostname() != "db-2" {
+		t.Fatalf("unexpected hosts on the second endpoint: %v", hosts)
+	}
+}
+
+func TestFailback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	socket, tcp := startServer(t, proxysqltest.Socket(path)), startServer(t)
+	defer tcp.Close()
+	conn, err := NewProxySQLFailover(socket.DSN(), tcp.DSN())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	socket.Close()
+	if err := conn.CheckEndpoints(); err != nil || conn.ActiveEndpoint().Addr != tcp.Addr() {
+		t.Fatalf("did not fail over: %v, %v", conn.ActiveEndpoint(), err)
+	}
+	restarted := startServer(t, proxysqltest.Socket(path))
+	defer restarted.Close()
+	if err := conn.CheckEndpoints(); err != nil || conn.ActiveEndpoint().Addr != path {
+		t.Fatalf("did not return to the socket: %v, %v", conn.ActiveEndpoint(), err)
+	}
+	if err := conn.AddHost(Hostname("db-1")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(restarted.Queries()) == 0 {
+		t.Fatal("statement was not sent to the socket")
+	}
+}
+
+// silentListener accepts connections, but never answers them
+func silentListener(t *testing.T) net.Listener {
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	go func() {
+		for {
+			c, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	return silent
+}
+
+func TestCheckEndpointsGivesUpWithContext(t *testing.T) {
+	silent := silentListener(t)
+	defer silent.Close()
+	server := startServer(t)
+	defer server.Close()
+	conn, err := NewProxySQLFailover(fmt.Sprintf("admin:admin@tcp(%s)/", silent.Addr()), server.DSN())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var endpointErr *EndpointError
+	if err := conn.CheckEndpointsContext(ctx); !errors.As(err, &endpointErr) || !errors.Is(endpointErr.Errs[0], context.DeadlineExceeded) {
+		t.Fatalf("expected the silent endpoint to time out, got: %v", err)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Fatalf("ping did not stop when the context was done, waited %v", waited)
+	}
+}
@@ -0,0 +1,159 @@
+package proxysql
+
+// this file is for the errors that describe what failed, and why
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// FieldError is a field of a host, or an option, whose value is invalid.
+// Err is the sentinel for the rule, like ErrConfigBadPort
+type FieldError struct {
+	// Field is the column, or the option such as table, where or limit
+	Field string
+	// Value is the invalid value, or nil if there is none to report
+	Value interface{}
+	// Rule is what the value must satisfy, like "must be in [0, 65535]"
+	Rule string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	if e.Value == nil {
+		return fmt.Sprintf("%s: %s", e.Field, e.Rule)
+	}
+	return fmt.Sprintf("%s %#v: %s", e.Field, e.Value, e.Rule)
+}
+
+// Unwrap returns the sentinel for the rule
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when a host or options do not pass validation.
+// It lists every invalid field, and errors.Is matches the sentinel of each:
+//
+//	if errors.Is(err, ErrConfigBadPort) {...}
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		fields[i] = field.Error()
+	}
+	return "invalid configuration: " + strings.Join(fields, "; ")
+}
+
+// Is reports whether any of the fields are invalid because of target
+func (e *ValidationError) Is(target error) bool {
+	for _, field := range e.Fields {
+		if errors.Is(field, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// add records err, which may be a *FieldError, a *ValidationError, or a
+// sentinel that is not about a single field
+func (e *ValidationError) add(err error) {
+	var invalid *ValidationError
+	var field *FieldError
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid):
+		e.Fields = append(e.Fields, invalid.Fields...)
+	case errors.As(err, &field):
+		e.Fields = append(e.Fields, field)
+	default:
+		e.Fields = append(e.Fields, &FieldError{Rule: ruleOf(err), Err: err})
+	}
+}
+
+// err returns e, or nil if no fields are invalid
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// invalidField returns a FieldError whose rule is taken from the sentinel
+func invalidField(field string, value interface{}, sentinel error) *FieldError {
+	return &FieldError{Field: field, Value: value, Rule: ruleOf(sentinel), Err: sentinel}
+}
+
+// sentinels read like "Bad port value, must be in [0, 65535]", and the rule
+// is the part after the comma
+func ruleOf(sentinel error) string {
+	msg := sentinel.Error()
+	if i := strings.Index(msg, ", "); i >= 0 {
+		return msg[i+2:]
+	}
+	return msg
+}
+
+// OpError is returned when a statement sent to ProxySQL fails, and wraps the
+// error from the driver
+type OpError struct {
+	// Op is the method that ran the statement, like AddHosts
+	Op string
+	// Table is the table the statement used, or empty for statements such as
+	// LOAD MYSQL SERVERS TO RUNTIME
+	Table string
+	// SQL is the statement, with passwords and credentials redacted
+	SQL string
+	// Code is the MySQL error number, or 0 if the error did not come from
+	// ProxySQL
+	Code uint16
+	Err  error
+}
+
+func (e *OpError) Error() string {
+	msg := fmt.Sprintf("%v, running %q", e.Err, e.SQL)
+	switch {
+	case e.Op != "" && e.Table != "":
+		return fmt.Sprintf("%s on %s: %s", e.Op, e.Table, msg)
+	case e.Op != "" || e.Table != "":
+		return fmt.Sprintf("%s: %s", e.Op+e.Table, msg)
+	}
+	return msg
+}
+
+// Unwrap returns the error from the driver
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// opError wraps an error from running a statement on a table
+func opError(table, statement string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var opErr *OpError
+	if errors.As(err, &opErr) {
+		return err
+	}
+	var code uint16
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		code = mysqlErr.Number
+	}
+	return &OpError{Table: table, SQL: redact(statement), Code: code, Err: err}
+}
+
+// nameOp sets the Op of an *OpError that err wraps, if it is not set. Methods
+// defer it with their name, so that the errors of the methods they call are
+// reported as theirs
+func nameOp(op string, err *error) {
+	var opErr *OpError
+	if errors.As(*err, &opErr) && opErr.Op == "" {
+		opErr.Op = op
+	}
+}
@@ -0,0 +1,143 @@
+package proxysql
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidationErrorListsEveryField(t *testing.T) {
+	host := DefaultHost().SetHostname("db-1").SetPort(70000).SetStatus("UP").SetWeight(-1)
+	err := host.Valid()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("did not receive a ValidationError: %v", err)
+	}
+	expected := []*FieldError{
+		{"port", 70000, "must be in [0, 65535]", ErrConfigBadPort},
+		{"status", "UP", "must be one of 'ONLINE','SHUNNED','OFFLINE_SOFT', 'OFFLINE_HARD'", ErrConfigBadStatus},
+		{"weight", -1, "must be > 0", ErrConfigBadWeight},
+	}
+	if !reflect.DeepEqual(invalid.Fields, expected) {
+		t.Fatalf("unexpected fields: %v", err)
+	}
+	for _, sentinel := range []error{ErrConfigBadPort, ErrConfigBadStatus, ErrConfigBadWeight} {
+		if !errors.Is(err, sentinel) {
+			t.Errorf("error did not match %v", sentinel)
+		}
+	}
+	if errors.Is(err, ErrConfigBadUseSSL) {
+		t.Errorf("error matched a field that is valid")
+	}
+	if err.Error() != `invalid configuration: port 70000: must be in [0, 65535]; status "UP": must be one of 'ONLINE','SHUNNED','OFFLINE_SOFT', 'OFFLINE_HARD'; weight -1: must be > 0` {
+		t.Errorf("unexpected message: %v", err)
+	}
+}
+
+func TestValidationErrorIncludesOptions(t *testing.T) {
+	_, err := buildAndParseHostQueryWithHostname(Port(1), Port(2), Where(Eq("nope", 1)), Limit(-1))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("did not receive a ValidationError: %v", err)
+	}
+	fields := make([]string, len(invalid.Fields))
+	for i, field := range invalid.Fields {
+		fields[i] = field.Field
+	}
+	if !reflect.DeepEqual(fields, []string{"port", "where", "limit", "hostname"}) {
+		t.Fatalf("unexpected fields: %v", err)
+	}
+	if invalid.Fields[1].Value != "nope = 1" || !errors.Is(err, ErrConfigDuplicateSpec) || !errors.Is(err, ErrConfigNoHostname) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestOpErrorFromProxySQL(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	if err := conn.AddHost(Hostname("db-1")); err != nil {
+		t.Fatalf("could not add host: %v", err)
+	}
+	err := conn.AddHost(Hostname("db-1"))
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("did not receive an OpError: %v", err)
+	}
+	if opErr.Op != "AddHost" || opErr.Table != "mysql_servers" || opErr.Code != 1045 || !strings.HasPrefix(opErr.SQL, "insert into mysql_servers") {
+		t.Fatalf("unexpected OpError: %+v", opErr)
+	}
+	if !strings.HasPrefix(err.Error(), "AddHost on mysql_servers: Error 1045: ProxySQL Admin Error: UNIQUE constraint failed") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+
+	// the method that was called is reported, not the ones it called
+	server.SetQueryHook(func(q string) error {
+		if q == "load mysql servers to runtime" {
+			return errors.New("not now")
+		}
+		return nil
+	})
+	err = conn.NewChangeSet().AddHost(Hostname("db-2")).Apply()
+	if !errors.As(err, &opErr) || opErr.Op != "ChangeSet.Apply" || opErr.Table != "" || opErr.SQL != "load mysql servers to runtime" {
+		t.Fatalf("unexpected error from change set: %v", err)
+	}
+}
+
+func TestOpErrorRedactsSecrets(t *testing.T) {
+	_, users, teardown := usersSetup(t)
+	defer teardown()
+	err := users.Insert(&testUser{Username: "app", Password: "hunter2"}, &testUser{Username: "app", Password: "hunter2"})
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "TypedTable.Insert" || opErr.Table != "mysql_users" {
+		t.Fatalf("did not receive an OpError: %v", err)
+	}
+	if strings.Contains(err.Error(), "hunter2") || !strings.Contains(opErr.SQL, "('app', '<redacted>', 0, 0, 0)") {
+		t.Fatalf("password was not redacted: %v", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{
+			"insert into mysql_users (username, password, active) values ('a', 'pw1', 1), ('b', 'it''s, (pw)', 0)",
+			"insert into mysql_users (username, password, active) values ('a', '<redacted>', 1), ('b', '<redacted>', 0)",
+		},
+		{
+			"update mysql_users set username = 'a', password = 'pw' where password like 'p%'",
+			"update mysql_users set username = 'a', password = '<redacted>' where password like '<redacted>'",
+		},
+		{
+			"update global_variables set variable_value = 'pw' where variable_name = 'mysql-monitor_password'",
+			"update global_variables set variable_value = '<redacted>' where variable_name = 'mysql-monitor_password'",
+		},
+		{
+			"set admin-admin_credentials = 'admin:admin;radmin:pw'",
+			"set admin-admin_credentials = '<redacted>'",
+		},
+		{
+			"insert into global_variables (variable_name, variable_value) values ('mysql-monitor_password', 'pw'), ('mysql-monitor_username', 'monitor')",
+			"insert into global_variables (variable_name, variable_value) values ('mysql-monitor_password', '<redacted>'), ('mysql-monitor_username', 'monitor')",
+		},
+		{
+			"insert into mysql_servers (hostgroup_id, hostname) values (1, 'db-1')",
+			"insert into mysql_servers (hostgroup_id, hostname) values (1, 'db-1')",
+		},
+		{
+			"insert into mysql_servers (hostname, comment) values ('db-1', 'rotate the password monthly')",
+			"insert into mysql_servers (hostname, comment) values ('db-1', 'rotate the password monthly')",
+		},
+		{
+			"where password != 'pw' and (password in ('a', 'b')) and username in ('app') limit 1",
+			"where password != '<redacted>' and (password in ('<redacted>', '<redacted>')) and username in ('app') limit 1",
+		},
+		{"load mysql users to runtime", "load mysql users to runtime"},
+	}
+	for _, test := range tests {
+		if out := redact(test.in); out != test.out {
+			t.Errorf("redacted %q as %q", test.in, out)
+		}
+	}
+}
@@ -7,14 +7,6 @@ import (
 	"log"
 )
 
-// ProxySQLConn is an example interface to accept as a parameter to funcs
-// instead of actual sql.DB connections
-type ProxySQLConn interface {
-	AddHost(...HostOpts) error
-	AddHosts(...*Host) error
-	PersistChanges() error
-}
-
 func main() {
 	// this is the dsn of the container that ./run.sh creates
 	conn, err := NewProxySQL("remote-admin:password@tcp(localhost:6032)/")
@@ -41,7 +33,8 @@ func main() {
 	log.Println("Success")
 }
 
-func addHostsAndSave(conn ProxySQLConn) error {
+// accept a Client instead of a *ProxySQL so that tests can pass a fake
+func addHostsAndSave(conn Client) error {
 	err := conn.AddHost(Hostname("example"), HostgroupID(1))
 	if err != nil {
 		return err
@@ -1,16 +1,36 @@
 package main
 
 import (
+	"errors"
+	. "github.com/kirinrastogi/proxysql-go"
+	"github.com/kirinrastogi/proxysql-go/proxysqlfake"
 	"testing"
 )
 
 // Test functionality of addHostsAndSave
 func TestAddHostsAndSaveErrorsOnConnectionFailure(t *testing.T) {
-	mock := NewProxySQLMock()
-	mock.healthy = false
-	err := addHostsAndSave(mock)
+	fake := proxysqlfake.New()
+	fake.SetError(errors.New("ping failed"))
+	err := addHostsAndSave(fake)
 	if err == nil {
 		t.Fatal("AddHostsAndSave did not return error on ping fail")
 	}
 	t.Log(err)
 }
+
+func TestAddHostsAndSavePersistsBothHosts(t *testing.T) {
+	fake := proxysqlfake.New()
+	if err := addHostsAndSave(fake); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	hosts, err := fake.HostsLike(Table("runtime_mysql_servers"), HostgroupID(1))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].Hostname() != "example" {
+		t.Fatalf("example host was not persisted to runtime: %v", hosts)
+	}
+	if len(fake.Runtime()) != 2 {
+		t.Fatalf("did not persist both hosts to runtime: %v", fake.Runtime())
+	}
+}
@@ -0,0 +1,454 @@
+package proxysql
+
+// this file is for predicates, ordering and limits in queries, which select
+// hosts by more than equality
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Predicate is a condition on the columns of mysql_servers that selects hosts
+// in HostsLike and RemoveHostsLike. Build them with Eq, Ne, Lt, Le, Gt, Ge,
+// In, Like, Not, And and Or, and pass them to Where:
+//
+//	conn.HostsLike(Where(
+//	  Gt("weight", 0),
+//	  In("status", "ONLINE", "SHUNNED"),
+//	  Or(Eq("hostgroup_id", 1), Eq("hostgroup_id", 2)),
+//	))
+//
+// Values must be an int for integer columns, an int or float64 for float
+// columns, and a string for the others
+type Predicate struct {
+	op       string
+	column   string
+	values   []interface{}
+	children []Predicate
+}
+
+type orderTerm struct {
+	column string
+	desc   bool
+}
+
+// Eq selects hosts whose column equals value
+func Eq(column string, value interface{}) Predicate {
+	return Predicate{op: "=", column: column, values: []interface{}{value}}
+}
+
+// Ne selects hosts whose column does not equal value
+func Ne(column string, value interface{}) Predicate {
+	return Predicate{op: "!=", column: column, values: []interface{}{value}}
+}
+
+// Lt selects hosts whose column is less than value
+func Lt(column string, value interface{}) Predicate {
+	return Predicate{op: "<", column: column, values: []interface{}{value}}
+}
+
+// Le selects hosts whose column is less than or equal to value
+func Le(column string, value interface{}) Predicate {
+	return Predicate{op: "<=", column: column, values: []interface{}{value}}
+}
+
+// Gt selects hosts whose column is greater than value
+func Gt(column string, value interface{}) Predicate {
+	return Predicate{op: ">", column: column, values: []interface{}{value}}
+}
+
+// Ge selects hosts whose column is greater than or equal to value
+func Ge(column string, value interface{}) Predicate {
+	return Predicate{op: ">=", column: column, values: []interface{}{value}}
+}
+
+// In selects hosts whose column equals one of values.
+// At least one value must be given
+func In(column string, values ...interface{}) Predicate {
+	return Predicate{op: "in", column: column, values: values}
+}
+
+// Like selects hosts whose column matches pattern, where '%' matches any
+// sequence of characters and '_' matches any one character. As in ProxySQL,
+// ASCII letters match regardless of case. The column must be a string column
+func Like(column string, pattern string) Predicate {
+	return Predicate{op: "like", column: column, values: []interface{}{pattern}}
+}
+
+// Not selects hosts that p does not select
+func Not(p Predicate) Predicate {
+	return Predicate{op: "not", children: []Predicate{p}}
+}
+
+// And selects hosts that every one of preds selects.
+// At least one predicate must be given
+func And(preds ...Predicate) Predicate {
+	return Predicate{op: "and", children: preds}
+}
+
+// Or selects hosts that any one of preds selects.
+// At least one predicate must be given
+func Or(preds ...Predicate) Predicate {
+	return Predicate{op: "or", children: preds}
+}
+
+// Where adds predicates to a query. Hosts must satisfy all of them, as well
+// as any values specified with the other HostOpts
+func Where(preds ...Predicate) HostOpts {
+	return func(opts *hostQuery) *hostQuery {
+		opts.predicates = append(opts.predicates, preds...)
+		return opts
+	}
+}
+
+// OrderBy sorts the hosts a query selects by the columns given, ascending.
+// Calls to OrderBy and OrderByDesc add columns in the order they are made
+func OrderBy(columns ...string) HostOpts {
+	return func(opts *hostQuery) *hostQuery {
+		for _, column := range columns {
+			opts.orderBy = append(opts.orderBy, orderTerm{column, false})
+		}
+		return opts
+	}
+}
+
+// OrderByDesc sorts the hosts a query selects by the columns given, descending
+func OrderByDesc(columns ...string) HostOpts {
+	return func(opts *hostQuery) *hostQuery {
+		for _, column := range columns {
+			opts.orderBy = append(opts.orderBy, orderTerm{column, true})
+		}
+		return opts
+	}
+}
+
+// Limit selects at most n hosts, after they are ordered by OrderBy
+func Limit(n int) HostOpts {
+	return func(opts *hostQuery) *hostQuery {
+		opts.limit = n
+		opts.hasLimit = true
+		return opts
+	}
+}
+
+// returns ErrConfigBadColumn or ErrConfigBadPredicate if a predicate is
+// malformed for a table with columns of the given kinds
+func (p Predicate) validate(kinds map[string]columnKind) error {
+	switch p.op {
+	case "not", "and", "or":
+		if len(p.children) == 0 {
+			return ErrConfigBadPredicate
+		}
+		for _, child := range p.children {
+			if err := child.validate(kinds); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	kind, ok := kinds[p.column]
+	if !ok {
+		return ErrConfigBadColumn
+	}
+	if len(p.values) == 0 || (p.op == "like" && kind != kindString) {
+		return ErrConfigBadPredicate
+	}
+	for _, value := range p.values {
+		switch value.(type) {
+		case int:
+			if kind == kindString {
+				return ErrConfigBadPredicate
+			}
+		case float64:
+			if kind != kindFloat {
+				return ErrConfigBadPredicate
+			}
+		case string:
+			if kind != kindString {
+				return ErrConfigBadPredicate
+			}
+		default:
+			return ErrConfigBadPredicate
+		}
+	}
+	return nil
+}
+
+// String returns the predicate as SQL
+func (p Predicate) String() string {
+	return p.sql()
+}
+
+// builds a string like
+// weight > 0 and (hostgroup_id = 1 or hostgroup_id = 2)
+func (p Predicate) sql() string {
+	switch p.op {
+	case "not":
+		return fmt.Sprintf("not (%s)", p.children[0].sql())
+	case "and", "or":
+		parts := make([]string, len(p.children))
+		for i, child := range p.children {
+			parts[i] = fmt.Sprintf("(%s)", child.sql())
+		}
+		return strings.Join(parts, fmt.Sprintf(" %s ", p.op))
+	case "in":
+		parts := make([]string, len(p.values))
+		for i, value := range p.values {
+			parts[i] = literal(value)
+		}
+		return fmt.Sprintf("%s in (%s)", p.column, strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", p.column, p.op, literal(p.values[0]))
+}
+
+// matches evaluates the predicate against a host the way ProxySQL does
+func (p Predicate) matches(h *Host) bool {
+	switch p.op {
+	case "not":
+		return !p.children[0].matches(h)
+	case "and":
+		for _, child := range p.children {
+			if !child.matches(h) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, child := range p.children {
+			if child.matches(h) {
+				return true
+			}
+		}
+		return false
+	case "in":
+		for _, value := range p.values {
+			if compareColumn(h, p.column, value) == 0 {
+				return true
+			}
+		}
+		return false
+	case "like":
+		return likeMatch(columnValue(h, p.column).(string), p.values[0].(string))
+	}
+	c := compareColumn(h, p.column, p.values[0])
+	switch p.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func literal(value interface{}) string {
+	return fieldLiteral(reflect.ValueOf(value))
+}
+
+func columnValue(h *Host, column string) interface{} {
+	switch column {
+	case "hostgroup_id":
+		return h.hostgroup_id
+	case "hostname":
+		return h.hostname
+	case "port":
+		return h.port
+	case "status":
+		return h.status
+	case "weight":
+		return h.weight
+	case "compression":
+		return h.compression
+	case "max_connections":
+		return h.max_connections
+	case "max_replication_lag":
+		return h.max_replication_lag
+	case "use_ssl":
+		return h.use_ssl
+	case "max_latency_ms":
+		return h.max_latency_ms
+	}
+	return h.comment
+}
+
+// compareColumn returns -1, 0 or 1 as the host's column is less than, equal
+// to or greater than value, which has the column's type
+func compareColumn(h *Host, column string, value interface{}) int {
+	switch v := columnValue(h, column).(type) {
+	case int:
+		other := value.(int)
+		if v < other {
+			return -1
+		} else if v > other {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(v, value.(string))
+	}
+	return 0
+}
+
+// likeMatch matches s against a LIKE pattern as SQLite does
+func likeMatch(s, pattern string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '%':
+		for i := 0; i <= len(s); i++ {
+			if likeMatch(s[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return s != "" && likeMatch(s[1:], pattern[1:])
+	}
+	return s != "" && asciiLower(s[0]) == asciiLower(pattern[0]) && likeMatch(s[1:], pattern[1:])
+}
+
+func asciiLower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// tableQuery is what selects rows of any table: predicates, including
+// those for the values specified with the column options, ordering and limit
+type tableQuery struct {
+	where    []Predicate
+	orderBy  []orderTerm
+	limit    int
+	hasLimit bool
+}
+
+// tableQuery turns the specified values in to equality predicates, which
+// come before the predicates from Where
+func (opts *hostQuery) tableQuery() *tableQuery {
+	q := &tableQuery{orderBy: opts.orderBy, limit: opts.limit, hasLimit: opts.hasLimit}
+	for _, field := range opts.specifiedFields {
+		q.where = append(q.where, Eq(field, columnValue(opts.host, field)))
+	}
+	q.where = append(q.where, opts.predicates...)
+	return q
+}
+
+// returns ErrConfigBadColumn, ErrConfigBadPredicate, or ErrConfigBadLimit
+func validateFilters(opts *hostQuery) error {
+	return opts.tableQuery().validate(serverKinds)
+}
+
+// returns a *ValidationError listing each predicate, order by column and
+// limit that is not valid for a table with columns of the given kinds, with
+// ErrConfigBadColumn, ErrConfigBadPredicate, or ErrConfigBadLimit
+func (q *tableQuery) validate(kinds map[string]columnKind) error {
+	invalid := &ValidationError{}
+	for _, pred := range q.where {
+		if err := pred.validate(kinds); err != nil {
+			invalid.add(invalidField("where", pred.String(), err))
+		}
+	}
+	for _, term := range q.orderBy {
+		if _, ok := kinds[term.column]; !ok {
+			invalid.add(invalidField("order by", term.column, ErrConfigBadColumn))
+		}
+	}
+	if q.hasLimit && q.limit < 0 {
+		invalid.add(invalidField("limit", q.limit, ErrConfigBadLimit))
+	}
+	return invalid.err()
+}
+
+// builds a string like
+//
+//	where a1 = b1 and (c > 1 or c < 0)
+//
+// or an empty string if the query selects every row
+func (q *tableQuery) whereClause() string {
+	if len(q.where) == 0 {
+		return ""
+	}
+	conditions := make([]string, len(q.where))
+	for i, pred := range q.where {
+		conditions[i] = pred.sql()
+		if pred.op == "or" {
+			conditions[i] = fmt.Sprintf("(%s)", conditions[i])
+		}
+	}
+	return " where " + strings.Join(conditions, " and ")
+}
+
+// builds a string like
+//
+//	order by a1, b1 desc limit 5
+//
+// or an empty string if the query is not ordered or limited
+func (q *tableQuery) orderAndLimit() string {
+	var buffer bytes.Buffer
+	for pos, term := range q.orderBy {
+		if pos == 0 {
+			buffer.WriteString(" order by ")
+		} else {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(term.column)
+		if term.desc {
+			buffer.WriteString(" desc")
+		}
+	}
+	if q.hasLimit {
+		buffer.WriteString(fmt.Sprintf(" limit %d", q.limit))
+	}
+	return buffer.String()
+}
+
+// limited reports whether the query selects at most some number of hosts
+func (opts *hostQuery) limited() bool {
+	return opts.hasLimit
+}
+
+// tableOnly reports whether the query specifies nothing but the table
+func (opts *hostQuery) tableOnly() bool {
+	return len(opts.specifiedFields) == 0 && len(opts.predicates) == 0 && len(opts.orderBy) == 0 && !opts.limited()
+}
+
+// matches reports whether a host satisfies the specified values and the
+// predicates of a query
+func (opts *hostQuery) matches(h *Host) bool {
+	for _, field := range opts.specifiedFields {
+		if columnValue(h, field) != columnValue(opts.host, field) {
+			return false
+		}
+	}
+	for _, pred := range opts.predicates {
+		if !pred.matches(h) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortHosts orders hosts by the query's order by columns. Hosts that are
+// equal in every column keep their order
+func (opts *hostQuery) sortHosts(hosts []*Host) {
+	sort.SliceStable(hosts, func(i, j int) bool {
+		for _, term := range opts.orderBy {
+			c := compareColumn(hosts[i], term.column, columnValue(hosts[j], term.column))
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != term.desc
+		}
+		return false
+	})
+}
@@ -0,0 +1,186 @@
+package proxysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBuildSelectQueryWithFilters(t *testing.T) {
+	opts, err := buildAndParseHostQuery(
+		HostgroupID(1),
+		Where(Gt("weight", 0), In("status", "ONLINE", "SHUNNED")),
+		Where(Or(Like("hostname", "db-%"), Not(Eq("comment", "it's")))),
+		OrderBy("hostname"),
+		OrderByDesc("port"),
+		Limit(5),
+	)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	q := buildSelectQuery(opts)
+	expected := "select * from mysql_servers where hostgroup_id = 1 and weight > 0 and status in ('ONLINE', 'SHUNNED') and ((hostname like 'db-%') or (not (comment = 'it''s'))) order by hostname, port desc limit 5"
+	if q != expected {
+		t.Fatalf("select query was not expected: %s", q)
+	}
+}
+
+func TestBuildQueriesWithoutConditions(t *testing.T) {
+	opts, err := buildAndParseHostQuery()
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if q := buildSelectQuery(opts); q != "select * from mysql_servers" {
+		t.Fatalf("select query was not expected: %s", q)
+	}
+	if q := buildDeleteQuery(opts); q != "delete from mysql_servers" {
+		t.Fatalf("delete query was not expected: %s", q)
+	}
+}
+
+func TestFilterValidation(t *testing.T) {
+	tests := []struct {
+		opts HostOpts
+		err  error
+	}{
+		{Where(Eq("nope", 1)), ErrConfigBadColumn},
+		{Where(Eq("port", "3306")), ErrConfigBadPredicate},
+		{Where(Eq("hostname", 1)), ErrConfigBadPredicate},
+		{Where(Eq("weight", 1.5)), ErrConfigBadPredicate},
+		{Where(In("port")), ErrConfigBadPredicate},
+		{Where(Like("port", "33%")), ErrConfigBadPredicate},
+		{Where(Or()), ErrConfigBadPredicate},
+		{Where(Not(And(Eq("port", 1), Eq("nope", 1)))), ErrConfigBadColumn},
+		{OrderBy("nope"), ErrConfigBadColumn},
+		{Limit(-1), ErrConfigBadLimit},
+		{Limit(0), nil},
+	}
+	for _, test := range tests {
+		if _, err := buildAndParseHostQuery(test.opts); !errors.Is(err, test.err) {
+			t.Errorf("expected %v, got %v", test.err, err)
+		}
+	}
+}
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		match      bool
+	}{
+		{"db-1", "db-%", true},
+		{"DB-1", "db-%", true},
+		{"db-1", "db-_", true},
+		{"db-10", "db-_", false},
+		{"db", "%", true},
+		{"", "%", true},
+		{"", "_", false},
+		{"replica", "%lic%", true},
+		{"replica", "rep", false},
+	}
+	for _, test := range tests {
+		if likeMatch(test.s, test.pattern) != test.match {
+			t.Errorf("%q like %q should be %v", test.s, test.pattern, test.match)
+		}
+	}
+}
+
+func TestAllRejectsFilters(t *testing.T) {
+	conn := shortSetup(t)
+	for _, opt := range []HostOpts{Where(Eq("port", 1)), OrderBy("port"), Limit(1)} {
+		if _, err := conn.All(opt); err != ErrConfigAllTableOnly {
+			t.Errorf("All did not reject filters: %v", err)
+		}
+	}
+}
+
+func filterHosts() []*Host {
+	return []*Host{
+		DefaultHost().SetHostname("db-1").SetHostgroupID(1).SetWeight(10),
+		DefaultHost().SetHostname("db-2").SetHostgroupID(1).SetWeight(5).SetStatus("SHUNNED"),
+		DefaultHost().SetHostname("DB-3").SetHostgroupID(2).SetWeight(5),
+		DefaultHost().SetHostname("cache-1").SetHostgroupID(2).SetWeight(1).SetStatus("OFFLINE_SOFT"),
+		DefaultHost().SetHostname("cache-2").SetHostgroupID(3).SetPort(3307).SetComment("old"),
+	}
+}
+
+// the fake in proxysqlfake relies on ParsedHostOpts.Select, so it must agree
+// with ProxySQL about which hosts are selected
+func TestHostsLikeFiltersMatchSelect(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	hosts := filterHosts()
+	if err := conn.AddHosts(hosts...); err != nil {
+		t.Fatalf("could not add hosts: %v", err)
+	}
+	queries := [][]HostOpts{
+		{Where(Gt("weight", 1), In("status", "ONLINE", "SHUNNED"))},
+		{Where(Like("hostname", "db-%")), OrderByDesc("hostname")},
+		{Where(Or(Eq("hostgroup_id", 1), Eq("hostgroup_id", 3)))},
+		{Where(Not(Eq("status", "ONLINE"))), OrderBy("weight")},
+		{Where(Le("port", 3306), Ne("comment", "old")), OrderBy("weight", "hostname"), Limit(2)},
+		{HostgroupID(2), Where(Ge("weight", 1), Lt("weight", 5))},
+		{OrderByDesc("weight"), OrderBy("hostname"), Limit(3)},
+		{Limit(0)},
+	}
+	for i, opts := range queries {
+		entries, err := conn.HostsLike(opts...)
+		if err != nil {
+			t.Fatalf("query %d failed: %v", i, err)
+		}
+		parsed, err := ParseHostOpts(opts...)
+		if err != nil {
+			t.Fatalf("query %d did not parse: %v", i, err)
+		}
+		selected := parsed.Select(hosts)
+		if !reflect.DeepEqual(entries, selected) {
+			t.Errorf("query %d: ProxySQL returned %v, Select returned %v", i, entries, selected)
+		}
+	}
+}
+
+func TestRemoveHostsLikeWithLimit(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	hosts := filterHosts()
+	if err := conn.AddHosts(hosts...); err != nil {
+		t.Fatalf("could not add hosts: %v", err)
+	}
+	err := conn.RemoveHostsLike(Where(Like("hostname", "%-%")), OrderByDesc("weight"), OrderBy("hostname"), Limit(2))
+	if err != nil {
+		t.Fatalf("could not remove hosts: %v", err)
+	}
+	entries, err := conn.All()
+	if err != nil {
+		t.Fatalf("could not read hosts: %v", err)
+	}
+	expected := []*Host{hosts[1], hosts[3], hosts[4]}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("did not remove the first two hosts by weight: %v", entries)
+	}
+	// nothing matches, so nothing is deleted
+	if err := conn.RemoveHostsLike(Where(Eq("hostname", "none")), Limit(1)); err != nil {
+		t.Fatalf("could not remove hosts: %v", err)
+	}
+}
+
+func TestRemoveHostsLikeWithFilters(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	hosts := filterHosts()
+	if err := conn.AddHosts(hosts...); err != nil {
+		t.Fatalf("could not add hosts: %v", err)
+	}
+	if err := conn.RemoveHostsLike(Where(In("hostgroup_id", 2, 3))); err != nil {
+		t.Fatalf("could not remove hosts: %v", err)
+	}
+	entries, err := conn.All()
+	if err != nil {
+		t.Fatalf("could not read hosts: %v", err)
+	}
+	if !reflect.DeepEqual(entries, hosts[:2]) {
+		t.Fatalf("did not remove hostgroups 2 and 3: %v", entries)
+	}
+	if q := server.Queries(); q[len(q)-2] != "delete from mysql_servers where hostgroup_id in (2, 3)" {
+		t.Fatalf("unexpected delete query: %s", q[len(q)-2])
+	}
+}
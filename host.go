@@ -4,6 +4,7 @@ package proxysql
 
 import (
 	"fmt"
+	"reflect"
 )
 
 // Host represents a row in ProxySQL's mysql_servers config table
@@ -142,20 +143,86 @@ func (h *Host) Comment() string {
 	return h.comment
 }
 
+// Valid returns a *ValidationError listing the columns of the host that are
+// not valid to write, including an empty hostname, as in DefaultHost, and a
+// hostname that the hostname validator rejects
 func (h *Host) Valid() error {
 	hq := defaultHostQuery()
 	hq.host = h
-	return validateHostQuery(hq)
+	return validateHostQuery(hq, validateHostname, validateHostnameFormat)
 }
 
 func (h *Host) values() string {
-	return fmt.Sprintf("(%d, '%s', %d, '%s', %d, %d, %d, %d, %d, %d, '%s')", h.hostgroup_id, h.hostname, h.port, h.status, h.weight, h.compression, h.max_connections, h.max_replication_lag, h.use_ssl, h.max_latency_ms, h.comment)
+	return servers(nil, "mysql_servers").values(rowFromHost(h))
 }
 
 func (h *Host) columns() string {
-	return "(hostgroup_id, hostname, port, status, weight, compression, max_connections, max_replication_lag, use_ssl, max_latency_ms, comment)"
+	return servers(nil, "mysql_servers").columnList()
 }
 
 func (h *Host) where() string {
-	return fmt.Sprintf("hostgroup_id = %d and hostname = '%s' and port = %d and status = '%s' and weight = %d and compression = %d and max_connections = %d and max_replication_lag = %d and use_ssl = %d and max_latency_ms = %d and comment = '%s'", h.hostgroup_id, h.hostname, h.port, h.status, h.weight, h.compression, h.max_connections, h.max_replication_lag, h.use_ssl, h.max_latency_ms, h.comment)
+	return servers(nil, "mysql_servers").rowWhere(rowFromHost(h))
+}
+
+func (h *Host) assignments() string {
+	return servers(nil, "mysql_servers").assignments(rowFromHost(h))
+}
+
+// HostKey identifies a server in mysql_servers, whose primary key is
+// (hostgroup_id, hostname, port)
+type HostKey struct {
+	HostgroupID int
+	Hostname    string
+	Port        int
+}
+
+func (k HostKey) String() string {
+	return fmt.Sprintf("%s:%d in hostgroup %d", k.Hostname, k.Port, k.HostgroupID)
+}
+
+// FieldDiff is a column whose value differs between two hosts
+type FieldDiff struct {
+	Column string
+	Old    interface{}
+	New    interface{}
+}
+
+func (d FieldDiff) String() string {
+	return fmt.Sprintf("%s: %v -> %v", d.Column, d.Old, d.New)
+}
+
+// Key returns the primary key of the host. Hosts with the same key are the
+// same server, though their other columns may differ
+func (h *Host) Key() HostKey {
+	return HostKey{h.hostgroup_id, h.hostname, h.port}
+}
+
+// Equal reports whether every column of the hosts is the same, as in the
+// rows that RemoveHost removes. Two nil hosts are equal
+func (h *Host) Equal(other *Host) bool {
+	if h == nil || other == nil {
+		return h == other
+	}
+	return *h == *other
+}
+
+// Clone returns a copy of the host
+func (h *Host) Clone() *Host {
+	c := *h
+	return &c
+}
+
+// Diff returns the columns whose values differ in other, in the order of
+// mysql_servers' columns, or nil if the hosts are equal
+func (h *Host) Diff(other *Host) []FieldDiff {
+	old := reflect.ValueOf(rowFromHost(h)).Elem()
+	updated := reflect.ValueOf(rowFromHost(other)).Elem()
+	var diffs []FieldDiff
+	for _, column := range serverColumns {
+		o, n := old.FieldByIndex(column.index).Interface(), updated.FieldByIndex(column.index).Interface()
+		if o != n {
+			diffs = append(diffs, FieldDiff{column.name, o, n})
+		}
+	}
+	return diffs
 }
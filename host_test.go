@@ -1,6 +1,8 @@
 package proxysql
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -131,7 +133,55 @@ func TestWhere(t *testing.T) {
 }
 
 func TestValid(t *testing.T) {
-	if DefaultHost().SetHostname("hn").SetPort(-1).Valid() != ErrConfigBadPort {
+	if !errors.Is(DefaultHost().SetHostname("hn").SetPort(-1).Valid(), ErrConfigBadPort) {
 		t.Fatal("host valid did not error expectedly")
 	}
 }
+
+func TestAssignments(t *testing.T) {
+	h := DefaultHost().SetHostname("hn").SetPort(3307).SetHostgroupID(1)
+	s := h.assignments()
+	t.Logf("string built: %s", s)
+	if s != "hostgroup_id = 1, hostname = 'hn', port = 3307, status = 'ONLINE', weight = 1, compression = 0, max_connections = 1000, max_replication_lag = 0, use_ssl = 0, max_latency_ms = 0, comment = ''" {
+		t.Fatalf("string from host.assignments was not expected: %s", s)
+	}
+}
+
+func TestKeyEqualClone(t *testing.T) {
+	h := DefaultHost().SetHostname("db-1").SetHostgroupID(2).SetPort(3307)
+	if h.Key() != (HostKey{2, "db-1", 3307}) || h.Key().String() != "db-1:3307 in hostgroup 2" {
+		t.Fatalf("unexpected key: %v", h.Key())
+	}
+	c := h.Clone()
+	if c == h || !c.Equal(h) {
+		t.Fatalf("clone was not an equal copy: %v", c)
+	}
+	c.SetWeight(5)
+	if c.Equal(h) || c.Key() != h.Key() || h.Weight() != 1 {
+		t.Fatalf("changing the clone changed the host, or the key changed: %v, %v", c, h)
+	}
+	var none *Host
+	if !none.Equal(nil) || none.Equal(h) || h.Equal(nil) {
+		t.Fatalf("nil hosts compared wrongly")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	h := DefaultHost().SetHostname("db-1")
+	if d := h.Diff(h.Clone()); d != nil {
+		t.Fatalf("equal hosts had a diff: %v", d)
+	}
+	updated := h.Clone().SetStatus("SHUNNED").SetWeight(10).SetComment("draining")
+	expected := []FieldDiff{
+		{"status", "ONLINE", "SHUNNED"},
+		{"weight", 1, 10},
+		{"comment", "", "draining"},
+	}
+	d := h.Diff(updated)
+	if !reflect.DeepEqual(d, expected) {
+		t.Fatalf("unexpected diff: %v", d)
+	}
+	if d[1].String() != "weight: 1 -> 10" {
+		t.Fatalf("unexpected diff string: %s", d[1])
+	}
+}
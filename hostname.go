@@ -0,0 +1,116 @@
+package proxysql
+
+// this file is for validating hostnames before they are written
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// HostnameValidator checks the hostname of a host that is being written.
+// Errors that are not ErrConfigBadHostname are reported as the rule that the
+// hostname broke, in a FieldError whose Err is ErrConfigBadHostname
+type HostnameValidator func(hostname string) error
+
+var (
+	hostnameValidatorMut sync.RWMutex
+	hostnameValidator    HostnameValidator = ValidateHostname
+)
+
+// labels of RFC 1123 names, like db-1
+var hostnameLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// the longest path of a unix socket, leaving room for the terminating null
+const maxSocketPathLength = 107
+
+// SetHostnameValidator replaces the validation of the hostnames of hosts that
+// are added, and of hosts checked with Host.Valid. Passing nil restores
+// ValidateHostname. Teams can enforce naming conventions on top of it:
+//
+//	SetHostnameValidator(func(hostname string) error {
+//	  if err := ValidateHostname(hostname); err != nil {
+//	    return err
+//	  }
+//	  if !strings.HasSuffix(hostname, ".db.internal") {
+//	    return errors.New("must end in .db.internal")
+//	  }
+//	  return nil
+//	})
+//
+// Unix sockets must have port 0 whatever the validator
+func SetHostnameValidator(v HostnameValidator) {
+	hostnameValidatorMut.Lock()
+	defer hostnameValidatorMut.Unlock()
+	if v == nil {
+		v = ValidateHostname
+	}
+	hostnameValidator = v
+}
+
+// ValidateHostname accepts IPv4 and IPv6 addresses, RFC 1123 DNS names, and
+// absolute paths to unix sockets.
+// This will return ErrConfigNoHostname for an empty hostname, and
+// ErrConfigBadHostname for anything else it does not accept
+func ValidateHostname(hostname string) error {
+	switch {
+	case hostname == "":
+		return ErrConfigNoHostname
+	case isSocketPath(hostname):
+		if len(hostname) > maxSocketPathLength || strings.ContainsAny(hostname, "\x00 \t\r\n") {
+			return ErrConfigBadHostname
+		}
+		return nil
+	case strings.Contains(hostname, ":"):
+		// IPv6, as ProxySQL expects it without brackets
+		if net.ParseIP(hostname) == nil {
+			return ErrConfigBadHostname
+		}
+		return nil
+	case strings.Trim(hostname, "0123456789.") == "":
+		// a name of only digits and dots must be an IPv4 address
+		if net.ParseIP(hostname) == nil {
+			return ErrConfigBadHostname
+		}
+		return nil
+	}
+	name := strings.TrimSuffix(hostname, ".")
+	if len(name) > 253 {
+		return ErrConfigBadHostname
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !hostnameLabelPattern.MatchString(label) {
+			return ErrConfigBadHostname
+		}
+	}
+	return nil
+}
+
+func isSocketPath(hostname string) bool {
+	return strings.HasPrefix(hostname, "/")
+}
+
+// This is called when hosts are written, and checks a hostname that is set
+// with the hostname validator. Unix sockets must have port 0
+func validateHostnameFormat(opts *hostQuery) error {
+	hostname := opts.host.hostname
+	if hostname == "" {
+		return nil
+	}
+	invalid := &ValidationError{}
+	hostnameValidatorMut.RLock()
+	err := hostnameValidator(hostname)
+	hostnameValidatorMut.RUnlock()
+	switch {
+	case err == nil:
+	case err == ErrConfigBadHostname || err == ErrConfigNoHostname:
+		invalid.add(invalidField("hostname", hostname, err))
+	default:
+		invalid.add(&FieldError{Field: "hostname", Value: hostname, Rule: err.Error(), Err: ErrConfigBadHostname})
+	}
+	if isSocketPath(hostname) && opts.host.port != 0 {
+		invalid.add(invalidField("port", opts.host.port, ErrConfigBadSocketPort))
+	}
+	return invalid.err()
+}
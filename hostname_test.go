@@ -0,0 +1,91 @@
+package proxysql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateHostnameFormats(t *testing.T) {
+	valid := []string{
+		"db-1", "db-1.db.internal", "DB-3", "localhost", "db.example.com.",
+		"10.0.0.1", "::1", "fe80::1", "2001:db8::8a2e:370:7334", "::ffff:10.0.0.1",
+		"/var/lib/mysql/mysql.sock", "1db", strings.Repeat("a", 63) + ".com",
+	}
+	for _, hostname := range valid {
+		if err := ValidateHostname(hostname); err != nil {
+			t.Errorf("%q was rejected: %v", hostname, err)
+		}
+	}
+	invalid := []string{
+		"db 1", " db-1", "db-1\n", "mysql://db-1", "db-1:3306", "[::1]", "10.0.0.256",
+		"10.0.0", "-db", "db-", "db..internal", "db_1", strings.Repeat("a", 64) + ".com",
+		strings.Repeat("a.", 127) + "aa", "/tmp/my sock", "/" + strings.Repeat("s", maxSocketPathLength),
+		"::g", "db/1",
+	}
+	for _, hostname := range invalid {
+		if err := ValidateHostname(hostname); err != ErrConfigBadHostname {
+			t.Errorf("%q was not rejected: %v", hostname, err)
+		}
+	}
+	if err := ValidateHostname(""); err != ErrConfigNoHostname {
+		t.Errorf("empty hostname was not rejected: %v", err)
+	}
+}
+
+func TestHostnameValidationOnWrites(t *testing.T) {
+	conn := shortSetup(t)
+	err := conn.AddHost(Hostname("db-1:3306"))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Fields) != 1 || invalid.Fields[0].Value != "db-1:3306" || !errors.Is(err, ErrConfigBadHostname) {
+		t.Fatalf("bad hostname was not rejected: %v", err)
+	}
+	if err := DefaultHost().SetHostname("bad host").Valid(); !errors.Is(err, ErrConfigBadHostname) {
+		t.Fatalf("bad hostname was valid: %v", err)
+	}
+	if err := DefaultHost().SetPort(1).Valid(); !errors.Is(err, ErrConfigNoHostname) {
+		t.Fatalf("empty hostname was valid: %v", err)
+	}
+	if err := conn.AddHosts(DefaultHost().SetPort(1)); !errors.Is(err, ErrConfigNoHostname) {
+		t.Fatalf("host with an empty hostname was added: %v", err)
+	}
+	// sockets must have port 0
+	socket := DefaultHost().SetHostname("/tmp/proxysql.sock")
+	if err := socket.Valid(); !errors.Is(err, ErrConfigBadSocketPort) || errors.Is(err, ErrConfigBadHostname) {
+		t.Fatalf("socket with a port was valid: %v", err)
+	}
+	if err := socket.SetPort(0).Valid(); err != nil {
+		t.Fatalf("socket was not valid: %v", err)
+	}
+	// reads are not validated, so that existing hosts can still be found
+	if _, err := buildAndParseHostQuery(Hostname("bad host")); err != nil {
+		t.Fatalf("bad hostname was rejected for a read: %v", err)
+	}
+}
+
+func TestSetHostnameValidator(t *testing.T) {
+	defer SetHostnameValidator(nil)
+	SetHostnameValidator(func(hostname string) error {
+		if err := ValidateHostname(hostname); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(hostname, ".db.internal") {
+			return errors.New("must end in .db.internal")
+		}
+		return nil
+	})
+	if err := DefaultHost().SetHostname("db-1.db.internal").Valid(); err != nil {
+		t.Fatalf("hostname was rejected: %v", err)
+	}
+	err := DefaultHost().SetHostname("db-1").Valid()
+	if !errors.Is(err, ErrConfigBadHostname) || err.Error() != `invalid configuration: hostname "db-1": must end in .db.internal` {
+		t.Fatalf("hostname was not rejected by the validator: %v", err)
+	}
+	if err := DefaultHost().SetHostname("db 1.db.internal").Valid(); !errors.Is(err, ErrConfigBadHostname) {
+		t.Fatalf("hostname was not rejected by the built in validation: %v", err)
+	}
+	SetHostnameValidator(nil)
+	if err := DefaultHost().SetHostname("db-1").Valid(); err != nil {
+		t.Fatalf("default validation was not restored: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package proxysql
+
+// this file is for set operations on lists of hosts
+
+// Hosts is a list of hosts, such as All and HostsLike return, with set
+// operations on it. A []*Host can be used wherever Hosts is expected.
+//
+// The operations ending in ByKey compare hosts by Host.Key, so that they
+// work on servers, and the others compare them with Host.Equal, so that they
+// work on rows. The hosts returned keep the order of the lists they came
+// from, and are not copied
+type Hosts []*Host
+
+// Keys returns the key of each host
+func (hs Hosts) Keys() []HostKey {
+	keys := make([]HostKey, len(hs))
+	for i, h := range hs {
+		keys[i] = h.Key()
+	}
+	return keys
+}
+
+// Find returns the first host with the key, or nil if there is none
+func (hs Hosts) Find(key HostKey) *Host {
+	for _, h := range hs {
+		if h.Key() == key {
+			return h
+		}
+	}
+	return nil
+}
+
+// Contains reports whether a host equal to host is in the list
+func (hs Hosts) Contains(host *Host) bool {
+	for _, h := range hs {
+		if h.Equal(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns copies of the hosts
+func (hs Hosts) Clone() Hosts {
+	if hs == nil {
+		return nil
+	}
+	cloned := make(Hosts, len(hs))
+	for i, h := range hs {
+		cloned[i] = h.Clone()
+	}
+	return cloned
+}
+
+// Equal reports whether the lists have equal hosts in the same order
+func (hs Hosts) Equal(other Hosts) bool {
+	if len(hs) != len(other) {
+		return false
+	}
+	for i := range hs {
+		if !hs[i].Equal(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// UnionByKey returns the hosts in hs, followed by those in other whose key is
+// not in hs. Hosts with the same key as an earlier host are left out
+func (hs Hosts) UnionByKey(other Hosts) Hosts {
+	return union(hs, other, keyOf)
+}
+
+// IntersectByKey returns the hosts in hs whose key is in other
+func (hs Hosts) IntersectByKey(other Hosts) Hosts {
+	return filterBy(hs, other, keyOf, true)
+}
+
+// SubtractByKey returns the hosts in hs whose key is not in other
+func (hs Hosts) SubtractByKey(other Hosts) Hosts {
+	return filterBy(hs, other, keyOf, false)
+}
+
+// Union returns the hosts in hs, followed by those in other that are not
+// equal to a host in hs. Hosts equal to an earlier host are left out
+func (hs Hosts) Union(other Hosts) Hosts {
+	return union(hs, other, rowOf)
+}
+
+// Intersect returns the hosts in hs that are equal to a host in other
+func (hs Hosts) Intersect(other Hosts) Hosts {
+	return filterBy(hs, other, rowOf, true)
+}
+
+// Subtract returns the hosts in hs that are not equal to any host in other
+func (hs Hosts) Subtract(other Hosts) Hosts {
+	return filterBy(hs, other, rowOf, false)
+}
+
+// Hosts compare as keys or as whole rows. Host is a comparable struct, so a
+// dereferenced host is its row
+func keyOf(h *Host) interface{} { return h.Key() }
+func rowOf(h *Host) interface{} { return *h }
+
+func union(a, b Hosts, identity func(*Host) interface{}) Hosts {
+	seen := make(map[interface{}]bool, len(a)+len(b))
+	result := make(Hosts, 0, len(a)+len(b))
+	for _, hosts := range []Hosts{a, b} {
+		for _, h := range hosts {
+			if id := identity(h); !seen[id] {
+				seen[id] = true
+				result = append(result, h)
+			}
+		}
+	}
+	return result
+}
+
+// filterBy returns the hosts in a that are in b if keep is true, or not in b
+// if it is false
+func filterBy(a, b Hosts, identity func(*Host) interface{}, keep bool) Hosts {
+	in := make(map[interface{}]bool, len(b))
+	for _, h := range b {
+		in[identity(h)] = true
+	}
+	result := make(Hosts, 0, len(a))
+	for _, h := range a {
+		if in[identity(h)] == keep {
+			result = append(result, h)
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package proxysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHostsSetOperations(t *testing.T) {
+	a := DefaultHost().SetHostname("a")
+	b := DefaultHost().SetHostname("b")
+	c := DefaultHost().SetHostname("c")
+	// the same server as b, with a different weight
+	b2 := b.Clone().SetWeight(10)
+	current := []*Host{a, b}
+	desired := []*Host{b2, c}
+
+	tests := []struct {
+		name     string
+		got      Hosts
+		expected Hosts
+	}{
+		{"UnionByKey", Hosts(current).UnionByKey(desired), Hosts{a, b, c}},
+		{"IntersectByKey", Hosts(current).IntersectByKey(desired), Hosts{b}},
+		{"SubtractByKey", Hosts(current).SubtractByKey(desired), Hosts{a}},
+		{"SubtractByKey desired", Hosts(desired).SubtractByKey(current), Hosts{c}},
+		{"Union", Hosts(current).Union(desired), Hosts{a, b, b2, c}},
+		{"Intersect", Hosts(current).Intersect(desired), Hosts{}},
+		{"Subtract", Hosts(current).Subtract(desired), Hosts{a, b}},
+		{"Intersect copies", Hosts(current).Intersect(Hosts{b.Clone()}), Hosts{b}},
+		{"Union duplicates", Hosts{a, a.Clone()}.Union(nil), Hosts{a}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, test.got)
+		}
+	}
+	// results are the same hosts, not copies
+	if Hosts(current).SubtractByKey(desired)[0] != a {
+		t.Errorf("set operation copied hosts")
+	}
+}
+
+func TestHostsLookups(t *testing.T) {
+	a := DefaultHost().SetHostname("a")
+	b := DefaultHost().SetHostname("b").SetHostgroupID(1)
+	hosts := Hosts{a, b}
+	if !reflect.DeepEqual(hosts.Keys(), []HostKey{{0, "a", 3306}, {1, "b", 3306}}) {
+		t.Fatalf("unexpected keys: %v", hosts.Keys())
+	}
+	if hosts.Find(HostKey{1, "b", 3306}) != b || hosts.Find(HostKey{0, "b", 3306}) != nil {
+		t.Fatalf("find returned the wrong host")
+	}
+	if !hosts.Contains(b.Clone()) || hosts.Contains(b.Clone().SetWeight(2)) {
+		t.Fatalf("contains compared wrongly")
+	}
+	cloned := hosts.Clone()
+	if !cloned.Equal(hosts) || cloned[0] == a || cloned.Equal(hosts[:1]) {
+		t.Fatalf("clone was not an equal copy: %v", cloned)
+	}
+	if Hosts(nil).Clone() != nil {
+		t.Fatalf("clone of nil was not nil")
+	}
+}
+
+func TestHostsWithClient(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	desired := filterHosts()
+	if err := conn.AddHosts(desired[:3]...); err != nil {
+		t.Fatalf("could not add hosts: %v", err)
+	}
+	current, err := conn.All()
+	if err != nil {
+		t.Fatalf("could not read hosts: %v", err)
+	}
+	missing := Hosts(desired).Subtract(current)
+	if !missing.Equal(desired[3:]) {
+		t.Fatalf("unexpected missing hosts: %v", missing)
+	}
+}
@@ -0,0 +1,120 @@
+package proxysql
+
+// this file is for the exported, serializable form of a host
+
+import (
+	"encoding/json"
+)
+
+// HostSpec is a row in ProxySQL's mysql_servers config table with exported
+// fields, for building hosts with struct literals and reading them from JSON
+// or YAML. Fields missing from JSON or YAML take the values of DefaultHost.
+// Decoding validates the host with Host.Valid. Encoding does not, so that
+// hosts read from ProxySQL can be encoded whatever they hold
+type HostSpec struct {
+	HostgroupID       int    `json:"hostgroup_id" yaml:"hostgroup_id"`
+	Hostname          string `json:"hostname" yaml:"hostname"`
+	Port              int    `json:"port" yaml:"port"`
+	Status            string `json:"status" yaml:"status"`
+	Weight            int    `json:"weight" yaml:"weight"`
+	Compression       int    `json:"compression" yaml:"compression"`
+	MaxConnections    int    `json:"max_connections" yaml:"max_connections"`
+	MaxReplicationLag int    `json:"max_replication_lag" yaml:"max_replication_lag"`
+	UseSSL            int    `json:"use_ssl" yaml:"use_ssl"`
+	MaxLatencyMS      int    `json:"max_latency_ms" yaml:"max_latency_ms"`
+	Comment           string `json:"comment" yaml:"comment"`
+}
+
+// hostSpec has the fields of HostSpec without its methods, so that it can be
+// encoded and decoded without recursing
+type hostSpec HostSpec
+
+// DefaultHostSpec returns the spec of DefaultHost
+func DefaultHostSpec() HostSpec {
+	return DefaultHost().Spec()
+}
+
+// Spec returns the host as a HostSpec
+func (h *Host) Spec() HostSpec {
+	return HostSpec{h.hostgroup_id, h.hostname, h.port, h.status, h.weight, h.compression, h.max_connections, h.max_replication_lag, h.use_ssl, h.max_latency_ms, h.comment}
+}
+
+// Host returns the spec as a *Host. The host is not validated
+func (s HostSpec) Host() *Host {
+	return &Host{s.HostgroupID, s.Hostname, s.Port, s.Status, s.Weight, s.Compression, s.MaxConnections, s.MaxReplicationLag, s.UseSSL, s.MaxLatencyMS, s.Comment}
+}
+
+// Valid returns the error from Host.Valid for the spec's host
+func (s HostSpec) Valid() error {
+	return s.Host().Valid()
+}
+
+// MarshalJSON encodes the spec. It is not validated
+func (s HostSpec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hostSpec(s))
+}
+
+// UnmarshalJSON decodes a spec, filling in missing fields from DefaultHost.
+// This will return errors from json.Unmarshal and Host.Valid
+func (s *HostSpec) UnmarshalJSON(data []byte) error {
+	return s.decode(func(v interface{}) error {
+		return json.Unmarshal(data, v)
+	})
+}
+
+// MarshalYAML encodes the spec. It is not validated. This works with
+// gopkg.in/yaml.v2 and gopkg.in/yaml.v3
+func (s HostSpec) MarshalYAML() (interface{}, error) {
+	return hostSpec(s), nil
+}
+
+// UnmarshalYAML decodes a spec, filling in missing fields from DefaultHost.
+// This works with gopkg.in/yaml.v2 and gopkg.in/yaml.v3.
+// This will return errors from unmarshal and Host.Valid
+func (s *HostSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return s.decode(unmarshal)
+}
+
+func (s *HostSpec) decode(unmarshal func(interface{}) error) error {
+	decoded := hostSpec(DefaultHostSpec())
+	if err := unmarshal(&decoded); err != nil {
+		return err
+	}
+	if err := HostSpec(decoded).Valid(); err != nil {
+		return err
+	}
+	*s = HostSpec(decoded)
+	return nil
+}
+
+// MarshalJSON encodes the host as its HostSpec. It is not validated
+func (h *Host) MarshalJSON() ([]byte, error) {
+	return h.Spec().MarshalJSON()
+}
+
+// UnmarshalJSON decodes a host from its HostSpec.
+// This will return errors from json.Unmarshal and Host.Valid
+func (h *Host) UnmarshalJSON(data []byte) error {
+	var s HostSpec
+	if err := s.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*h = *s.Host()
+	return nil
+}
+
+// MarshalYAML encodes the host as its HostSpec. It is not validated
+func (h *Host) MarshalYAML() (interface{}, error) {
+	return h.Spec().MarshalYAML()
+}
+
+// UnmarshalYAML decodes a host from its HostSpec.
+// This will return errors from unmarshal and Host.Valid
+func (h *Host) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s HostSpec
+	if err := s.UnmarshalYAML(unmarshal); err != nil {
+		return err
+	}
+	*h = *s.Host()
+	return nil
+}
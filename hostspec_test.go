@@ -0,0 +1,108 @@
+package proxysql
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHostSpecConversions(t *testing.T) {
+	host := DefaultHost().SetHostname("db-1").SetHostgroupID(2).SetPort(3307).SetComment("primary")
+	spec := host.Spec()
+	expected := HostSpec{HostgroupID: 2, Hostname: "db-1", Port: 3307, Status: "ONLINE", Weight: 1, MaxConnections: 1000, Comment: "primary"}
+	if spec != expected {
+		t.Fatalf("unexpected spec: %+v", spec)
+	}
+	if !reflect.DeepEqual(spec.Host(), host) {
+		t.Fatalf("spec did not convert back to the host: %v", spec.Host())
+	}
+}
+
+func TestHostJSONRoundTrip(t *testing.T) {
+	host := DefaultHost().SetHostname("db-1").SetHostgroupID(2).SetWeight(10)
+	data, err := json.Marshal(host)
+	if err != nil {
+		t.Fatalf("could not marshal host: %v", err)
+	}
+	expected := `{"hostgroup_id":2,"hostname":"db-1","port":3306,"status":"ONLINE","weight":10,"compression":0,"max_connections":1000,"max_replication_lag":0,"use_ssl":0,"max_latency_ms":0,"comment":""}`
+	if string(data) != expected {
+		t.Fatalf("unexpected json: %s", data)
+	}
+	decoded := new(Host)
+	if err := json.Unmarshal(data, decoded); err != nil || !reflect.DeepEqual(decoded, host) {
+		t.Fatalf("unexpected host: %v, %v", decoded, err)
+	}
+}
+
+func TestHostSpecJSONDefaultsAndValidation(t *testing.T) {
+	var config struct {
+		Hosts []HostSpec `json:"hosts"`
+	}
+	if err := json.Unmarshal([]byte(`{"hosts": [{"hostname": "db-1"}, {"hostname": "db-2", "port": 3307, "status": "SHUNNED"}]}`), &config); err != nil {
+		t.Fatalf("could not unmarshal specs: %v", err)
+	}
+	expected := []HostSpec{DefaultHostSpec(), DefaultHostSpec()}
+	expected[0].Hostname = "db-1"
+	expected[1].Hostname, expected[1].Port, expected[1].Status = "db-2", 3307, "SHUNNED"
+	if !reflect.DeepEqual(config.Hosts, expected) {
+		t.Fatalf("unexpected specs: %+v", config.Hosts)
+	}
+	invalid := []struct {
+		json string
+		err  error
+	}{
+		{`{"hostname": "db-1", "port": 70000}`, ErrConfigBadPort},
+		{`{"hostname": "db-1", "status": "UP"}`, ErrConfigBadStatus},
+		{`{"hostname": "db-1", "use_ssl": 2}`, ErrConfigBadUseSSL},
+	}
+	for _, test := range invalid {
+		spec := DefaultHostSpec()
+		if err := json.Unmarshal([]byte(test.json), &spec); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.json, test.err, err)
+		}
+		if spec != DefaultHostSpec() {
+			t.Errorf("%s: spec was changed by a failed unmarshal: %+v", test.json, spec)
+		}
+		var host Host
+		if err := json.Unmarshal([]byte(test.json), &host); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v from host, got %v", test.json, test.err, err)
+		}
+	}
+	// hosts read from ProxySQL may not pass validation, but can be encoded
+	data, err := json.Marshal(DefaultHost().SetHostname("db_1"))
+	if err != nil || !strings.Contains(string(data), `"hostname":"db_1"`) {
+		t.Fatalf("could not marshal host read from ProxySQL: %s, %v", data, err)
+	}
+}
+
+// yaml packages call UnmarshalYAML with a func that decodes into its
+// argument, which json stands in for here
+func TestHostYAML(t *testing.T) {
+	unmarshal := func(data string) func(interface{}) error {
+		return func(v interface{}) error {
+			return json.Unmarshal([]byte(data), v)
+		}
+	}
+	var host Host
+	if err := host.UnmarshalYAML(unmarshal(`{"hostname": "db-1", "hostgroup_id": 3}`)); err != nil {
+		t.Fatalf("could not unmarshal host: %v", err)
+	}
+	if !reflect.DeepEqual(&host, DefaultHost().SetHostname("db-1").SetHostgroupID(3)) {
+		t.Fatalf("unexpected host: %v", host)
+	}
+	if err := host.UnmarshalYAML(unmarshal(`{"hostname": "db-1", "weight": -1}`)); !errors.Is(err, ErrConfigBadWeight) {
+		t.Fatalf("invalid host was unmarshalled: %v", err)
+	}
+	value, err := host.MarshalYAML()
+	if err != nil {
+		t.Fatalf("could not marshal host: %v", err)
+	}
+	if spec, ok := value.(hostSpec); !ok || HostSpec(spec) != host.Spec() {
+		t.Fatalf("unexpected yaml value: %#v", value)
+	}
+	if _, err := host.SetHostname("db_1").MarshalYAML(); err != nil {
+		t.Fatalf("could not marshal host read from ProxySQL: %v", err)
+	}
+}
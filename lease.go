@@ -0,0 +1,247 @@
+package proxysql
+
+// this file is for leases on hosts, which expire unless the hosts are
+// registered again, and for reaping the hosts whose leases expired
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The keys of a lease in the metadata of a host's comment
+const (
+	// LeaseTTLKey is how long the lease lasts, like 30s
+	LeaseTTLKey = "ttl"
+	// LeaseSeenKey is when the host was last registered, in RFC 3339
+	LeaseSeenKey = "seen"
+)
+
+// Lease returns how long the host's lease lasts, and when it was last
+// registered, from the metadata of its comment. ok is false if the host has
+// no lease
+func (h *Host) Lease() (ttl time.Duration, seen time.Time, ok bool) {
+	_, meta := ParseComment(h.comment)
+	ttl, err := time.ParseDuration(meta[LeaseTTLKey])
+	if err != nil || ttl <= 0 {
+		return 0, time.Time{}, false
+	}
+	seen, err = time.Parse(time.RFC3339, meta[LeaseSeenKey])
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return ttl, seen, true
+}
+
+// SetLease sets the lease in the metadata of the host's comment, keeping the
+// rest of the comment
+func (h *Host) SetLease(ttl time.Duration, seen time.Time) *Host {
+	return h.SetMeta(LeaseTTLKey, ttl.String()).SetMeta(LeaseSeenKey, seen.UTC().Format(time.RFC3339))
+}
+
+// Register inserts each of the hosts into mysql_servers with a lease of ttl,
+// or if a host with its key is there, updates it to the host and renews its
+// lease. Hosts whose lease expires are taken offline and removed by a
+// Reaper, unless they are registered again first. Call this more often than
+// ttl for each host that is still alive. A host that was taken offline gets
+// the status given again.
+// This will return a *HostError if a host is not valid, like one without a
+// hostname (ErrConfigNoHostname), or its statements fail, and
+// ErrConfigBadTTL if ttl is not positive
+func (p *ProxySQL) Register(ttl time.Duration, hosts ...*Host) error {
+	return p.RegisterContext(context.Background(), ttl, hosts...)
+}
+
+// RegisterContext is Register with a context
+func (p *ProxySQL) RegisterContext(ctx context.Context, ttl time.Duration, hosts ...*Host) (err error) {
+	op := p.begin(ctx, "Register")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, "mysql_servers"}, Attribute{AttributeRows, int64(len(hosts))})
+	if ttl <= 0 {
+		return invalidField(LeaseTTLKey, ttl.String(), ErrConfigBadTTL)
+	}
+	for i, host := range hosts {
+		if err := host.Valid(); err != nil {
+			return &HostError{Host: host, Index: i, Err: err}
+		}
+	}
+	op.param("ttl", ttl.String())
+	op.param("hosts", rowsFromHosts(hosts))
+	defer op.lockThroughout()()
+	// leases are kept to the second, as they are written
+	seen := time.Now().Truncate(time.Second)
+	table := servers(p, "mysql_servers")
+	for i, host := range hosts {
+		row := rowFromHost(host.Clone().SetLease(ttl, seen))
+		key := host.Key()
+		where := fmt.Sprintf("hostgroup_id = %d and hostname = %s and port = %d", key.HostgroupID, quote(key.Hostname), key.Port)
+		n, err := table.exec(op.ctx, fmt.Sprintf("update mysql_servers set %s where %s", table.assignments(row), where))
+		if err == nil && n == 0 {
+			_, err = table.insert(op.ctx, []*serverRow{row})
+		}
+		if err != nil {
+			return &HostError{Host: host, Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// Register registers copies of the hosts owned by the client, as
+// ProxySQL.Register does
+func (c *OwnedClient) Register(ttl time.Duration, hosts ...*Host) error {
+	return c.RegisterContext(context.Background(), ttl, hosts...)
+}
+
+// RegisterContext is Register with a context
+func (c *OwnedClient) RegisterContext(ctx context.Context, ttl time.Duration, hosts ...*Host) error {
+	owned := Hosts(hosts).Clone()
+	for _, host := range owned {
+		host.SetOwner(c.owner)
+	}
+	return c.p.RegisterContext(ctx, ttl, owned...)
+}
+
+// Reaped is what Reap changed
+type Reaped struct {
+	// Offline are the hosts whose leases expired, and that were set to
+	// OFFLINE_SOFT, as they were before
+	Offline Hosts
+	// Removed are the hosts whose leases expired more than the grace period
+	// ago, and that were removed
+	Removed Hosts
+}
+
+// Reaper takes the hosts whose leases expired offline, and removes them once
+// the grace period after their lease has passed, so that ProxySQL stops
+// sending new connections to them, and then forgets them. Build one with
+// ProxySQL.NewReaper, and Close it when it is no longer needed
+type Reaper struct {
+	p        *ProxySQL
+	interval time.Duration
+	grace    time.Duration
+	scope    []HostOpts
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	stopped   chan struct{}
+}
+
+// NewReaper returns a Reaper that calls Reap every interval, until it is
+// closed. Only hosts in mysql_servers that match the scope are reaped, such
+// as Where(OwnedBy("orders")), and with no scope every host with a lease is.
+// Errors from reaping are logged to the client's logger, if it has one.
+// This will return a validation error if interval is not positive, grace is
+// negative, or the scope gives Table or Limit (ErrPlanBadScope)
+func (p *ProxySQL) NewReaper(interval, grace time.Duration, scope ...HostOpts) (*Reaper, error) {
+	invalid := &ValidationError{}
+	if interval <= 0 {
+		invalid.add(invalidField("interval", interval.String(), ErrConfigBadInterval))
+	}
+	if grace < 0 {
+		invalid.add(invalidField("grace", grace.String(), ErrConfigBadGrace))
+	}
+	if hostq, err := buildAndParseHostQuery(scope...); err != nil {
+		return nil, err
+	} else if hostq.table != "mysql_servers" || hostq.limited() {
+		invalid.add(invalidField("scope", nil, ErrPlanBadScope))
+	}
+	if err := invalid.err(); err != nil {
+		return nil, err
+	}
+	r := &Reaper{
+		p:        p,
+		interval: interval,
+		grace:    grace,
+		scope:    scope,
+		closing:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Close stops the reaper, and waits for a Reap that is running to finish
+func (r *Reaper) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closing)
+	})
+	<-r.stopped
+}
+
+func (r *Reaper) run() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.closing:
+			return
+		}
+		_, err := r.Reap()
+		if logger := r.p.log(); err != nil && logger != nil {
+			logger.LogAttrs(context.Background(), slog.LevelError, "proxysql reap failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Reap sets the hosts in the scope whose leases expired to OFFLINE_SOFT, and
+// removes those whose leases expired more than the grace period ago, in one
+// ChangeSet, which persists the changes. A host that is registered again
+// while it is reaped is left as it is, and not reported in Reaped. Hosts
+// without a lease are never reaped. In dry run mode, Reaped has the hosts
+// that would be reaped.
+// This propagates errors from HostsLike and ChangeSet.Apply
+func (r *Reaper) Reap() (*Reaped, error) {
+	return r.ReapContext(context.Background())
+}
+
+// ReapContext is Reap with a context
+func (r *Reaper) ReapContext(ctx context.Context) (reaped *Reaped, err error) {
+	op := r.p.begin(ctx, "Reap")
+	defer op.end(&err)
+	opts := append(r.scope[:len(r.scope):len(r.scope)], Where(Like("comment", "%"+commentMarker+"{%\""+LeaseTTLKey+"\":%")))
+	hosts, err := r.p.HostsLikeContext(op.ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	reaped = &Reaped{}
+	changes := r.p.NewChangeSet()
+	// the statements only match the rows as they were read, so a host that
+	// was registered again is not changed, and is reported only if its
+	// statement changed a row
+	reap := func(host *Host, query string, report *Hosts) {
+		changes.add("mysql_servers", func(ctx context.Context, p *ProxySQL) error {
+			n, err := affected(execRetrying(ctx, p, query, nil))
+			if err != nil {
+				return opError("mysql_servers", query, err)
+			}
+			if n > 0 || dryRunning(ctx, p) {
+				*report = append(*report, host)
+			}
+			return nil
+		})
+	}
+	for _, host := range hosts {
+		ttl, seen, ok := host.Lease()
+		expiry := seen.Add(ttl)
+		switch {
+		case !ok || now.Before(expiry):
+		case now.After(expiry.Add(r.grace)):
+			reap(host, fmt.Sprintf("delete from mysql_servers where %s", host.where()), &reaped.Removed)
+		case host.Status() != "OFFLINE_SOFT" && host.Status() != "OFFLINE_HARD":
+			// only the status is written, so rows that would not pass
+			// validation now, like those added by hand, are still taken
+			// offline
+			reap(host, fmt.Sprintf("update mysql_servers set status = 'OFFLINE_SOFT' where %s", host.where()), &reaped.Offline)
+		}
+	}
+	op.annotate(Attribute{AttributeRows, int64(changes.Len())})
+	if err := changes.ApplyContext(op.ctx); err != nil {
+		return nil, err
+	}
+	return reaped, nil
+}
@@ -0,0 +1,208 @@
+package proxysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterRenewsLease(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	host := DefaultHost().SetHostname("worker").SetComment("primary")
+	if err := conn.Register(time.Minute, host); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	hosts, _ := conn.HostsLike(Hostname("worker"))
+	if len(hosts) != 1 {
+		t.Fatalf("expected one host, got %v", hosts)
+	}
+	ttl, seen, ok := hosts[0].Lease()
+	if !ok || ttl != time.Minute || time.Since(seen) > time.Minute {
+		t.Fatalf("unexpected lease: %v, %v, %v", ttl, seen, ok)
+	}
+	if text, _ := ParseComment(hosts[0].Comment()); text != "primary" {
+		t.Fatalf("comment was not kept: %q", hosts[0].Comment())
+	}
+	conn.Conn().Exec("update mysql_servers set status = 'OFFLINE_SOFT', comment = '' where hostname = 'worker'")
+	if err := conn.Register(time.Minute, host.Clone().SetWeight(5)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	hosts, _ = conn.HostsLike(Hostname("worker"))
+	if len(hosts) != 1 || hosts[0].Status() != "ONLINE" || hosts[0].Weight() != 5 {
+		t.Fatalf("host was not renewed: %v", hosts)
+	}
+	if _, _, ok := hosts[0].Lease(); !ok {
+		t.Fatalf("lease was not renewed: %q", hosts[0].Comment())
+	}
+}
+
+func TestRegisterValidates(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	if err := conn.Register(0, DefaultHost().SetHostname("a")); !errors.Is(err, ErrConfigBadTTL) {
+		t.Fatalf("expected ErrConfigBadTTL, got %v", err)
+	}
+	if err := conn.Register(time.Minute, DefaultHost()); !errors.Is(err, ErrConfigNoHostname) {
+		t.Fatalf("host without a hostname was registered: %v", err)
+	}
+	var hostErr *HostError
+	err := conn.Register(time.Minute, DefaultHost().SetHostname("a"), DefaultHost().SetHostname("b").SetStatus("bad"))
+	if !errors.As(err, &hostErr) || hostErr.Index != 1 {
+		t.Fatalf("expected a HostError for the second host, got %v", err)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 0 {
+		t.Fatalf("hosts were registered: %v", hosts)
+	}
+}
+
+func TestReap(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	now := time.Now()
+	conn.AddHosts(
+		DefaultHost().SetHostname("fresh").SetLease(time.Minute, now),
+		DefaultHost().SetHostname("expired").SetLease(time.Minute, now.Add(-2*time.Minute)),
+		DefaultHost().SetHostname("gone").SetLease(time.Minute, now.Add(-time.Hour)),
+		DefaultHost().SetHostname("static"),
+		DefaultHost().SetHostname("other").SetHostgroupID(2).SetLease(time.Minute, now.Add(-time.Hour)),
+	)
+	reaper, err := conn.NewReaper(time.Hour, 10*time.Minute, HostgroupID(0))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer reaper.Close()
+	before := countQueries(server.Queries(), "load mysql servers to runtime")
+	reaped, err := reaper.Reap()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(reaped.Offline) != 1 || reaped.Offline[0].Hostname() != "expired" {
+		t.Fatalf("unexpected offline hosts: %v", reaped.Offline)
+	}
+	if len(reaped.Removed) != 1 || reaped.Removed[0].Hostname() != "gone" {
+		t.Fatalf("unexpected removed hosts: %v", reaped.Removed)
+	}
+	if n := countQueries(server.Queries(), "load mysql servers to runtime") - before; n != 1 {
+		t.Fatalf("expected a single persist, got %d", n)
+	}
+	statuses := make(map[string]string)
+	hosts, _ := conn.All()
+	for _, host := range hosts {
+		statuses[host.Hostname()] = host.Status()
+	}
+	expected := map[string]string{"fresh": "ONLINE", "expired": "OFFLINE_SOFT", "static": "ONLINE", "other": "ONLINE"}
+	if len(statuses) != len(expected) {
+		t.Fatalf("unexpected hosts: %v", statuses)
+	}
+	for hostname, status := range expected {
+		if statuses[hostname] != status {
+			t.Fatalf("expected %s to be %s, got %v", hostname, status, statuses)
+		}
+	}
+	reaped, err = reaper.Reap()
+	if err != nil || len(reaped.Offline) != 0 || len(reaped.Removed) != 0 {
+		t.Fatalf("offline host was reaped again: %+v, %v", reaped, err)
+	}
+}
+
+func TestReapHostThatIsNotValid(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	lease := FormatComment("", CommentMeta{LeaseTTLKey: "1m", LeaseSeenKey: "2000-01-01T00:00:00Z"})
+	conn.Conn().Exec(fmt.Sprintf("insert into mysql_servers (hostname, comment) values ('db_1', %s)", quote(lease)))
+	reaper, err := conn.NewReaper(time.Hour, 100*365*24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer reaper.Close()
+	reaped, err := reaper.Reap()
+	if err != nil || len(reaped.Offline) != 1 {
+		t.Fatalf("host that is not valid was not reaped: %+v, %v", reaped, err)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 1 || hosts[0].Status() != "OFFLINE_SOFT" {
+		t.Fatalf("host was not taken offline: %v", hosts)
+	}
+}
+
+func TestReapReportsOnlyChangedHosts(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	defer resetHelpers()
+	expired := time.Now().Add(-2 * time.Minute)
+	conn.AddHosts(
+		DefaultHost().SetHostname("expired").SetLease(time.Minute, expired),
+		DefaultHost().SetHostname("again").SetLease(time.Minute, expired),
+	)
+	reaper, err := conn.NewReaper(time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer reaper.Close()
+	// again is registered after the reaper read it, before it is reaped
+	lease := FormatComment("", CommentMeta{LeaseTTLKey: "1m", LeaseSeenKey: time.Now().UTC().Format(time.RFC3339)})
+	run := exec
+	exec = func(ctx context.Context, p *ProxySQL, queryString string, args ...interface{}) (sql.Result, error) {
+		if strings.HasPrefix(queryString, "update mysql_servers set status") && strings.Contains(queryString, "'again'") {
+			if _, err := conn.Conn().Exec(fmt.Sprintf("update mysql_servers set comment = %s where hostname = 'again'", quote(lease))); err != nil {
+				return nil, err
+			}
+		}
+		return run(ctx, p, queryString, args...)
+	}
+	reaped, err := reaper.Reap()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(reaped.Offline) != 1 || reaped.Offline[0].Hostname() != "expired" {
+		t.Fatalf("unexpected offline hosts: %v", reaped.Offline)
+	}
+	statuses := make(map[string]string)
+	hosts, _ := conn.All()
+	for _, host := range hosts {
+		statuses[host.Hostname()] = host.Status()
+	}
+	if statuses["expired"] != "OFFLINE_SOFT" || statuses["again"] != "ONLINE" {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
+
+func TestReaperRunsUntilClosed(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.AddHost(Hostname("gone"), Comment(FormatComment("", CommentMeta{LeaseTTLKey: "1s", LeaseSeenKey: "2000-01-01T00:00:00Z"})))
+	reaper, err := conn.NewReaper(10*time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if hosts, _ := conn.All(); len(hosts) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reaper did not remove the expired host")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	reaper.Close()
+	reaper.Close()
+}
+
+func TestNewReaperValidates(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	if _, err := conn.NewReaper(0, 0); !errors.Is(err, ErrConfigBadInterval) {
+		t.Fatalf("expected ErrConfigBadInterval, got %v", err)
+	}
+	if _, err := conn.NewReaper(time.Second, -time.Second); !errors.Is(err, ErrConfigBadGrace) {
+		t.Fatalf("expected ErrConfigBadGrace, got %v", err)
+	}
+	if _, err := conn.NewReaper(time.Second, 0, Limit(1)); !errors.Is(err, ErrPlanBadScope) {
+		t.Fatalf("expected ErrPlanBadScope, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package proxysql
+
+// this file is for logging the statements that clients send
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// SetLogger logs every statement that the client sends to ProxySQL, with its
+// duration, the rows it changed, and its error. Statements that succeed are
+// logged at slog.LevelDebug, and those that fail at slog.LevelError.
+// Passwords, credentials and secrets in statements are redacted. Passing nil
+// stops logging.
+func (p *ProxySQL) SetLogger(logger *slog.Logger) {
+	p.settingsMut.Lock()
+	defer p.settingsMut.Unlock()
+	p.logger = logger
+}
+
+func (p *ProxySQL) log() *slog.Logger {
+	p.settingsMut.RLock()
+	defer p.settingsMut.RUnlock()
+	return p.logger
+}
+
+// execStatement runs a statement with the exec hook, or records it in dry run
+// mode, traces it, and logs it
+func execStatement(ctx context.Context, p *ProxySQL, statement string) (sql.Result, error) {
+	ctx, span := startStatement(ctx, p, statement)
+	start := time.Now()
+	var result sql.Result
+	var err error
+	if dryRunning(ctx, p) {
+		result = p.record(ctx, statement)
+	} else {
+		result, err = exec(ctx, p, statement)
+	}
+	duration := time.Since(start)
+	if o := operationOf(ctx); o != nil && err == nil {
+		o.ran(statement)
+	}
+	n, rowsErr := affected(result, err)
+	if err == nil && rowsErr == nil {
+		span.SetAttributes(Attribute{AttributeRows, n})
+	}
+	span.End(err)
+	if logger := p.log(); logger != nil {
+		attrs := []slog.Attr{slog.Duration("duration", duration)}
+		if err == nil && rowsErr == nil {
+			attrs = append(attrs, slog.Int64("rows", n))
+		}
+		logStatement(ctx, logger, statement, err, attrs)
+	}
+	return result, err
+}
+
+// queryStatement runs a query with the query hook, traces it, and logs it.
+// The span ends when the query returns, before its rows are read
+func queryStatement(ctx context.Context, p *ProxySQL, queryString string) (*sql.Rows, error) {
+	ctx, span := startStatement(ctx, p, queryString)
+	start := time.Now()
+	rows, err := query(ctx, p, queryString)
+	duration := time.Since(start)
+	span.End(err)
+	if logger := p.log(); logger != nil {
+		logStatement(ctx, logger, queryString, err, []slog.Attr{slog.Duration("duration", duration)})
+	}
+	return rows, err
+}
+
+func logStatement(ctx context.Context, logger *slog.Logger, statement string, err error, attrs []slog.Attr) {
+	attrs = append([]slog.Attr{slog.String("sql", redact(statement))}, attrs...)
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		logger.LogAttrs(ctx, slog.LevelError, "proxysql statement failed", attrs...)
+		return
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "proxysql statement", attrs...)
+}
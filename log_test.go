@@ -0,0 +1,85 @@
+package proxysql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type logLine struct {
+	Level    string  `json:"level"`
+	Msg      string  `json:"msg"`
+	SQL      string  `json:"sql"`
+	Duration float64 `json:"duration"`
+	Rows     *int64  `json:"rows"`
+	Error    string  `json:"error"`
+}
+
+func readLog(t *testing.T, buffer *bytes.Buffer) []logLine {
+	var lines []logLine
+	for _, raw := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var line logLine
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("bad log line %q: %v", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	buffer.Reset()
+	return lines
+}
+
+func TestSetLogger(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	var buffer bytes.Buffer
+	conn.SetLogger(slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	conn.AddHost(Hostname("db-1"))
+	conn.All()
+	lines := readLog(t, &buffer)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 statements to be logged, got: %+v", lines)
+	}
+	insert, sel := lines[0], lines[1]
+	if insert.Level != "DEBUG" || insert.SQL != "insert into mysql_servers (hostname) values ('db-1')" || insert.Rows == nil || *insert.Rows != 1 || insert.Duration <= 0 {
+		t.Fatalf("unexpected insert log: %+v", insert)
+	}
+	if sel.SQL != "select * from mysql_servers" || sel.Rows != nil {
+		t.Fatalf("unexpected select log: %+v", sel)
+	}
+	server.SetQueryHook(failFirst(1, "delete", errors.New("no")))
+	conn.Clear()
+	lines = readLog(t, &buffer)
+	if len(lines) != 1 || lines[0].Level != "ERROR" || !strings.Contains(lines[0].Error, "ProxySQL Admin Error: no") {
+		t.Fatalf("unexpected error log: %+v", lines)
+	}
+	conn.SetLogger(nil)
+	conn.Clear()
+	if buffer.Len() != 0 {
+		t.Fatalf("logged after the logger was removed: %s", buffer.String())
+	}
+}
+
+func TestLogRedactsSecrets(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	var buffer bytes.Buffer
+	conn.SetLogger(slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	users, _ := NewTypedTable[testUser](conn, "mysql_users")
+	users.Insert(&testUser{Username: "app", Password: "userpw"})
+	conn.SetMonitorCredentials(StaticCredentials("monitor", "monitorpw"))
+	conn.SetUserCredentials(StaticCredentials("app", "newuserpw"))
+	execStatement(context.Background(), conn, "set admin-admin_credentials = 'admin:adminpw'")
+	logged := buffer.String()
+	for _, secret := range []string{"userpw", "monitorpw", "adminpw"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("%s was logged: %s", secret, logged)
+		}
+	}
+	if !strings.Contains(logged, "'<redacted>'") {
+		t.Fatalf("nothing was redacted: %s", logged)
+	}
+}
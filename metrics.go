@@ -0,0 +1,268 @@
+package proxysql
+
+// this file is for counting and timing the calls of a client's methods
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics is told about each call of a client's methods, such as AddHost,
+// ChangeSet.Apply or TypedTable.Select. Implementations must be safe to call
+// concurrently
+type Metrics interface {
+	// ObserveOp is called when a method returns, with how long it took and
+	// the error it returned
+	ObserveOp(op string, duration time.Duration, err error)
+	// ObserveLockWait is called with how long a method waited for the lock
+	// that serializes changes to ProxySQL
+	ObserveLockWait(op string, wait time.Duration)
+}
+
+// SetMetrics reports every call of the client's methods to m. Passing nil
+// stops reporting.
+func (p *ProxySQL) SetMetrics(m Metrics) {
+	p.settingsMut.Lock()
+	defer p.settingsMut.Unlock()
+	p.metrics = m
+}
+
+func (p *ProxySQL) observer() Metrics {
+	p.settingsMut.RLock()
+	defer p.settingsMut.RUnlock()
+	return p.metrics
+}
+
+// The classes of errors that ErrorClass returns
+const (
+	ErrorClassValidation = "validation"
+	ErrorClassReadOnly   = "read_only"
+	ErrorClassTransient  = "transient"
+	ErrorClassAdmin      = "admin"
+	ErrorClassOther      = "other"
+)
+
+// ErrorClass returns the class of an error, for counting errors without a
+// label for every message: validation for invalid hosts and options,
+// read_only for writes to read only tables, transient for errors that
+// IsRetryable accepts, admin for other errors from ProxySQL, and other for
+// the rest. It returns an empty string for nil
+func ErrorClass(err error) string {
+	var validationErr *ValidationError
+	var fieldErr *FieldError
+	var opErr *OpError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &validationErr), errors.As(err, &fieldErr):
+		return ErrorClassValidation
+	case errors.Is(err, ErrTableReadOnly):
+		return ErrorClassReadOnly
+	case IsRetryable(err):
+		return ErrorClassTransient
+	case errors.As(err, &opErr) && opErr.Code != 0:
+		return ErrorClassAdmin
+	}
+	return ErrorClassOther
+}
+
+// ExpvarMetrics publishes counts and total durations with the expvar
+// package, in a map with these keys:
+//
+//	ops                calls of each method
+//	errors             errors of each method and class, like AddHost.validation
+//	seconds            total seconds in each method
+//	lock_wait_seconds  total seconds each method waited for the lock
+type ExpvarMetrics struct {
+	m                                   *expvar.Map
+	ops, errs, seconds, lockWaitSeconds *expvar.Map
+}
+
+// NewExpvarMetrics returns metrics published as the expvar named name, or
+// not published if name is empty. Names can only be published once
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	e := &ExpvarMetrics{
+		m:               new(expvar.Map),
+		ops:             new(expvar.Map),
+		errs:            new(expvar.Map),
+		seconds:         new(expvar.Map),
+		lockWaitSeconds: new(expvar.Map),
+	}
+	e.m.Set("ops", e.ops)
+	e.m.Set("errors", e.errs)
+	e.m.Set("seconds", e.seconds)
+	e.m.Set("lock_wait_seconds", e.lockWaitSeconds)
+	if name != "" {
+		expvar.Publish(name, e.m)
+	}
+	return e
+}
+
+// Map returns the map that holds the metrics
+func (e *ExpvarMetrics) Map() *expvar.Map {
+	return e.m
+}
+
+func (e *ExpvarMetrics) ObserveOp(op string, duration time.Duration, err error) {
+	e.ops.Add(op, 1)
+	e.seconds.AddFloat(op, duration.Seconds())
+	if class := ErrorClass(err); class != "" {
+		e.errs.Add(op+"."+class, 1)
+	}
+}
+
+func (e *ExpvarMetrics) ObserveLockWait(op string, wait time.Duration) {
+	e.lockWaitSeconds.AddFloat(op, wait.Seconds())
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the histograms of
+// PrometheusMetrics
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics keeps metrics in memory, and writes them in the
+// Prometheus text format. Serve them with its ServeHTTP method:
+//
+//	proxysql_client_operations_total{op}
+//	proxysql_client_operation_errors_total{op,class}
+//	proxysql_client_operation_duration_seconds{op}  (histogram)
+//	proxysql_client_lock_wait_seconds{op}           (histogram)
+type PrometheusMetrics struct {
+	namespace string
+	buckets   []float64
+
+	mut       sync.Mutex
+	ops       map[string]uint64
+	errs      map[[2]string]uint64
+	durations map[string]*histogram
+	lockWaits map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics returns metrics whose names start with namespace, or
+// with proxysql_client if it is empty, and whose histograms have the given
+// upper bounds in seconds, or DefaultBuckets if there are none
+func NewPrometheusMetrics(namespace string, buckets ...float64) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = "proxysql_client"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	// every histogram has a +Inf bucket already
+	bounds := make([]float64, 0, len(buckets))
+	for _, bound := range buckets {
+		if !math.IsInf(bound, 1) {
+			bounds = append(bounds, bound)
+		}
+	}
+	sort.Float64s(bounds)
+	return &PrometheusMetrics{
+		namespace: namespace,
+		buckets:   bounds,
+		ops:       make(map[string]uint64),
+		errs:      make(map[[2]string]uint64),
+		durations: make(map[string]*histogram),
+		lockWaits: make(map[string]*histogram),
+	}
+}
+
+func (m *PrometheusMetrics) ObserveOp(op string, duration time.Duration, err error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.ops[op]++
+	if class := ErrorClass(err); class != "" {
+		m.errs[[2]string{op, class}]++
+	}
+	m.observe(m.durations, op, duration)
+}
+
+func (m *PrometheusMetrics) ObserveLockWait(op string, wait time.Duration) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.observe(m.lockWaits, op, wait)
+}
+
+func (m *PrometheusMetrics) observe(histograms map[string]*histogram, op string, d time.Duration) {
+	h, ok := histograms[op]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		histograms[op] = h
+	}
+	seconds := d.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	var b strings.Builder
+	name := m.namespace + "_operations_total"
+	fmt.Fprintf(&b, "# HELP %s Calls of each method of the client.\n# TYPE %s counter\n", name, name)
+	for _, op := range sortedKeys(m.ops) {
+		fmt.Fprintf(&b, "%s{op=%q} %d\n", name, op, m.ops[op])
+	}
+	name = m.namespace + "_operation_errors_total"
+	fmt.Fprintf(&b, "# HELP %s Errors returned by each method of the client, by class.\n# TYPE %s counter\n", name, name)
+	errs := make([][2]string, 0, len(m.errs))
+	for key := range m.errs {
+		errs = append(errs, key)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i][0] < errs[j][0] || errs[i][0] == errs[j][0] && errs[i][1] < errs[j][1]
+	})
+	for _, key := range errs {
+		fmt.Fprintf(&b, "%s{op=%q,class=%q} %d\n", name, key[0], key[1], m.errs[key])
+	}
+	m.writeHistograms(&b, m.namespace+"_operation_duration_seconds", "Seconds each method of the client took.", m.durations)
+	m.writeHistograms(&b, m.namespace+"_lock_wait_seconds", "Seconds each method of the client waited for the lock.", m.lockWaits)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (m *PrometheusMetrics) writeHistograms(b *strings.Builder, name, help string, histograms map[string]*histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, op := range sortedKeys(histograms) {
+		h := histograms[op]
+		for i, bound := range m.buckets {
+			fmt.Fprintf(b, "%s_bucket{op=%q,le=\"%g\"} %d\n", name, op, bound, h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{op=%q,le=\"+Inf\"} %d\n", name, op, h.count)
+		fmt.Fprintf(b, "%s_sum{op=%q} %g\n", name, op, h.sum)
+		fmt.Fprintf(b, "%s_count{op=%q} %d\n", name, op, h.count)
+	}
+}
+
+// ServeHTTP writes the metrics for a Prometheus scrape
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
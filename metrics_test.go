@@ -0,0 +1,94 @@
+package proxysql
+
+import (
+	"errors"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestErrorClass(t *testing.T) {
+	classes := map[error]string{
+		nil: "",
+		invalidField("port", -1, ErrConfigBadPort):                                             ErrorClassValidation,
+		&ValidationError{Fields: []*FieldError{invalidField("port", -1, ErrConfigBadPort)}}:    ErrorClassValidation,
+		CheckWritable("runtime_mysql_servers", "insert"):                                       ErrorClassReadOnly,
+		opError("mysql_servers", "delete from mysql_servers", mysql.ErrInvalidConn):            ErrorClassTransient,
+		opError("mysql_servers", "delete from mysql_servers", &mysql.MySQLError{Number: 1045}): ErrorClassAdmin,
+		errors.New("mock"): ErrorClassOther,
+	}
+	for err, class := range classes {
+		if c := ErrorClass(err); c != class {
+			t.Errorf("%v was classed as %q, expected %q", err, c, class)
+		}
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	metrics := NewPrometheusMetrics("", 0.5, 1)
+	conn.SetMetrics(metrics)
+	conn.AddHost(Hostname("db-1"))
+	conn.AddHost(Hostname("db-2"), Port(-1))
+	conn.AddHost(Table("runtime_mysql_servers"), Hostname("db-3"))
+	conn.NewChangeSet().RemoveHostsLike(Hostname("db-1")).Apply()
+	users, _ := NewTypedTable[testUser](conn, "mysql_users")
+	users.Select()
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	expected := []string{
+		`proxysql_client_operations_total{op="AddHost"} 3`,
+		`proxysql_client_operations_total{op="ChangeSet.Apply"} 1`,
+		`proxysql_client_operations_total{op="TypedTable.Select"} 1`,
+		`proxysql_client_operation_errors_total{op="AddHost",class="read_only"} 1`,
+		`proxysql_client_operation_errors_total{op="AddHost",class="validation"} 1`,
+		`proxysql_client_operation_duration_seconds_bucket{op="AddHost",le="0.5"} 3`,
+		`proxysql_client_operation_duration_seconds_bucket{op="AddHost",le="+Inf"} 3`,
+		`proxysql_client_operation_duration_seconds_count{op="AddHost"} 3`,
+		`proxysql_client_lock_wait_seconds_count{op="ChangeSet.Apply"} 1`,
+		"# TYPE proxysql_client_lock_wait_seconds histogram",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics do not have %s:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `errors_total{op="ChangeSet.Apply"`) {
+		t.Errorf("successful call was counted as an error:\n%s", body)
+	}
+	if recorder.Header().Get("Content-Type") != "text/plain; version=0.0.4" {
+		t.Errorf("unexpected content type: %s", recorder.Header().Get("Content-Type"))
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	metrics := NewExpvarMetrics("proxysql_test_metrics")
+	if expvar.Get("proxysql_test_metrics") != metrics.Map() {
+		t.Fatal("metrics were not published")
+	}
+	conn.SetMetrics(metrics)
+	conn.AddHost(Hostname("db-1"))
+	conn.AddHost(Hostname("db-1"), Port(-1))
+	conn.PersistChanges()
+	get := func(key, op string) string {
+		return metrics.Map().Get(key).(*expvar.Map).Get(op).String()
+	}
+	if get("ops", "AddHost") != "2" || get("ops", "PersistChanges") != "1" || get("errors", "AddHost.validation") != "1" {
+		t.Fatalf("unexpected metrics: %s", metrics.Map())
+	}
+	if metrics.Map().Get("seconds").(*expvar.Map).Get("AddHost") == nil || metrics.Map().Get("lock_wait_seconds").(*expvar.Map).Get("PersistChanges") == nil {
+		t.Fatalf("durations were not recorded: %s", metrics.Map())
+	}
+	conn.SetMetrics(nil)
+	conn.Clear()
+	if metrics.Map().Get("ops").(*expvar.Map).Get("Clear") != nil {
+		t.Fatal("reported after the metrics were removed")
+	}
+}
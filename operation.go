@@ -0,0 +1,129 @@
+package proxysql
+
+// this file is for measuring each call of a client's methods
+
+import (
+	"context"
+	"time"
+)
+
+// operation is a call of one of a client's methods. It names the errors the
+// method returns, reports the call to the client's metrics, and traces it
+// with the client's tracer
+type operation struct {
+	p     *ProxySQL
+	name  string
+	start time.Time
+	// ctx holds the operation and its span, and is passed to its statements
+	ctx  context.Context
+	span Span
+	// the arguments and the statements run, for the audit journal
+	params     map[string]interface{}
+	statements []string
+	// the operation this one was called from, if any
+	parent *operation
+	// set while the operation holds the lock, to let it go while backing
+	// off, unless it must be held throughout
+	unlock, relock func()
+	throughout     bool
+	// whether the operation records its changes instead of running them,
+	// as the client was when the outermost operation began
+	dryRun bool
+}
+
+// begin starts an operation. Methods defer its end with their error
+func (p *ProxySQL) begin(ctx context.Context, name string) *operation {
+	o := &operation{p: p, name: name, start: time.Now(), parent: operationOf(ctx)}
+	if o.parent != nil {
+		o.dryRun = o.parent.dryRun
+	} else {
+		o.dryRun = p.DryRun()
+	}
+	ctx, o.span = p.tracer().Start(ctx, "proxysql."+name)
+	o.ctx = context.WithValue(ctx, operationKey{}, o)
+	return o
+}
+
+type operationKey struct{}
+
+// operationOf returns the innermost operation that ctx was passed down from,
+// or nil if there is none
+func operationOf(ctx context.Context) *operation {
+	o, _ := ctx.Value(operationKey{}).(*operation)
+	return o
+}
+
+// end names the error of the operation, audits it, and reports it
+func (o *operation) end(err *error) {
+	nameOp(o.name, err)
+	if aerr := o.audit(*err); aerr != nil && *err == nil {
+		*err = aerr
+	}
+	if m := o.p.observer(); m != nil {
+		m.ObserveOp(o.name, time.Since(o.start), *err)
+	}
+	o.span.End(*err)
+}
+
+// annotate sets attributes on the span of the operation
+func (o *operation) annotate(attrs ...Attribute) {
+	o.span.SetAttributes(attrs...)
+}
+
+// lock takes the lock that serializes changes to ProxySQL, reporting how long
+// it waited, and returns the function that releases it. The lock is let go
+// while a statement backs off before it is retried
+func (o *operation) lock() func() {
+	return o.take(mut.Lock, mut.Unlock)
+}
+
+// lockThroughout takes the lock as lock does, but keeps it while backing off,
+// for operations whose statements must not be interleaved with others
+func (o *operation) lockThroughout() func() {
+	o.throughout = true
+	return o.take(mut.Lock, mut.Unlock)
+}
+
+// rlock takes the lock for reading, as lock does
+func (o *operation) rlock() func() {
+	return o.take(mut.RLock, mut.RUnlock)
+}
+
+func (o *operation) take(lock, unlock func()) func() {
+	start := time.Now()
+	lock()
+	o.waited(start)
+	o.unlock, o.relock = unlock, func() {
+		start := time.Now()
+		lock()
+		o.waited(start)
+	}
+	return func() {
+		o.unlock, o.relock = nil, nil
+		unlock()
+	}
+}
+
+// release lets go of the lock held by the operation, or by one it was called
+// from, and returns the function that takes it again. Locks taken with
+// lockThroughout are kept
+func (o *operation) release() func() {
+	for ; o != nil; o = o.parent {
+		if o.unlock == nil {
+			continue
+		}
+		if o.throughout {
+			break
+		}
+		relock := o.relock
+		o.unlock()
+		return relock
+	}
+	return func() {}
+}
+
+func (o *operation) waited(start time.Time) {
+	if m := o.p.observer(); m != nil {
+		m.ObserveLockWait(o.name, time.Since(start))
+	}
+}
@@ -0,0 +1,248 @@
+package proxysql
+
+// this file is for clients that share ProxySQL, and only change the hosts
+// they own
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+)
+
+// OwnerKey is the key of the owner in the metadata of a host's comment
+const OwnerKey = "owner"
+
+var (
+	ErrConfigBadOwner = errors.New("Bad owner, must be lower case letters, digits, '.' and '-', starting and ending with a letter or digit")
+	ErrHostNotOwned   = errors.New("Bad host, must be owned by the client")
+)
+
+// owners are matched with LIKE, which ignores the case of ASCII letters and
+// treats _ and % as wildcards, so they can not hold any of them
+var ownerPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// ValidateOwner returns ErrConfigBadOwner if owner can not be used as the
+// owner of hosts
+func ValidateOwner(owner string) error {
+	if !ownerPattern.MatchString(owner) {
+		return ErrConfigBadOwner
+	}
+	return nil
+}
+
+// Owner returns the owner in the metadata of the host's comment, or an
+// empty string if it has none
+func (h *Host) Owner() string {
+	return h.Meta(OwnerKey)
+}
+
+// SetOwner sets the owner in the metadata of the host's comment, keeping the
+// rest of the comment
+func (h *Host) SetOwner(owner string) *Host {
+	return h.SetMeta(OwnerKey, owner)
+}
+
+// OwnedBy selects the hosts whose comment says they are owned by owner. If
+// owner is not valid, the predicate is not either
+func OwnedBy(owner string) Predicate {
+	if ValidateOwner(owner) != nil {
+		return Predicate{op: "like", column: "comment", values: []interface{}{nil}}
+	}
+	return Like("comment", metaLike(OwnerKey, owner))
+}
+
+// OwnedClient is a Client for one of several programs that share a ProxySQL,
+// such as a discovery sidecar for each service. The hosts it adds are owned
+// by it, with its owner in their comment, and it only reads and removes
+// hosts that it owns. Clear removes only its own hosts
+type OwnedClient struct {
+	p     *ProxySQL
+	owner string
+}
+
+// ensure OwnedClient keeps satisfying Client
+var _ Client = (*OwnedClient)(nil)
+
+// NewOwnedClient returns a client that works on the hosts of p owned by
+// owner. Owners are lower case names like orders or orders-sidecar.
+// This will return ErrConfigBadOwner if the owner is not valid
+func NewOwnedClient(p *ProxySQL, owner string) (*OwnedClient, error) {
+	if err := ValidateOwner(owner); err != nil {
+		return nil, invalidField(OwnerKey, owner, err)
+	}
+	return &OwnedClient{p: p, owner: owner}, nil
+}
+
+// Owner returns the owner of the client's hosts
+func (c *OwnedClient) Owner() string {
+	return c.owner
+}
+
+// Ping calls ProxySQL.Ping
+func (c *OwnedClient) Ping() error {
+	return c.p.Ping()
+}
+
+// Close closes the ProxySQL the client was made with
+func (c *OwnedClient) Close() {
+	c.p.Close()
+}
+
+// Conn returns the connection of the ProxySQL the client was made with
+func (c *OwnedClient) Conn() *sql.DB {
+	return c.p.Conn()
+}
+
+// PersistChanges calls ProxySQL.PersistChanges, which persists the changes
+// of every owner
+func (c *OwnedClient) PersistChanges() error {
+	return c.p.PersistChanges()
+}
+
+// AddHost adds a host owned by the client, as ProxySQL.AddHost does. A
+// Comment given is kept, with the owner after it
+func (c *OwnedClient) AddHost(opts ...HostOpts) error {
+	return c.AddHostContext(context.Background(), opts...)
+}
+
+// AddHostContext is AddHost with a context
+func (c *OwnedClient) AddHostContext(ctx context.Context, opts ...HostOpts) error {
+	return c.p.AddHostContext(ctx, append(opts[:len(opts):len(opts)], c.own)...)
+}
+
+// own sets the owner in the comment of the host a query inserts
+func (c *OwnedClient) own(opts *hostQuery) *hostQuery {
+	opts.host.SetOwner(c.owner)
+	for _, field := range opts.specifiedFields {
+		if field == "comment" {
+			return opts
+		}
+	}
+	return opts.specifyField("comment")
+}
+
+// AddHosts adds copies of the hosts owned by the client, as
+// ProxySQL.AddHosts does
+func (c *OwnedClient) AddHosts(hosts ...*Host) error {
+	return c.AddHostsContext(context.Background(), hosts...)
+}
+
+// AddHostsContext is AddHosts with a context
+func (c *OwnedClient) AddHostsContext(ctx context.Context, hosts ...*Host) error {
+	owned := Hosts(hosts).Clone()
+	for _, host := range owned {
+		host.SetOwner(c.owner)
+	}
+	err := c.p.AddHostsContext(ctx, owned...)
+	var hostErr *HostError
+	if errors.As(err, &hostErr) {
+		hostErr.Host = hosts[hostErr.Index]
+	}
+	return err
+}
+
+// Clear removes every host owned by the client
+func (c *OwnedClient) Clear() error {
+	return c.ClearContext(context.Background())
+}
+
+// ClearContext is Clear with a context
+func (c *OwnedClient) ClearContext(ctx context.Context) error {
+	return c.p.RemoveHostsLikeContext(ctx, Where(OwnedBy(c.owner)))
+}
+
+// RemoveHost removes the host, as ProxySQL.RemoveHost does.
+// This will return ErrHostNotOwned if the host is not owned by the client
+func (c *OwnedClient) RemoveHost(host *Host) error {
+	return c.RemoveHostContext(context.Background(), host)
+}
+
+// RemoveHostContext is RemoveHost with a context
+func (c *OwnedClient) RemoveHostContext(ctx context.Context, host *Host) error {
+	if host.Owner() != c.owner {
+		return invalidField(OwnerKey, host.Owner(), ErrHostNotOwned)
+	}
+	return c.p.RemoveHostContext(ctx, host)
+}
+
+// RemoveHostsLike removes the hosts owned by the client that match the
+// options, as ProxySQL.RemoveHostsLike does
+func (c *OwnedClient) RemoveHostsLike(opts ...HostOpts) error {
+	return c.RemoveHostsLikeContext(context.Background(), opts...)
+}
+
+// RemoveHostsLikeContext is RemoveHostsLike with a context
+func (c *OwnedClient) RemoveHostsLikeContext(ctx context.Context, opts ...HostOpts) error {
+	return c.p.RemoveHostsLikeContext(ctx, c.owned(opts)...)
+}
+
+// RemoveHosts removes each of the hosts with RemoveHost
+func (c *OwnedClient) RemoveHosts(hosts ...*Host) error {
+	return c.RemoveHostsContext(context.Background(), hosts...)
+}
+
+// RemoveHostsContext is RemoveHosts with a context
+func (c *OwnedClient) RemoveHostsContext(ctx context.Context, hosts ...*Host) error {
+	for _, host := range hosts {
+		if err := c.RemoveHostContext(ctx, host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HostsLike returns the hosts owned by the client that match the options,
+// as ProxySQL.HostsLike does
+func (c *OwnedClient) HostsLike(opts ...HostOpts) ([]*Host, error) {
+	return c.HostsLikeContext(context.Background(), opts...)
+}
+
+// HostsLikeContext is HostsLike with a context
+func (c *OwnedClient) HostsLikeContext(ctx context.Context, opts ...HostOpts) ([]*Host, error) {
+	return c.p.HostsLikeContext(ctx, c.owned(opts)...)
+}
+
+// All returns the hosts owned by the client in the table, as ProxySQL.All
+// does
+func (c *OwnedClient) All(opts ...HostOpts) ([]*Host, error) {
+	return c.AllContext(context.Background(), opts...)
+}
+
+// AllContext is All with a context
+func (c *OwnedClient) AllContext(ctx context.Context, opts ...HostOpts) ([]*Host, error) {
+	parsed, err := ParseHostOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.TableOnly() {
+		return nil, ErrConfigAllTableOnly
+	}
+	return c.p.HostsLikeContext(ctx, c.owned(opts)...)
+}
+
+// Plan plans the changes that make the hosts owned by the client in the
+// scope match desired, as ProxySQL.Plan does. Copies of the desired hosts
+// are owned by the client, and hosts of other owners are never changed
+func (c *OwnedClient) Plan(desired Hosts, scope ...HostOpts) (*Plan, error) {
+	return c.PlanContext(context.Background(), desired, scope...)
+}
+
+// PlanContext is Plan with a context
+func (c *OwnedClient) PlanContext(ctx context.Context, desired Hosts, scope ...HostOpts) (*Plan, error) {
+	owned := desired.Clone()
+	for _, host := range owned {
+		host.SetOwner(c.owner)
+	}
+	return c.p.PlanContext(ctx, owned, c.owned(scope)...)
+}
+
+// Apply applies a plan from Plan, as ProxySQL.Apply does
+func (c *OwnedClient) Apply(plan *Plan) error {
+	return c.p.Apply(plan)
+}
+
+// owned adds the selection of the client's hosts to options
+func (c *OwnedClient) owned(opts []HostOpts) []HostOpts {
+	return append(opts[:len(opts):len(opts)], Where(OwnedBy(c.owner)))
+}
@@ -0,0 +1,98 @@
+package proxysql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOwnedClient(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	orders, err := NewOwnedClient(conn, "orders")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	payments, _ := NewOwnedClient(conn, "payments")
+	conn.AddHost(Hostname("unowned"))
+	if err := orders.AddHost(Hostname("orders-1"), Comment("primary")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	orders.AddHosts(DefaultHost().SetHostname("orders-2"), DefaultHost().SetHostname("orders-3").SetHostgroupID(1))
+	payments.AddHost(Hostname("payments-1"))
+
+	hosts, err := orders.All()
+	if err != nil || len(hosts) != 3 {
+		t.Fatalf("unexpected hosts: %v, %v", hosts, err)
+	}
+	if text, _ := ParseComment(hosts[0].Comment()); text != "primary" || hosts[0].Owner() != "orders" {
+		t.Fatalf("comment was not kept with the owner: %s", hosts[0].Comment())
+	}
+	if hosts, _ := payments.HostsLike(HostgroupID(0)); len(hosts) != 1 || hosts[0].Hostname() != "payments-1" {
+		t.Fatalf("hosts of another owner were read: %v", hosts)
+	}
+	if err := payments.RemoveHost(hosts[1]); !errors.Is(err, ErrHostNotOwned) {
+		t.Fatalf("host of another owner was removed: %v", err)
+	}
+	if err := payments.RemoveHostsLike(Hostname("orders-1")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if hosts, _ := orders.HostsLike(Hostname("orders-1")); len(hosts) != 1 {
+		t.Fatal("host of another owner was removed by RemoveHostsLike")
+	}
+	if err := orders.RemoveHost(hosts[1]); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := orders.Clear(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	all, _ := conn.All()
+	if len(all) != 2 || all[0].Hostname() != "unowned" || all[1].Hostname() != "payments-1" {
+		t.Fatalf("Clear removed hosts of other owners: %v", all)
+	}
+}
+
+func TestOwnedClientPlan(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	orders, _ := NewOwnedClient(conn, "orders")
+	payments, _ := NewOwnedClient(conn, "payments")
+	payments.AddHost(Hostname("payments-1"))
+	orders.AddHost(Hostname("orders-old"))
+	plan, err := orders.Plan(Hosts{DefaultHost().SetHostname("orders-1")})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(plan.Inserts) != 1 || len(plan.Deletes) != 1 || plan.Deletes[0].Hostname() != "orders-old" {
+		t.Fatalf("plan changes hosts of other owners: %v", plan)
+	}
+	if err := orders.Apply(plan); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if hosts, _ := orders.All(); len(hosts) != 1 || hosts[0].Hostname() != "orders-1" || hosts[0].Owner() != "orders" {
+		t.Fatalf("unexpected hosts: %v", hosts)
+	}
+	if hosts, _ := payments.All(); len(hosts) != 1 {
+		t.Fatalf("hosts of another owner were changed: %v", hosts)
+	}
+}
+
+func TestValidateOwner(t *testing.T) {
+	for _, owner := range []string{"orders", "orders-sidecar", "svc.orders.2"} {
+		if err := ValidateOwner(owner); err != nil {
+			t.Errorf("%s was rejected: %v", owner, err)
+		}
+	}
+	for _, owner := range []string{"", "Orders", "orders_sidecar", "orders%", "-orders", `or"ders`} {
+		if err := ValidateOwner(owner); err != ErrConfigBadOwner {
+			t.Errorf("%q was accepted", owner)
+		}
+	}
+	if _, err := NewOwnedClient(nil, "Orders"); !errors.Is(err, ErrConfigBadOwner) {
+		t.Fatalf("bad owner was accepted: %v", err)
+	}
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	if _, err := conn.HostsLike(Where(OwnedBy("bad owner"))); !errors.Is(err, ErrConfigBadPredicate) {
+		t.Fatalf("predicate with a bad owner was accepted: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package proxysql
+
+// this file is for merging requests to persist changes, so that ProxySQL
+// reloads its servers less often
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPersisterClosed is sent to requests made after a Persister is closed
+var ErrPersisterClosed = errors.New("Persister is closed, must not call Persist after Close")
+
+// Persister merges requests to persist changes to mysql_servers that are
+// made close together into one PersistChanges, as each load to runtime
+// rebuilds ProxySQL's connection pools. Build one with ProxySQL.NewPersister,
+// and Close it when it is no longer needed. It is safe to use concurrently
+type Persister struct {
+	p           *ProxySQL
+	window      time.Duration
+	minInterval time.Duration
+
+	mut     sync.Mutex
+	pending []chan error
+	closed  bool
+
+	// after is time.After, except in tests
+	after func(time.Duration) <-chan time.Time
+
+	wake    chan struct{}
+	closing chan struct{}
+	stopped chan struct{}
+}
+
+// NewPersister returns a Persister that waits window after the first of a
+// group of requests for more to arrive, and then persists them all at once.
+// Persisting never starts less than minInterval after the last one started,
+// however many requests there are
+func (p *ProxySQL) NewPersister(window, minInterval time.Duration) *Persister {
+	return p.newPersister(window, minInterval, time.After)
+}
+
+func (p *ProxySQL) newPersister(window, minInterval time.Duration, after func(time.Duration) <-chan time.Time) *Persister {
+	ps := &Persister{
+		p:           p,
+		window:      window,
+		minInterval: minInterval,
+		after:       after,
+		wake:        make(chan struct{}, 1),
+		closing:     make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go ps.run()
+	return ps
+}
+
+// Persist requests that changes made so far are persisted, and returns a
+// channel that receives the error of the PersistChanges that includes them,
+// or nil once they reached runtime, and is then closed. Requests made while
+// changes are being persisted wait for the next PersistChanges.
+// Persist does not block, and the channel receives ErrPersisterClosed if the
+// persister is closed
+func (ps *Persister) Persist() <-chan error {
+	result := make(chan error, 1)
+	ps.mut.Lock()
+	defer ps.mut.Unlock()
+	if ps.closed {
+		result <- ErrPersisterClosed
+		close(result)
+		return result
+	}
+	ps.pending = append(ps.pending, result)
+	select {
+	case ps.wake <- struct{}{}:
+	default:
+	}
+	return result
+}
+
+// PersistContext requests that changes are persisted as Persist does, and
+// waits until they reach runtime or ctx is done.
+// This returns the error of PersistChanges, or of ctx
+func (ps *Persister) PersistContext(ctx context.Context) error {
+	select {
+	case err := <-ps.Persist():
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close persists the requests that are waiting, without waiting for the
+// window or the interval, and stops the persister
+func (ps *Persister) Close() {
+	ps.mut.Lock()
+	if !ps.closed {
+		ps.closed = true
+		close(ps.closing)
+	}
+	ps.mut.Unlock()
+	<-ps.stopped
+}
+
+func (ps *Persister) run() {
+	defer close(ps.stopped)
+	var last time.Time
+	for {
+		select {
+		case <-ps.wake:
+		case <-ps.closing:
+			ps.flush()
+			return
+		}
+		if !ps.waiting() {
+			// a request that was persisted with earlier ones left this wake
+			continue
+		}
+		wait := ps.window
+		if next := time.Until(last.Add(ps.minInterval)); next > wait {
+			wait = next
+		}
+		select {
+		case <-ps.after(wait):
+		case <-ps.closing:
+		}
+		start := time.Now()
+		if ps.flush() {
+			last = start
+		}
+	}
+}
+
+// waiting reports whether there are requests to persist
+func (ps *Persister) waiting() bool {
+	ps.mut.Lock()
+	defer ps.mut.Unlock()
+	return len(ps.pending) > 0
+}
+
+// flush persists the waiting requests, and sends each the result. This
+// reports whether there were any
+func (ps *Persister) flush() bool {
+	ps.mut.Lock()
+	batch := ps.pending
+	ps.pending = nil
+	ps.mut.Unlock()
+	if len(batch) == 0 {
+		return false
+	}
+	err := ps.p.PersistChanges()
+	for _, result := range batch {
+		result <- err
+		close(result)
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package proxysql
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualTimer stands in for time.After, and fires when the test sends on it.
+// The waits that the persister asked for are in waits
+type manualTimer struct {
+	fire  chan time.Time
+	mut   sync.Mutex
+	waits []time.Duration
+}
+
+func newManualTimer() *manualTimer {
+	return &manualTimer{fire: make(chan time.Time)}
+}
+
+func (m *manualTimer) after(d time.Duration) <-chan time.Time {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.waits = append(m.waits, d)
+	return m.fire
+}
+
+func TestPersisterMergesRequests(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	timer := newManualTimer()
+	persister := conn.newPersister(time.Hour, 0, timer.after)
+	defer persister.Close()
+	results := make([]<-chan error, 20)
+	for i := range results {
+		results[i] = persister.Persist()
+	}
+	// the persister waits for the window before it persists anything
+	timer.fire <- time.Now()
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if n := countQueries(server.Queries(), "load mysql servers to runtime"); n != 1 {
+		t.Fatalf("expected one persist, got %d", n)
+	}
+	result := persister.Persist()
+	timer.fire <- time.Now()
+	if err := <-result; err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if n := countQueries(server.Queries(), "load mysql servers to runtime"); n != 2 {
+		t.Fatalf("expected a second persist, got %d", n)
+	}
+	timer.mut.Lock()
+	defer timer.mut.Unlock()
+	if len(timer.waits) != 2 || timer.waits[0] != time.Hour || timer.waits[1] != time.Hour {
+		t.Fatalf("unexpected waits: %v", timer.waits)
+	}
+}
+
+func TestPersisterIntervalStartsAtLastPersist(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	timer := newManualTimer()
+	persister := conn.newPersister(0, time.Hour, timer.after)
+	defer persister.Close()
+	// a wake without requests, like one left by a request that was
+	// persisted with earlier ones, neither waits nor persists
+	persister.wake <- struct{}{}
+	result := persister.Persist()
+	timer.fire <- time.Now()
+	if err := <-result; err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	result = persister.Persist()
+	timer.fire <- time.Now()
+	<-result
+	timer.mut.Lock()
+	defer timer.mut.Unlock()
+	if len(timer.waits) != 2 || timer.waits[0] != 0 || timer.waits[1] < 59*time.Minute {
+		t.Fatalf("expected no wait, then the interval, got %v", timer.waits)
+	}
+	if n := countQueries(server.Queries(), "load mysql servers to runtime"); n != 2 {
+		t.Fatalf("expected two persists, got %d", n)
+	}
+}
+
+func TestPersisterCapsRate(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	timer := newManualTimer()
+	persister := conn.newPersister(time.Millisecond, time.Hour, timer.after)
+	defer persister.Close()
+	result := persister.Persist()
+	timer.fire <- time.Now()
+	if err := <-result; err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// the second persist waits for the interval, and callers give up with
+	// their context while it does
+	result = persister.Persist()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := persister.PersistContext(ctx); err != context.Canceled {
+		t.Fatalf("waited past the context: %v", err)
+	}
+	if n := countQueries(server.Queries(), "load mysql servers to runtime"); n != 1 {
+		t.Fatalf("persisted again before the interval: %d", n)
+	}
+	timer.fire <- time.Now()
+	if err := <-result; err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	timer.mut.Lock()
+	defer timer.mut.Unlock()
+	if len(timer.waits) != 2 || timer.waits[0] != time.Millisecond || timer.waits[1] < 59*time.Minute {
+		t.Fatalf("expected the window, then the interval, got %v", timer.waits)
+	}
+}
+
+func TestPersisterCloseFlushes(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	persister := conn.NewPersister(time.Hour, time.Hour)
+	result := persister.Persist()
+	persister.Close()
+	if err := <-result; err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if n := countQueries(server.Queries(), "load mysql servers to runtime"); n != 1 {
+		t.Fatalf("waiting request was not persisted: %d", n)
+	}
+	if err := <-persister.Persist(); err != ErrPersisterClosed {
+		t.Fatalf("request after close was accepted: %v", err)
+	}
+	persister.Close()
+}
@@ -3,18 +3,58 @@ package proxysql
 // this file is for the functions on the ProxySQL struct
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql" // driver for interfacing with ProxySQL
+	"github.com/go-sql-driver/mysql" // driver for interfacing with ProxySQL
+	"log/slog"
 	"sync"
+	"time"
 )
 
 type ProxySQL struct {
-	dsn  string
-	conn *sql.DB
+	// the active endpoint, guarded by endpointMut
+	endpointMut sync.RWMutex
+	dsn         string
+	conn        *sql.DB
+	// every endpoint, in order of preference, when there is more than one
+	endpoints []*endpoint
+	// the names of the TLS configs registered with the driver for the client
+	tlsKeys []string
+	// the settings of the client, which methods may change while others run
+	settingsMut sync.RWMutex
+	// how many hosts AddHosts inserts per statement, guarded by settingsMut
+	batchSize int
+	// how statements that fail with transient errors are retried, guarded by
+	// settingsMut
+	retryPolicy RetryPolicy
+	// where statements are logged, if anywhere, guarded by settingsMut
+	logger *slog.Logger
+	// what calls of methods are reported to, if anything, guarded by
+	// settingsMut
+	metrics Metrics
+	// what calls of methods and statements are traced with, if anything,
+	// guarded by settingsMut
+	trace Tracer
+	// whether changes are recorded in journal instead of being run, guarded
+	// by settingsMut, and the recorded statements, guarded by journalMut
+	dryRun     bool
+	journalMut sync.Mutex
+	journal    []DryRunEntry
+	// where changes are audited, if anywhere, and who makes them, guarded by
+	// settingsMut
+	audit      *AuditJournal
+	auditActor string
+	// the detected version and capabilities, guarded by infoMut
+	infoMut      sync.Mutex
+	version      *Version
+	capabilities *Capabilities
 }
 
+// DefaultInsertBatchSize is the number of hosts AddHosts inserts per statement
+// unless SetInsertBatchSize is called
+const DefaultInsertBatchSize = 100
+
 func init() {
 	resetHelpers()
 }
@@ -22,20 +62,43 @@ func init() {
 var mut sync.RWMutex
 
 // Ping is a convenience function that calls the database/sql function on the
-// underlying sql.DB connection
+// underlying sql.DB connection. A client from NewProxySQLFailover fails over
+// to the first endpoint that answers if the active one does not, and only
+// returns an error, an *EndpointError, if none of them answer
 func (p *ProxySQL) Ping() error {
-	return p.conn.Ping()
+	return p.PingContext(context.Background())
+}
+
+// PingContext is Ping with a context, which the ping is run with, and which
+// holds the span that the ping's span is a child of
+func (p *ProxySQL) PingContext(ctx context.Context) (err error) {
+	op := p.begin(ctx, "Ping")
+	defer op.end(&err)
+	err = p.db().PingContext(op.ctx)
+	if err != nil && len(p.endpoints) > 1 {
+		return p.CheckEndpointsContext(op.ctx)
+	}
+	return err
 }
 
 // Close is a convenience function that calls the database/sql function on the
-// underlying sql.DB connection
+// underlying sql.DB connection of every endpoint
 func (p *ProxySQL) Close() {
-	p.conn.Close()
+	if len(p.endpoints) == 0 {
+		p.conn.Close()
+	}
+	for _, e := range p.endpoints {
+		e.conn.Close()
+	}
+	for _, key := range p.tlsKeys {
+		mysql.DeregisterTLSConfig(key)
+	}
 }
 
-// Conn is a convenience function that returns the underlying sql.DB connection
+// Conn is a convenience function that returns the underlying sql.DB
+// connection of the active endpoint
 func (p *ProxySQL) Conn() *sql.DB {
-	return p.conn
+	return p.db()
 }
 
 // PersistChanges saves the mysql servers config to disk, and then loads it
@@ -43,94 +106,188 @@ func (p *ProxySQL) Conn() *sql.DB {
 // mysql_servers table to take effect and transfer to runtime_mysql_servers
 // This propagates errors from sql.Exec
 func (p *ProxySQL) PersistChanges() error {
-	mut.Lock()
-	defer mut.Unlock()
-	_, err := exec(p, "save mysql servers to disk")
-	if err != nil {
-		return err
-	}
-	_, err = exec(p, "load mysql servers to runtime")
-	if err != nil {
-		return err
+	return p.PersistChangesContext(context.Background())
+}
+
+// PersistChangesContext is PersistChanges with a context, which its
+// statements are run with, and which holds the span that its span is a child
+// of. The other methods that end in Context are the same
+func (p *ProxySQL) PersistChangesContext(ctx context.Context) (err error) {
+	op := p.begin(ctx, "PersistChanges")
+	defer op.end(&err)
+	defer op.lock()()
+	op.annotate(Attribute{AttributeTable, "mysql_servers"})
+	op.param("table", "mysql_servers")
+	return persist(op.ctx, p, "mysql_servers")
+}
+
+// persist saves a table to disk and loads it to runtime
+func persist(ctx context.Context, p *ProxySQL, table string) error {
+	for _, statement := range persistQueries[table] {
+		if _, err := execRetrying(ctx, p, statement, nil); err != nil {
+			return opError("", statement, err)
+		}
 	}
 	return nil
 }
 
 // AddHost takes the configuration provided and inserts a host into ProxySQL
 // with that configuration. This will return an error when a validation error
-// of the configuration you specified occurs.
+// of the configuration you specified occurs, and a *TableAccessError if the
+// table is not mysql_servers.
 // This will propagate errors from sql.Exec as well
 func (p *ProxySQL) AddHost(opts ...HostOpts) error {
-	mut.Lock()
-	defer mut.Unlock()
+	return p.AddHostContext(context.Background(), opts...)
+}
+
+// AddHostContext is AddHost with a context
+func (p *ProxySQL) AddHostContext(ctx context.Context, opts ...HostOpts) (err error) {
+	op := p.begin(ctx, "AddHost")
+	defer op.end(&err)
+	defer op.lock()()
 	hostq, err := buildAndParseHostQueryWithHostname(opts...)
 	if err != nil {
 		return err
 	}
+	op.annotate(hostAttributes(hostq)...)
+	op.param("table", hostq.table)
+	op.param("host", rowFromHost(hostq.host))
+	if err := CheckWritable(hostq.table, "insert"); err != nil {
+		return err
+	}
 	// build a query with these options
-	_, err = exec(p, buildInsertQuery(hostq))
-	return err
+	insertQuery := buildInsertQuery(hostq)
+	_, err = execRetrying(op.ctx, p, insertQuery, rowsLanded(op.ctx, p, hostq.table, buildInsertedWhere(hostq), 1))
+	return opError(hostq.table, insertQuery, err)
+}
+
+// SetInsertBatchSize sets the number of hosts AddHosts inserts per statement.
+// Sizes below 1 restore DefaultInsertBatchSize. Older versions of ProxySQL
+// reject statements with more than 500 rows.
+func (p *ProxySQL) SetInsertBatchSize(n int) {
+	if n < 1 {
+		n = DefaultInsertBatchSize
+	}
+	p.settingsMut.Lock()
+	defer p.settingsMut.Unlock()
+	p.batchSize = n
+}
+
+func (p *ProxySQL) insertBatchSize() int {
+	p.settingsMut.RLock()
+	defer p.settingsMut.RUnlock()
+	return p.batchSize
 }
 
-// AddHosts will insert each of the hosts into mysql_servers
-// this will error if any of the hosts are not valid
-// this will propagate error from sql.Exec
+// AddHosts will insert each of the hosts into mysql_servers, several hosts
+// per statement as set by SetInsertBatchSize
+// this will error if any of the hosts are not valid, and insert none of them
+// if a statement fails, each host in it is inserted on its own, so that the
+// hosts before the one that failed are still inserted
+// errors are returned as a *HostError, which reports the host that failed
+// this will propagate error from sql.Exec in HostError.Err
 func (p *ProxySQL) AddHosts(hosts ...*Host) error {
-	for _, host := range hosts {
+	return p.AddHostsContext(context.Background(), hosts...)
+}
+
+// AddHostsContext is AddHosts with a context
+func (p *ProxySQL) AddHostsContext(ctx context.Context, hosts ...*Host) (err error) {
+	op := p.begin(ctx, "AddHosts")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, "mysql_servers"}, Attribute{AttributeRows, int64(len(hosts))})
+	for i, host := range hosts {
 		if err := host.Valid(); err != nil {
-			return err
+			return &HostError{Host: host, Index: i, Err: err}
 		}
 	}
-	mut.Lock()
-	defer mut.Unlock()
-	for _, host := range hosts {
-		insertQuery := fmt.Sprintf("insert into mysql_servers %s values %s", host.columns(), host.values())
-		_, err := exec(p, insertQuery)
-		if err != nil {
-			return err
-		}
+	op.param("hosts", rowsFromHosts(hosts))
+	defer op.lock()()
+	if i, err := servers(p, "mysql_servers").insert(op.ctx, rowsFromHosts(hosts)); err != nil {
+		return &HostError{Host: hosts[i], Index: i, Err: err}
 	}
 	return nil
 }
 
 // Clear is a convenience function to clear configuration
 func (p *ProxySQL) Clear() error {
-	mut.Lock()
-	defer mut.Unlock()
-	_, err := exec(p, "delete from mysql_servers")
+	return p.ClearContext(context.Background())
+}
+
+// ClearContext is Clear with a context
+func (p *ProxySQL) ClearContext(ctx context.Context) (err error) {
+	op := p.begin(ctx, "Clear")
+	defer op.end(&err)
+	defer op.lock()()
+	op.annotate(Attribute{AttributeTable, "mysql_servers"})
+	op.param("table", "mysql_servers")
+	n, err := servers(p, "mysql_servers").delete(op.ctx, &tableQuery{})
+	op.annotate(Attribute{AttributeRows, n})
 	return err
 }
 
 // RemoveHost removes the host that matches the provided host's
 // configuration exactly. This will propagate error from sql.Exec
 func (p *ProxySQL) RemoveHost(host *Host) error {
-	mut.Lock()
-	defer mut.Unlock()
-	// build a query with these options
-	_, err := exec(p, fmt.Sprintf("delete from mysql_servers where %s", host.where()))
-	return err
+	return p.RemoveHostContext(context.Background(), host)
+}
+
+// RemoveHostContext is RemoveHost with a context
+func (p *ProxySQL) RemoveHostContext(ctx context.Context, host *Host) (err error) {
+	op := p.begin(ctx, "RemoveHost")
+	defer op.end(&err)
+	defer op.lock()()
+	op.annotate(Attribute{AttributeTable, "mysql_servers"}, Attribute{AttributeHostgroup, int64(host.HostgroupID())})
+	op.param("host", rowFromHost(host))
+	deleteQuery := fmt.Sprintf("delete from mysql_servers where %s", host.where())
+	_, err = execRetrying(op.ctx, p, deleteQuery, nil)
+	return opError("mysql_servers", deleteQuery, err)
 }
 
 // RemoveHostsLike will remove all hosts that match the specified configuration
-// This will error if configuration does not pass validation
-// This will propagate error from sql.Exec
+// When Limit is given, only the hosts that HostsLike would return are removed
+// This will error if configuration does not pass validation, and return a
+// *TableAccessError if the table is not mysql_servers
+// This will propagate error from sql.Exec, and from sql.Query, sql.Rows.Scan,
+// sql.Rows.Err when Limit is given
 func (p *ProxySQL) RemoveHostsLike(opts ...HostOpts) error {
-	mut.Lock()
-	defer mut.Unlock()
+	return p.RemoveHostsLikeContext(context.Background(), opts...)
+}
+
+// RemoveHostsLikeContext is RemoveHostsLike with a context
+func (p *ProxySQL) RemoveHostsLikeContext(ctx context.Context, opts ...HostOpts) (err error) {
+	op := p.begin(ctx, "RemoveHostsLike")
+	defer op.end(&err)
+	defer op.lock()()
 	hostq, err := buildAndParseHostQuery(opts...)
 	if err != nil {
 		return err
 	}
-	// build a query with these options
-	_, err = exec(p, buildDeleteQuery(hostq))
+	op.annotate(hostAttributes(hostq)...)
+	op.param("table", hostq.table)
+	op.param("where", filterOf(hostq.tableQuery()))
+	if err := CheckWritable(hostq.table, "delete"); err != nil {
+		return err
+	}
+	n, err := removeHostsLike(op.ctx, p, hostq)
+	op.annotate(Attribute{AttributeRows, n})
 	return err
 }
 
+func removeHostsLike(ctx context.Context, p *ProxySQL, hostq *hostQuery) (int64, error) {
+	return servers(p, hostq.table).delete(ctx, hostq.tableQuery())
+}
+
 // RemoveHosts is a convenience function that removes hosts in the given slice
 // This will propagate error from RemoveHost, or from sql.Exec
 func (p *ProxySQL) RemoveHosts(hosts ...*Host) error {
+	return p.RemoveHostsContext(context.Background(), hosts...)
+}
+
+// RemoveHostsContext is RemoveHosts with a context. Each host is removed by
+// RemoveHostContext
+func (p *ProxySQL) RemoveHostsContext(ctx context.Context, hosts ...*Host) error {
 	for _, host := range hosts {
-		err := p.RemoveHost(host)
+		err := p.RemoveHostContext(ctx, host)
 		if err != nil {
 			return err
 		}
@@ -142,48 +299,37 @@ func (p *ProxySQL) RemoveHosts(hosts ...*Host) error {
 // only include specified values in query
 // if they want to delete a host with a specific hostname, only use that
 
-// HostsLike will return all hosts that match the given configuration
+// HostsLike will return all hosts that match the given configuration,
+// ordered and limited by OrderBy, OrderByDesc and Limit
 // This will error on configuration validation failing
 // This will also propagate error from sql.Query, sql.Rows.Scan, sql.Rows.Err
 func (p *ProxySQL) HostsLike(opts ...HostOpts) ([]*Host, error) {
-	mut.RLock()
-	defer mut.RUnlock()
+	return p.HostsLikeContext(context.Background(), opts...)
+}
+
+// HostsLikeContext is HostsLike with a context
+func (p *ProxySQL) HostsLikeContext(ctx context.Context, opts ...HostOpts) (hosts []*Host, err error) {
+	op := p.begin(ctx, "HostsLike")
+	defer op.end(&err)
+	defer op.rlock()()
 	hostq, err := buildAndParseHostQuery(opts...)
 	if err != nil {
 		return nil, err
 	}
-	// run query built from these opts
-	rows, err := query(p, buildSelectQuery(hostq))
+	op.annotate(hostAttributes(hostq)...)
+	hosts, err = hostsLike(op.ctx, p, hostq)
+	op.annotate(Attribute{AttributeRows, int64(len(hosts))})
+	return hosts, err
+}
+
+// hostsLike reads the hosts that a query selects, for callers that hold the
+// lock
+func hostsLike(ctx context.Context, p *ProxySQL, hostq *hostQuery) ([]*Host, error) {
+	rows, err := servers(p, hostq.table).selectRows(ctx, buildSelectQuery(hostq))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	entries := make([]*Host, 0)
-	for rows.Next() {
-		var (
-			hostgroup_id        int
-			hostname            string
-			port                int
-			status              string
-			weight              int
-			compression         int
-			max_connections     int
-			max_replication_lag int
-			use_ssl             int
-			max_latency_ms      int
-			comment             string
-		)
-		err := scanRows(rows, &hostgroup_id, &hostname, &port, &status, &weight, &compression, &max_connections, &max_replication_lag, &use_ssl, &max_latency_ms, &comment)
-		if err != nil {
-			return nil, err
-		}
-		host := &Host{hostgroup_id, hostname, port, status, weight, compression, max_connections, max_replication_lag, use_ssl, max_latency_ms, comment}
-		entries = append(entries, host)
-	}
-	if rowsErr(rows) != nil && rowsErr(rows) != sql.ErrNoRows {
-		return nil, rowsErr(rows)
-	}
-	return entries, nil
+	return hostsFromRows(rows), nil
 }
 
 // All returns the state of the table that you specify
@@ -192,62 +338,44 @@ func (p *ProxySQL) HostsLike(opts ...HostOpts) ([]*Host, error) {
 // or just All() for "mysql_servers"
 // This will also propagate error from sql.Query, sql.Rows.Scan, sql.Rows.Err
 func (p *ProxySQL) All(opts ...HostOpts) ([]*Host, error) {
+	return p.AllContext(context.Background(), opts...)
+}
+
+// AllContext is All with a context
+func (p *ProxySQL) AllContext(ctx context.Context, opts ...HostOpts) (hosts []*Host, err error) {
+	op := p.begin(ctx, "All")
+	defer op.end(&err)
 	hostq, err := buildAndParseHostQuery(opts...)
 	if err != nil {
 		return nil, err
 	}
-	if len(hostq.specifiedFields) != 0 {
-		return nil, errors.New("Only specify Table when calling function All")
+	if !hostq.tableOnly() {
+		return nil, ErrConfigAllTableOnly
 	}
-	mut.RLock()
-	defer mut.RUnlock()
-	entries := make([]*Host, 0)
-	allQuery := fmt.Sprintf("select * from %s", hostq.table)
-	rows, err := query(p, allQuery)
+	op.annotate(Attribute{AttributeTable, hostq.table})
+	defer op.rlock()()
+	rows, err := servers(p, hostq.table).selectRows(op.ctx, buildSelectQuery(hostq))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var (
-			hostgroup_id        int
-			hostname            string
-			port                int
-			status              string
-			weight              int
-			compression         int
-			max_connections     int
-			max_replication_lag int
-			use_ssl             int
-			max_latency_ms      int
-			comment             string
-		)
-		err := scanRows(rows, &hostgroup_id, &hostname, &port, &status, &weight, &compression, &max_connections, &max_replication_lag, &use_ssl, &max_latency_ms, &comment)
-		if err != nil {
-			return nil, err
-		}
-		host := &Host{hostgroup_id, hostname, port, status, weight, compression, max_connections, max_replication_lag, use_ssl, max_latency_ms, comment}
-		entries = append(entries, host)
-	}
-	if rowsErr(rows) != nil && rowsErr(rows) != sql.ErrNoRows {
-		return nil, rowsErr(rows)
-	}
-	return entries, nil
+	op.annotate(Attribute{AttributeRows, int64(len(rows))})
+	return hostsFromRows(rows), nil
 }
 
 // wrappers around standard sql funcs for testing
-var exec func(p *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error)
-var query func(p *ProxySQL, queryString string, _ ...interface{}) (*sql.Rows, error)
+var exec func(ctx context.Context, p *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error)
+var query func(ctx context.Context, p *ProxySQL, queryString string, _ ...interface{}) (*sql.Rows, error)
 var scanRows func(rs *sql.Rows, dest ...interface{}) error
 var rowsErr func(rs *sql.Rows) error
 var open func(string, string) (*sql.DB, error)
+var sleep func(ctx context.Context, d time.Duration) error
 
 func resetHelpers() {
-	exec = func(p *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
-		return p.conn.Exec(queryString)
+	exec = func(ctx context.Context, p *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
+		return p.db().ExecContext(ctx, queryString)
 	}
-	query = func(p *ProxySQL, queryString string, _ ...interface{}) (*sql.Rows, error) {
-		return p.conn.Query(queryString)
+	query = func(ctx context.Context, p *ProxySQL, queryString string, _ ...interface{}) (*sql.Rows, error) {
+		return p.db().QueryContext(ctx, queryString)
 	}
 	scanRows = func(rs *sql.Rows, dest ...interface{}) error {
 		return rs.Scan(dest...)
@@ -256,4 +384,5 @@ func resetHelpers() {
 		return rs.Err()
 	}
 	open = sql.Open
+	sleep = sleepContext
 }
@@ -1,10 +1,12 @@
 package proxysql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/kirinrastogi/proxysql-go/proxysqltest"
 	"github.com/ory/dockertest"
 	"log"
 	"math/rand"
@@ -35,6 +37,24 @@ func longSetup(t *testing.T) *ProxySQL {
 	return conn
 }
 
+// starts an in-process admin interface, for tests that run with -short
+func serverSetup(t *testing.T, opts ...proxysqltest.ServerOpts) (*ProxySQL, *proxysqltest.Server) {
+	server, err := proxysqltest.NewServer(opts...)
+	if err != nil {
+		t.Fatalf("could not start test server: %v", err)
+	}
+	conn, err := NewProxySQL(server.DSN())
+	if err != nil {
+		t.Fatal("bad dsn")
+	}
+	return conn, server
+}
+
+func serverTeardown(conn *ProxySQL, server *proxysqltest.Server) {
+	conn.Close()
+	server.Close()
+}
+
 func TestMain(m *testing.M) {
 	var err error
 	pool, err = dockertest.NewPool("")
@@ -169,7 +189,7 @@ func TestAllErrorsWhenQueryOptsAdded(t *testing.T) {
 func TestAllErrorsOnQueryError(t *testing.T) {
 	defer resetHelpers()
 	conn := shortSetup(t)
-	query = func(*ProxySQL, string, ...interface{}) (*sql.Rows, error) {
+	query = func(context.Context, *ProxySQL, string, ...interface{}) (*sql.Rows, error) {
 		return nil, errors.New("error querying proxysql")
 	}
 	entries, err := conn.All()
@@ -252,7 +272,7 @@ func TestAddHostAddsAHostToHostgroupID(t *testing.T) {
 func TestAddHostReturnsErrorOnBadConfig(t *testing.T) {
 	conn := shortSetup(t)
 	err := conn.AddHost(Hostname("some-host"), HostgroupID(1), Port(-1))
-	if err != ErrConfigBadPort {
+	if !errors.Is(err, ErrConfigBadPort) {
 		t.Logf("did not receive err about bad port: %v", err)
 		t.Fail()
 	}
@@ -262,25 +282,125 @@ func TestAddHostsReturnsErrorOnError(t *testing.T) {
 	defer resetHelpers()
 	conn := shortSetup(t)
 	mockErr := errors.New("mock")
-	exec = func(_ *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
+	exec = func(_ context.Context, _ *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
 		return nil, mockErr
 	}
-	err := conn.AddHosts(DefaultHost())
-	if err != mockErr {
+	err := conn.AddHosts(DefaultHost().SetHostname("a"))
+	if herr, ok := err.(*HostError); !ok || !errors.Is(herr.Err, mockErr) {
 		t.Fatalf("did not get expected error: %v", err)
 	}
 }
 
 func TestAddHostsReturnsErrorBeforeConnectingToProxySQLOnInvalidHost(t *testing.T) {
 	conn := shortSetup(t)
-	host := DefaultHost().SetHostgroupID(-1)
-	err := conn.AddHosts(host)
-	if err != ErrConfigBadHostgroupID {
+	host := DefaultHost().SetHostname("b").SetHostgroupID(-1)
+	err := conn.AddHosts(DefaultHost().SetHostname("a"), host)
+	herr, ok := err.(*HostError)
+	if !ok || !errors.Is(herr.Err, ErrConfigBadHostgroupID) {
 		t.Fatalf("did not get expected error of bad hostgroupid when validating")
 	}
+	if herr.Host != host || herr.Index != 1 {
+		t.Fatalf("error did not report the invalid host: %v", err)
+	}
 	t.Log(err)
 }
 
+func TestAddHostsBatchesInserts(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.SetInsertBatchSize(2)
+	var hosts []*Host
+	for i := 0; i < 5; i++ {
+		hosts = append(hosts, DefaultHost().SetHostname(fmt.Sprintf("host-%d", i)))
+	}
+	if err := conn.AddHosts(hosts...); err != nil {
+		t.Fatalf("could not add hosts: %v", err)
+	}
+	if queries := server.Queries(); len(queries) != 3 {
+		t.Fatalf("expected 3 statements for 5 hosts in batches of 2, got: %v", queries)
+	}
+	entries, err := conn.All()
+	if err != nil {
+		t.Fatalf("could not read hosts: %v", err)
+	}
+	if !reflect.DeepEqual(entries, hosts) {
+		t.Fatalf("hosts were not all inserted: %v", entries)
+	}
+}
+
+func TestAddHostsReportsFailingHostInBatch(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.SetInsertBatchSize(3)
+	hosts := []*Host{
+		DefaultHost().SetHostname("a"),
+		DefaultHost().SetHostname("b"),
+		DefaultHost().SetHostname("c"),
+		DefaultHost().SetHostname("b"),
+		DefaultHost().SetHostname("d"),
+	}
+	err := conn.AddHosts(hosts...)
+	herr, ok := err.(*HostError)
+	if !ok {
+		t.Fatalf("expected a HostError, got: %v", err)
+	}
+	if herr.Index != 3 || herr.Host != hosts[3] {
+		t.Fatalf("error did not report the duplicate host: %v", err)
+	}
+	entries, err := conn.All()
+	if err != nil {
+		t.Fatalf("could not read hosts: %v", err)
+	}
+	if !reflect.DeepEqual(entries, hosts[:3]) {
+		t.Fatalf("hosts before the failure were not kept: %v", entries)
+	}
+}
+
+func TestSetInsertBatchSizeRestoresDefault(t *testing.T) {
+	conn := shortSetup(t)
+	conn.SetInsertBatchSize(10)
+	conn.SetInsertBatchSize(0)
+	if conn.insertBatchSize() != DefaultInsertBatchSize {
+		t.Fatalf("batch size was not restored to the default: %d", conn.insertBatchSize())
+	}
+}
+
+func benchmarkAddHosts(b *testing.B, batchSize int) {
+	server, err := proxysqltest.NewServer()
+	if err != nil {
+		b.Fatalf("could not start test server: %v", err)
+	}
+	conn, err := NewProxySQL(server.DSN())
+	if err != nil {
+		b.Fatal("bad dsn")
+	}
+	defer serverTeardown(conn, server)
+	conn.SetInsertBatchSize(batchSize)
+	hosts := make([]*Host, 500)
+	for i := range hosts {
+		hosts[i] = DefaultHost().SetHostname(fmt.Sprintf("replica-%d", i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := conn.AddHosts(hosts...); err != nil {
+			b.Fatalf("could not add hosts: %v", err)
+		}
+		b.StopTimer()
+		if err := conn.Clear(); err != nil {
+			b.Fatalf("could not clear hosts: %v", err)
+		}
+		b.StartTimer()
+	}
+}
+
+func BenchmarkAddHostsOnePerStatement(b *testing.B) {
+	benchmarkAddHosts(b, 1)
+}
+
+func BenchmarkAddHostsBatched(b *testing.B) {
+	benchmarkAddHosts(b, DefaultInsertBatchSize)
+}
+
 func TestClearClearsProxySQL(t *testing.T) {
 	defer SetupAndTeardownProxySQL(t)()
 	conn := longSetup(t)
@@ -335,16 +455,16 @@ func TestRemoveHostsLikeErrorsOnParseOrExecError(t *testing.T) {
 	defer resetHelpers()
 	conn := shortSetup(t)
 	err := conn.RemoveHostsLike(HostgroupID(-1))
-	if err != ErrConfigBadHostgroupID {
+	if !errors.Is(err, ErrConfigBadHostgroupID) {
 		t.Fatalf("did not receive validation error on bad param: %v", err)
 	}
 
 	mockErr := errors.New("mock")
-	exec = func(_ *ProxySQL, _ string, _ ...interface{}) (sql.Result, error) {
+	exec = func(_ context.Context, _ *ProxySQL, _ string, _ ...interface{}) (sql.Result, error) {
 		return nil, mockErr
 	}
 	err = conn.RemoveHostsLike(HostgroupID(1))
-	if err != mockErr {
+	if !errors.Is(err, mockErr) {
 		t.Fatalf("did not propagate execution error: %v", err)
 	}
 }
@@ -366,11 +486,11 @@ func TestRemoveHostsPropagatesErrorFromRemoveHost(t *testing.T) {
 	defer resetHelpers()
 	conn := shortSetup(t)
 	mockErr := errors.New("mock")
-	exec = func(_ *ProxySQL, _ string, _ ...interface{}) (sql.Result, error) {
+	exec = func(_ context.Context, _ *ProxySQL, _ string, _ ...interface{}) (sql.Result, error) {
 		return nil, mockErr
 	}
 
-	if err := conn.RemoveHosts(DefaultHost()); err != mockErr {
+	if err := conn.RemoveHosts(DefaultHost()); !errors.Is(err, mockErr) {
 		t.Fatalf("unexpected error from RemoveHosts, did not propagate: %v", err)
 	}
 }
@@ -401,7 +521,7 @@ func TestHostsLikeReturnsErrorOnRowScanError(t *testing.T) {
 		return mockErr
 	}
 	hosts, err := conn.HostsLike(HostgroupID(1))
-	if err != mockErr {
+	if !errors.Is(err, mockErr) {
 		t.Fatalf("did not receive error when scanRows returned error: %v", err)
 	}
 	if hosts != nil {
@@ -420,7 +540,7 @@ func TestHostsLikeReturnsErrorOnRowsError(t *testing.T) {
 		return mockErr
 	}
 	hosts, err := conn.HostsLike(HostgroupID(1))
-	if err != mockErr {
+	if !errors.Is(err, mockErr) {
 		t.Fatalf("did not receive error when scanRows returned error: %v", err)
 	}
 	if hosts != nil {
@@ -432,16 +552,16 @@ func TestHostsLikeParseErrorAndQueryErrorReturnErrors(t *testing.T) {
 	defer resetHelpers()
 	conn := shortSetup(t)
 	_, err := conn.HostsLike(Port(-1))
-	if err != ErrConfigBadPort {
+	if !errors.Is(err, ErrConfigBadPort) {
 		t.Fatalf("did not receive expected error on supplying bad parameters to HostsLike: %v", err)
 	}
 
 	mockErr := errors.New("mock")
-	query = func(_ *ProxySQL, _ string, _ ...interface{}) (*sql.Rows, error) {
+	query = func(_ context.Context, _ *ProxySQL, _ string, _ ...interface{}) (*sql.Rows, error) {
 		return nil, mockErr
 	}
 	_, err = conn.HostsLike(Hostname("yee"))
-	if err != mockErr {
+	if !errors.Is(err, mockErr) {
 		t.Fatalf("did not receive expected error when query returned error: %v", err)
 	}
 }
@@ -450,14 +570,14 @@ func TestPersistChangesErrorsOnSave(t *testing.T) {
 	defer resetHelpers()
 	conn := shortSetup(t)
 	saveErr := errors.New("could not save servers to disk")
-	exec = func(_ *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
+	exec = func(_ context.Context, _ *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
 		if queryString == "save mysql servers to disk" {
 			return nil, saveErr
 		}
 		return nil, nil
 	}
 	err := conn.PersistChanges()
-	if err != saveErr {
+	if !errors.Is(err, saveErr) {
 		t.Log("persist changes did not error on save failure")
 		t.Fail()
 	}
@@ -468,14 +588,14 @@ func TestPersistChangesErrorsOnLoad(t *testing.T) {
 	defer resetHelpers()
 	conn := longSetup(t)
 	loadErr := errors.New("error saving servers to disk")
-	exec = func(_ *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
+	exec = func(_ context.Context, _ *ProxySQL, queryString string, _ ...interface{}) (sql.Result, error) {
 		if queryString == "load mysql servers to runtime" {
 			return nil, loadErr
 		}
 		return nil, nil
 	}
 	err := conn.PersistChanges()
-	if err != loadErr {
+	if !errors.Is(err, loadErr) {
 		t.Log("persist changes did not error on load failure")
 		t.Fail()
 	}
@@ -586,6 +706,57 @@ func TestAddHostWithAllConfigurationsAddsAHostConfigured(t *testing.T) {
 	}
 }
 
+func TestPersistChangesAgainstTestServer(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	entries := []*Host{
+		DefaultHost().SetHostname("reader1").SetHostgroupID(1),
+		DefaultHost().SetHostname("writer").SetHostgroupID(0).SetPort(3307),
+	}
+	if err := conn.AddHosts(entries...); err != nil {
+		t.Fatalf("could not add hosts: %v", err)
+	}
+	if err := conn.AddHost(Hostname("reader2"), HostgroupID(1), Comment("c")); err != nil {
+		t.Fatalf("could not add host: %v", err)
+	}
+	if err := conn.PersistChanges(); err != nil {
+		t.Fatalf("could not persist changes: %v", err)
+	}
+	runtime, err := conn.All(Table("runtime_mysql_servers"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries = append(entries, DefaultHost().SetHostname("reader2").SetHostgroupID(1).SetComment("c"))
+	if !reflect.DeepEqual(runtime, entries) {
+		t.Fatalf("runtime was not the persisted hosts: %v", runtime)
+	}
+	readers, err := conn.HostsLike(Table("runtime_mysql_servers"), HostgroupID(1))
+	if err != nil || len(readers) != 2 {
+		t.Fatalf("did not find both readers: %v, %v", readers, err)
+	}
+}
+
+func TestRemoveHostsAgainstTestServer(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.AddHost(Hostname("a"))
+	conn.AddHost(Hostname("b"), HostgroupID(1))
+	conn.AddHost(Hostname("c"), HostgroupID(1))
+	if err := conn.RemoveHostsLike(Hostname("b")); err != nil {
+		t.Fatalf("could not remove hosts like: %v", err)
+	}
+	if err := conn.RemoveHost(DefaultHost().SetHostname("a")); err != nil {
+		t.Fatalf("could not remove host: %v", err)
+	}
+	entries, _ := conn.All()
+	if len(entries) != 1 || entries[0].hostname != "c" {
+		t.Fatalf("did not remove hosts: %v", entries)
+	}
+	if err := conn.AddHost(Hostname("c"), HostgroupID(1)); err == nil {
+		t.Fatal("did not receive error on duplicate host")
+	}
+}
+
 func SetupAndTeardownProxySQL(t *testing.T) func() {
 	SetupProxySQL(t)
 	return func() {
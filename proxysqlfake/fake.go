@@ -0,0 +1,283 @@
+// Package proxysqlfake provides an in-memory implementation of proxysql.Client
+// for use in tests. It keeps separate memory, disk and runtime copies of
+// mysql_servers, and validates input the same way proxysql.ProxySQL does, so
+// tests can assert on the resulting state instead of on the calls made.
+package proxysqlfake
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/kirinrastogi/proxysql-go"
+	"sync"
+)
+
+var (
+	// ErrUniqueConstraint is returned when a host would share its primary key
+	// (hostgroup_id, hostname, port) with a host already in mysql_servers
+	ErrUniqueConstraint = errors.New("UNIQUE constraint failed: mysql_servers.hostgroup_id, mysql_servers.hostname, mysql_servers.port")
+	// ErrClosed is returned by every function after Close has been called
+	ErrClosed = errors.New("sql: database is closed")
+)
+
+// ProxySQL is an in-memory stand in for proxysql.ProxySQL
+type ProxySQL struct {
+	mut     sync.Mutex
+	memory  []*proxysql.Host
+	disk    []*proxysql.Host
+	runtime []*proxysql.Host
+	err     error
+	closed  bool
+}
+
+// ensure the fake keeps satisfying the same interface as the real client
+var _ proxysql.Client = (*ProxySQL)(nil)
+
+// New returns a fake with empty memory, disk and runtime tables
+func New() *ProxySQL {
+	return &ProxySQL{}
+}
+
+// SetError makes every following call return err, as though ProxySQL were
+// unreachable. Call SetError(nil) to make the fake healthy again
+func (p *ProxySQL) SetError(err error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.err = err
+}
+
+// Memory returns a copy of the mysql_servers table
+func (p *ProxySQL) Memory() []*proxysql.Host {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return copyHosts(p.memory)
+}
+
+// Disk returns a copy of the disk.mysql_servers table
+func (p *ProxySQL) Disk() []*proxysql.Host {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return copyHosts(p.disk)
+}
+
+// Runtime returns a copy of the runtime_mysql_servers table
+func (p *ProxySQL) Runtime() []*proxysql.Host {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return copyHosts(p.runtime)
+}
+
+// Ping returns the error set by SetError, if any
+func (p *ProxySQL) Ping() error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.healthy()
+}
+
+// Close makes every following call return ErrClosed
+func (p *ProxySQL) Close() {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.closed = true
+}
+
+// Conn returns nil, there is no underlying connection to ProxySQL
+func (p *ProxySQL) Conn() *sql.DB {
+	return nil
+}
+
+// PersistChanges copies mysql_servers to disk, and then to runtime
+func (p *ProxySQL) PersistChanges() error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if err := p.healthy(); err != nil {
+		return err
+	}
+	p.disk = copyHosts(p.memory)
+	p.runtime = copyHosts(p.memory)
+	return nil
+}
+
+// AddHost inserts a host configured by opts, see proxysql.ProxySQL.AddHost
+func (p *ProxySQL) AddHost(opts ...proxysql.HostOpts) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	parsed, err := proxysql.ParseHostOpts(opts...)
+	if err != nil {
+		return err
+	}
+	if err := proxysql.CheckWritable(parsed.Table(), "insert"); err != nil {
+		return err
+	}
+	host := parsed.Host()
+	if err := host.Valid(); err != nil {
+		return err
+	}
+	if err := p.healthy(); err != nil {
+		return err
+	}
+	return p.insert(host)
+}
+
+// AddHosts inserts each host in order, see proxysql.ProxySQL.AddHosts.
+// Like ProxySQL, hosts inserted before a failing one stay inserted, and the
+// error is a *proxysql.HostError naming the host that failed
+func (p *ProxySQL) AddHosts(hosts ...*proxysql.Host) error {
+	for i, host := range hosts {
+		if err := host.Valid(); err != nil {
+			return &proxysql.HostError{Host: host, Index: i, Err: err}
+		}
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for i, host := range hosts {
+		if err := p.healthy(); err != nil {
+			return &proxysql.HostError{Host: host, Index: i, Err: err}
+		}
+		if err := p.insert(host); err != nil {
+			return &proxysql.HostError{Host: host, Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// Clear removes every host from mysql_servers
+func (p *ProxySQL) Clear() error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if err := p.healthy(); err != nil {
+		return err
+	}
+	p.memory = nil
+	return nil
+}
+
+// RemoveHost removes the hosts in mysql_servers identical to host
+func (p *ProxySQL) RemoveHost(host *proxysql.Host) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if err := p.healthy(); err != nil {
+		return err
+	}
+	p.memory = without(p.memory, func(h *proxysql.Host) bool {
+		return h.Equal(host)
+	})
+	return nil
+}
+
+// RemoveHostsLike removes the hosts matching opts, see
+// proxysql.ProxySQL.RemoveHostsLike
+func (p *ProxySQL) RemoveHostsLike(opts ...proxysql.HostOpts) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	parsed, err := proxysql.ParseHostOpts(opts...)
+	if err != nil {
+		return err
+	}
+	if err := proxysql.CheckWritable(parsed.Table(), "delete"); err != nil {
+		return err
+	}
+	if err := p.healthy(); err != nil {
+		return err
+	}
+	selected := make(map[*proxysql.Host]bool)
+	for _, host := range parsed.Select(p.memory) {
+		selected[host] = true
+	}
+	p.memory = without(p.memory, func(h *proxysql.Host) bool {
+		return selected[h]
+	})
+	return nil
+}
+
+// RemoveHosts removes each of the given hosts
+func (p *ProxySQL) RemoveHosts(hosts ...*proxysql.Host) error {
+	for _, host := range hosts {
+		if err := p.RemoveHost(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HostsLike returns copies of the hosts matching opts, see
+// proxysql.ProxySQL.HostsLike
+func (p *ProxySQL) HostsLike(opts ...proxysql.HostOpts) ([]*proxysql.Host, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	parsed, err := proxysql.ParseHostOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.healthy(); err != nil {
+		return nil, err
+	}
+	entries := parsed.Select(*p.table(parsed.Table()))
+	for i, host := range entries {
+		entries[i] = host.Clone()
+	}
+	return entries, nil
+}
+
+// All returns copies of every host in the table specified, see
+// proxysql.ProxySQL.All
+func (p *ProxySQL) All(opts ...proxysql.HostOpts) ([]*proxysql.Host, error) {
+	parsed, err := proxysql.ParseHostOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.TableOnly() {
+		return nil, proxysql.ErrConfigAllTableOnly
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if err := p.healthy(); err != nil {
+		return nil, err
+	}
+	entries := copyHosts(*p.table(parsed.Table()))
+	if entries == nil {
+		entries = make([]*proxysql.Host, 0)
+	}
+	return entries, nil
+}
+
+func (p *ProxySQL) healthy() error {
+	if p.closed {
+		return ErrClosed
+	}
+	return p.err
+}
+
+// returns the table that a validated table name refers to
+func (p *ProxySQL) table(name string) *[]*proxysql.Host {
+	switch name {
+	case "runtime_mysql_servers":
+		return &p.runtime
+	case "disk.mysql_servers":
+		return &p.disk
+	}
+	return &p.memory
+}
+
+func (p *ProxySQL) insert(host *proxysql.Host) error {
+	for _, existing := range p.memory {
+		if existing.Key() == host.Key() {
+			return ErrUniqueConstraint
+		}
+	}
+	p.memory = append(p.memory, host.Clone())
+	return nil
+}
+
+func without(hosts []*proxysql.Host, remove func(*proxysql.Host) bool) []*proxysql.Host {
+	kept := make([]*proxysql.Host, 0, len(hosts))
+	for _, host := range hosts {
+		if !remove(host) {
+			kept = append(kept, host)
+		}
+	}
+	return kept
+}
+
+func copyHosts(hosts []*proxysql.Host) []*proxysql.Host {
+	return proxysql.Hosts(hosts).Clone()
+}
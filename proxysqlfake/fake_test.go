@@ -0,0 +1,235 @@
+package proxysqlfake
+
+import (
+	"errors"
+	"github.com/kirinrastogi/proxysql-go"
+	"reflect"
+	"testing"
+)
+
+func TestAddHostAddsToMemoryOnly(t *testing.T) {
+	p := New()
+	if err := p.AddHost(proxysql.Hostname("some-host"), proxysql.HostgroupID(1)); err != nil {
+		t.Fatalf("unexpected err adding host: %v", err)
+	}
+	memory := p.Memory()
+	expected := proxysql.DefaultHost().SetHostname("some-host").SetHostgroupID(1)
+	if len(memory) != 1 || !reflect.DeepEqual(memory[0], expected) {
+		t.Fatalf("memory was not the host added: %v", memory)
+	}
+	if len(p.Disk()) != 0 || len(p.Runtime()) != 0 {
+		t.Fatalf("host was added to disk or runtime before persisting: %v, %v", p.Disk(), p.Runtime())
+	}
+}
+
+func TestAddHostReturnsValidationErrors(t *testing.T) {
+	p := New()
+	if err := p.AddHost(proxysql.Hostname("some-host"), proxysql.Port(-1)); !errors.Is(err, proxysql.ErrConfigBadPort) {
+		t.Fatalf("did not receive err about bad port: %v", err)
+	}
+	var invalid *proxysql.ValidationError
+	if err := p.AddHost(proxysql.HostgroupID(1)); !errors.As(err, &invalid) || !errors.Is(err, proxysql.ErrConfigNoHostname) {
+		t.Fatalf("did not receive a ValidationError about missing hostname: %v", err)
+	}
+	if err := p.AddHost(proxysql.Hostname("some-host:3306")); !errors.Is(err, proxysql.ErrConfigBadHostname) {
+		t.Fatalf("did not receive err about bad hostname: %v", err)
+	}
+	if err := p.AddHosts(proxysql.DefaultHost().SetHostgroupID(-1)); !errors.Is(err.(*proxysql.HostError).Err, proxysql.ErrConfigBadHostgroupID) {
+		t.Fatalf("did not receive err about bad hostgroup: %v", err)
+	}
+	if len(p.Memory()) != 0 {
+		t.Fatalf("invalid hosts were added: %v", p.Memory())
+	}
+}
+
+func TestAddHostErrorsOnPrimaryKeyConflict(t *testing.T) {
+	p := New()
+	p.AddHost(proxysql.Hostname("some-host"))
+	if err := p.AddHost(proxysql.Hostname("some-host"), proxysql.Weight(2)); err != ErrUniqueConstraint {
+		t.Fatalf("did not receive err on duplicate primary key: %v", err)
+	}
+	if err := p.AddHost(proxysql.Hostname("some-host"), proxysql.Port(3307)); err != nil {
+		t.Fatalf("unexpected err adding host on another port: %v", err)
+	}
+}
+
+func TestAddHostsKeepsHostsBeforeConflict(t *testing.T) {
+	p := New()
+	err := p.AddHosts(
+		proxysql.DefaultHost().SetHostname("a"),
+		proxysql.DefaultHost().SetHostname("b"),
+		proxysql.DefaultHost().SetHostname("a"),
+		proxysql.DefaultHost().SetHostname("c"),
+	)
+	herr, ok := err.(*proxysql.HostError)
+	if !ok || herr.Err != ErrUniqueConstraint || herr.Index != 2 {
+		t.Fatalf("did not receive err on duplicate primary key: %v", err)
+	}
+	memory := p.Memory()
+	if len(memory) != 2 || memory[0].Hostname() != "a" || memory[1].Hostname() != "b" {
+		t.Fatalf("hosts before the conflict were not kept: %v", memory)
+	}
+}
+
+func TestPersistChangesCopiesMemoryToDiskAndRuntime(t *testing.T) {
+	p := New()
+	p.AddHost(proxysql.Hostname("a"))
+	p.AddHost(proxysql.Hostname("b"), proxysql.HostgroupID(1))
+	if err := p.PersistChanges(); err != nil {
+		t.Fatalf("unexpected err persisting: %v", err)
+	}
+	p.RemoveHostsLike(proxysql.Hostname("a"))
+	if !reflect.DeepEqual(p.Disk(), p.Runtime()) || len(p.Runtime()) != 2 {
+		t.Fatalf("disk and runtime were not the persisted memory: %v, %v", p.Disk(), p.Runtime())
+	}
+	runtime, err := p.All(proxysql.Table("runtime_mysql_servers"))
+	if err != nil {
+		t.Fatalf("unexpected err reading runtime: %v", err)
+	}
+	if !reflect.DeepEqual(runtime, p.Runtime()) {
+		t.Fatalf("All did not read runtime: %v", runtime)
+	}
+	if len(p.Memory()) != 1 {
+		t.Fatalf("memory was not changed independently of runtime: %v", p.Memory())
+	}
+}
+
+func TestWritesToRuntimeAndDiskAreRejected(t *testing.T) {
+	p := New()
+	p.AddHost(proxysql.Hostname("a"))
+	p.PersistChanges()
+	if err := p.AddHost(proxysql.Table("runtime_mysql_servers"), proxysql.Hostname("b")); !errors.Is(err, proxysql.ErrTableReadOnly) {
+		t.Fatalf("adding host to runtime was not rejected: %v", err)
+	}
+	if err := p.RemoveHostsLike(proxysql.Table("disk.mysql_servers"), proxysql.Hostname("a")); !errors.Is(err, proxysql.ErrTableReadOnly) {
+		t.Fatalf("removing host from disk was not rejected: %v", err)
+	}
+	if disk, err := p.All(proxysql.Table("disk.mysql_servers")); err != nil || len(disk) != 1 {
+		t.Fatalf("could not read disk: %v, %v", disk, err)
+	}
+	runtime := p.Runtime()
+	if len(runtime) != 1 || runtime[0].Hostname() != "a" {
+		t.Fatalf("runtime was changed without loading: %v", runtime)
+	}
+}
+
+func TestHostsLikeReturnsMatchingCopies(t *testing.T) {
+	p := New()
+	p.AddHost(proxysql.Hostname("hostname3"), proxysql.HostgroupID(3))
+	p.AddHost(proxysql.Hostname("hostname1"), proxysql.HostgroupID(1))
+	p.AddHost(proxysql.Hostname("hostname2"), proxysql.HostgroupID(1), proxysql.Port(3307))
+	hosts, err := p.HostsLike(proxysql.HostgroupID(1))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(hosts) != 2 || hosts[0].Hostname() != "hostname1" || hosts[1].Hostname() != "hostname2" {
+		t.Fatalf("did not receive expected hosts: %v", hosts)
+	}
+	hosts[0].SetHostname("changed")
+	if p.Memory()[1].Hostname() != "hostname1" {
+		t.Fatal("returned host was not a copy")
+	}
+	hosts, _ = p.HostsLike(proxysql.HostgroupID(1), proxysql.Port(3307))
+	if len(hosts) != 1 || hosts[0].Hostname() != "hostname2" {
+		t.Fatalf("did not match on every field: %v", hosts)
+	}
+	if _, err := p.HostsLike(proxysql.Port(1), proxysql.Port(2)); !errors.Is(err, proxysql.ErrConfigDuplicateSpec) {
+		t.Fatalf("did not receive validation error: %v", err)
+	}
+}
+
+func TestHostsLikeAndRemoveHostsLikeUseFilters(t *testing.T) {
+	p := New()
+	p.AddHost(proxysql.Hostname("db-1"), proxysql.Weight(3))
+	p.AddHost(proxysql.Hostname("db-2"), proxysql.Weight(1))
+	p.AddHost(proxysql.Hostname("cache-1"), proxysql.Weight(2))
+	hosts, err := p.HostsLike(proxysql.Where(proxysql.Like("hostname", "db-%")), proxysql.OrderBy("weight"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(hosts) != 2 || hosts[0].Hostname() != "db-2" || hosts[1].Hostname() != "db-1" {
+		t.Fatalf("did not receive filtered and ordered hosts: %v", hosts)
+	}
+	if err := p.RemoveHostsLike(proxysql.OrderByDesc("weight"), proxysql.Limit(2)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	memory := p.Memory()
+	if len(memory) != 1 || memory[0].Hostname() != "db-2" {
+		t.Fatalf("did not remove the two heaviest hosts: %v", memory)
+	}
+	if _, err := p.All(proxysql.Limit(1)); err != proxysql.ErrConfigAllTableOnly {
+		t.Fatalf("All did not reject a limit: %v", err)
+	}
+}
+
+func TestRemoveHostRemovesIdenticalHostsOnly(t *testing.T) {
+	p := New()
+	host := proxysql.DefaultHost().SetHostname("a")
+	p.AddHosts(host, proxysql.DefaultHost().SetHostname("b"))
+	p.RemoveHost(proxysql.DefaultHost().SetHostname("b").SetWeight(2))
+	if len(p.Memory()) != 2 {
+		t.Fatalf("removed a host that was not identical: %v", p.Memory())
+	}
+	p.RemoveHosts(host)
+	memory := p.Memory()
+	if len(memory) != 1 || memory[0].Hostname() != "b" {
+		t.Fatalf("did not remove identical host: %v", memory)
+	}
+}
+
+func TestClearEmptiesMemory(t *testing.T) {
+	p := New()
+	p.AddHost(proxysql.Hostname("a"))
+	p.PersistChanges()
+	p.Clear()
+	entries, err := p.All()
+	if err != nil || len(entries) != 0 || entries == nil {
+		t.Fatalf("memory was not empty after clear: %v, %v", entries, err)
+	}
+	if len(p.Runtime()) != 1 {
+		t.Fatalf("runtime was cleared without persisting: %v", p.Runtime())
+	}
+}
+
+func TestAllErrorsLikeProxySQL(t *testing.T) {
+	p := New()
+	if _, err := p.All(proxysql.Table("runtime_mysql_servers"), proxysql.HostgroupID(1)); err != proxysql.ErrConfigAllTableOnly {
+		t.Fatalf("did not receive err when specifying hostgroup_id: %v", err)
+	}
+	if _, err := p.All(proxysql.Table("not a real table")); !errors.Is(err, proxysql.ErrConfigBadTable) {
+		t.Fatalf("did not receive err when specifying bad table: %v", err)
+	}
+}
+
+func TestSetErrorFailsEveryCall(t *testing.T) {
+	p := New()
+	mockErr := errors.New("mock")
+	p.SetError(mockErr)
+	if err := p.Ping(); err != mockErr {
+		t.Fatalf("ping did not return set error: %v", err)
+	}
+	if err := p.AddHost(proxysql.Hostname("a")); err != mockErr {
+		t.Fatalf("add host did not return set error: %v", err)
+	}
+	if err := p.PersistChanges(); err != mockErr {
+		t.Fatalf("persist did not return set error: %v", err)
+	}
+	if _, err := p.HostsLike(proxysql.Hostname("a")); err != mockErr {
+		t.Fatalf("hosts like did not return set error: %v", err)
+	}
+	p.SetError(nil)
+	if err := p.AddHost(proxysql.Hostname("a")); err != nil {
+		t.Fatalf("unexpected err after clearing error: %v", err)
+	}
+}
+
+func TestCloseFailsEveryCall(t *testing.T) {
+	p := New()
+	p.Close()
+	if err := p.Ping(); err != ErrClosed {
+		t.Fatalf("ping did not fail after close: %v", err)
+	}
+	if _, err := p.All(); err != ErrClosed {
+		t.Fatalf("all did not fail after close: %v", err)
+	}
+}
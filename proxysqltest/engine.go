@@ -0,0 +1,806 @@
+package proxysqltest
+
+// this file is for running statements against the in-memory admin tables
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type table struct {
+	schema *tableSchema
+	rows   [][]value
+}
+
+func (t *table) clone() *table {
+	rows := make([][]value, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = append([]value(nil), row...)
+	}
+	return &table{t.schema, rows}
+}
+
+type result struct {
+	columns  []string
+	rows     [][]value
+	affected int64
+	insertID int64
+}
+
+type database struct {
+	mut     sync.Mutex
+	version string
+	started time.Time
+	schemas map[string]*tableSchema
+	memory  map[string]*table
+	disk    map[string]*table
+	runtime map[string]*table
+}
+
+func newDatabase(version string) (*database, error) {
+	major, _ := parseVersion(version)
+	db := &database{
+		version: version,
+		started: time.Now(),
+		schemas: make(map[string]*tableSchema),
+		memory:  make(map[string]*table),
+		disk:    make(map[string]*table),
+		runtime: make(map[string]*table),
+	}
+	for _, ddl := range tableDefinitions(major) {
+		s, err := parseSchema(ddl)
+		if err != nil {
+			return nil, fmt.Errorf("bad table definition %q: %v", ddl, err)
+		}
+		db.schemas[s.name] = s
+	}
+	for _, name := range configTables {
+		db.memory[name] = &table{schema: db.schemas[name]}
+		db.disk[name] = &table{schema: db.schemas[name]}
+		db.runtime[name] = &table{schema: db.schemas[name]}
+	}
+	for _, variable := range defaultVariables(version) {
+		row := []value{variable[0], variable[1]}
+		db.memory["global_variables"].rows = append(db.memory["global_variables"].rows, row)
+	}
+	db.disk["global_variables"] = db.memory["global_variables"].clone()
+	db.runtime["global_variables"] = db.memory["global_variables"].clone()
+	return db, nil
+}
+
+func defaultVariables(version string) [][2]string {
+	return [][2]string{
+		{"admin-admin_credentials", "admin:admin"},
+		{"admin-mysql_ifaces", "0.0.0.0:6032"},
+		{"admin-read_only", "false"},
+		{"admin-refresh_interval", "2000"},
+		{"admin-stats_credentials", "stats:stats"},
+		{"admin-version", version},
+		{"mysql-default_schema", "information_schema"},
+		{"mysql-interfaces", "0.0.0.0:6033"},
+		{"mysql-max_connections", "2048"},
+		{"mysql-monitor_enabled", "true"},
+		{"mysql-monitor_password", "monitor"},
+		{"mysql-monitor_username", "monitor"},
+		{"mysql-server_version", "5.5.30"},
+		{"mysql-threads", "4"},
+	}
+}
+
+var (
+	adminCommand = regexp.MustCompile(`(?i)^\s*(load|save)\s+(mysql\s+servers|mysql\s+users|mysql\s+query\s+rules|mysql\s+variables|admin\s+variables|proxysql\s+servers)\s+(to|from)\s+(runtime|run|memory|mem|disk|config)\s*;?\s*$`)
+	setCommand   = regexp.MustCompile(`(?i)^\s*set\s+((?:admin|mysql)-[a-z0-9_]+)\s*=\s*(.*?)\s*;?\s*$`)
+	otherSet     = regexp.MustCompile(`(?i)^\s*set\s+`)
+)
+
+// the tables, and for variables the prefix of the rows, in each module
+// that LOAD and SAVE commands copy
+var modules = map[string]struct {
+	tables []string
+	prefix string
+}{
+	"MYSQL SERVERS":     {[]string{"mysql_servers", "mysql_replication_hostgroups"}, ""},
+	"MYSQL USERS":       {[]string{"mysql_users"}, ""},
+	"MYSQL QUERY RULES": {[]string{"mysql_query_rules"}, ""},
+	"MYSQL VARIABLES":   {[]string{"global_variables"}, "mysql-"},
+	"ADMIN VARIABLES":   {[]string{"global_variables"}, "admin-"},
+	"PROXYSQL SERVERS":  {[]string{"proxysql_servers"}, ""},
+}
+
+// exec runs a single statement
+func (db *database) exec(sql string) (*result, error) {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	if m := adminCommand.FindStringSubmatch(sql); m != nil {
+		return db.adminCommand(strings.ToLower(m[1]), strings.ToUpper(strings.Join(strings.Fields(m[2]), " ")), strings.ToLower(m[3]), strings.ToLower(m[4]))
+	}
+	if m := setCommand.FindStringSubmatch(sql); m != nil {
+		return db.set(strings.ToLower(m[1]), m[2])
+	}
+	if otherSet.MatchString(sql) {
+		// session variables such as SET NAMES are accepted and ignored
+		return &result{}, nil
+	}
+	stmt, err := parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	switch stmt := stmt.(type) {
+	case *selectStmt:
+		return db.selectRows(stmt)
+	case *insertStmt:
+		return db.insert(stmt)
+	case *deleteStmt:
+		return db.delete(stmt)
+	case *updateStmt:
+		return db.update(stmt)
+	case *pragmaStmt:
+		return db.pragma(stmt)
+	case *showTablesStmt:
+		return db.showTables(stmt)
+	}
+	return nil, fmt.Errorf("unsupported statement")
+}
+
+func (db *database) adminCommand(verb, module, direction, place string) (*result, error) {
+	var src, dst map[string]*table
+	toRuntime := place == "runtime" || place == "run"
+	toMemory := place == "memory" || place == "mem"
+	switch {
+	case place == "config":
+		if verb != "load" || direction != "from" {
+			return nil, fmt.Errorf("near \"%s\": syntax error", place)
+		}
+		return &result{}, nil
+	case verb == "load" && ((direction == "to" && toRuntime) || (direction == "from" && toMemory)):
+		src, dst = db.memory, db.runtime
+	case verb == "load" && ((direction == "from" && place == "disk") || (direction == "to" && toMemory)):
+		src, dst = db.disk, db.memory
+	case verb == "save" && ((direction == "to" && place == "disk") || (direction == "from" && toMemory)):
+		src, dst = db.memory, db.disk
+	case verb == "save" && ((direction == "from" && toRuntime) || (direction == "to" && toMemory)):
+		src, dst = db.runtime, db.memory
+	default:
+		return nil, fmt.Errorf("near \"%s\": syntax error", place)
+	}
+	m := modules[module]
+	for _, name := range m.tables {
+		if m.prefix == "" {
+			dst[name] = src[name].clone()
+			continue
+		}
+		copied := &table{schema: dst[name].schema}
+		for _, row := range dst[name].rows {
+			if !strings.HasPrefix(text(row[0]), m.prefix) {
+				copied.rows = append(copied.rows, row)
+			}
+		}
+		for _, row := range src[name].rows {
+			if strings.HasPrefix(text(row[0]), m.prefix) {
+				copied.rows = append(copied.rows, append([]value(nil), row...))
+			}
+		}
+		dst[name] = copied
+	}
+	return &result{}, nil
+}
+
+// SET mysql-variable = value updates global_variables, as ProxySQL does
+func (db *database) set(name, raw string) (*result, error) {
+	v := raw
+	if len(raw) >= 2 && (raw[0] == '\'' || raw[0] == '"') && raw[len(raw)-1] == raw[0] {
+		v = strings.Replace(raw[1:len(raw)-1], string(raw[0])+string(raw[0]), string(raw[0]), -1)
+	}
+	t := db.memory["global_variables"]
+	affected := int64(0)
+	for _, row := range t.rows {
+		if text(row[0]) == name {
+			row[1] = v
+			affected++
+		}
+	}
+	return &result{affected: affected}, nil
+}
+
+// resolve finds the table a statement refers to. Runtime, stats and monitor
+// tables are generated for each statement, so writes to them have no effect
+func (db *database) resolve(name tableName) (*table, error) {
+	base := strings.ToLower(name.name)
+	switch name.schema {
+	case "", "main":
+		if t, ok := db.memory[base]; ok {
+			return t, nil
+		}
+		if strings.HasPrefix(base, "runtime_") {
+			if t, ok := db.runtime[strings.TrimPrefix(base, "runtime_")]; ok {
+				c := t.clone()
+				c.schema = c.schema.renamed(base)
+				return c, nil
+			}
+		}
+		if contains(statsTables, base) {
+			return db.stats(base), nil
+		}
+	case "disk":
+		if t, ok := db.disk[base]; ok {
+			return t, nil
+		}
+	case "stats":
+		if contains(statsTables, base) {
+			return db.stats(base), nil
+		}
+	case "monitor":
+		if contains(monitorTables, base) {
+			return db.monitor(base), nil
+		}
+	}
+	return nil, fmt.Errorf("no such table: %s", name)
+}
+
+// stats tables hold canned data derived from the runtime configuration
+func (db *database) stats(name string) *table {
+	t := &table{schema: db.schemas[name]}
+	switch name {
+	case "stats_mysql_connection_pool":
+		servers := db.runtime["mysql_servers"]
+		s := servers.schema
+		for _, server := range servers.rows {
+			row := []value{server[s.column("hostgroup_id")], server[s.column("hostname")], server[s.column("port")], server[s.column("status")]}
+			for len(row) < len(t.schema.columns) {
+				row = append(row, int64(0))
+			}
+			t.rows = append(t.rows, row)
+		}
+	case "stats_mysql_global":
+		uptime := int64(time.Since(db.started).Seconds())
+		t.rows = [][]value{
+			{"ProxySQL_Uptime", text(uptime)},
+			{"Active_Transactions", "0"},
+			{"Client_Connections_aborted", "0"},
+			{"Client_Connections_connected", "0"},
+			{"Client_Connections_created", "0"},
+			{"Server_Connections_aborted", "0"},
+			{"Server_Connections_connected", "0"},
+			{"Server_Connections_created", "0"},
+			{"Questions", "0"},
+			{"Slow_queries", "0"},
+		}
+	case "stats_mysql_commands_counters":
+		for _, command := range []string{"ALTER_TABLE", "BEGIN", "COMMIT", "DELETE", "INSERT", "ROLLBACK", "SELECT", "SET", "SHOW", "UPDATE"} {
+			row := []value{command}
+			for len(row) < len(t.schema.columns) {
+				row = append(row, int64(0))
+			}
+			t.rows = append(t.rows, row)
+		}
+	}
+	return t
+}
+
+// monitor tables hold a successful check of every runtime server
+func (db *database) monitor(name string) *table {
+	t := &table{schema: db.schemas[name]}
+	servers := db.runtime["mysql_servers"]
+	s := servers.schema
+	seen := make(map[string]bool)
+	for _, server := range servers.rows {
+		key := text(server[s.column("hostname")]) + ":" + text(server[s.column("port")])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		t.rows = append(t.rows, []value{server[s.column("hostname")], server[s.column("port")], db.started.UnixNano() / 1000, int64(100), nil})
+	}
+	return t
+}
+
+func (db *database) variable(name string) (value, error) {
+	switch name {
+	case "version":
+		return db.version, nil
+	case "version_comment":
+		return "(ProxySQL Admin Module)", nil
+	case "max_allowed_packet":
+		return int64(67108864), nil
+	}
+	return nil, fmt.Errorf("no such variable: @@%s", name)
+}
+
+// rowEnv evaluates expressions against one row of a table. For aggregate
+// queries it also holds every row that the aggregate is computed over
+type rowEnv struct {
+	db    *database
+	table *table
+	row   []value
+	group [][]value
+}
+
+func (e *rowEnv) column(qualifier, name string) (value, error) {
+	if e.table == nil || (qualifier != "" && !strings.EqualFold(qualifier, e.table.schema.name)) {
+		if qualifier != "" {
+			return nil, fmt.Errorf("no such column: %s.%s", qualifier, name)
+		}
+		return nil, fmt.Errorf("no such column: %s", name)
+	}
+	i := e.table.schema.column(name)
+	if i < 0 {
+		return nil, fmt.Errorf("no such column: %s", name)
+	}
+	if e.row == nil {
+		return nil, nil
+	}
+	return e.row[i], nil
+}
+
+func (e *rowEnv) variable(name string) (value, error) {
+	return e.db.variable(name)
+}
+
+func (e *rowEnv) aggregate(f *funcExpr) (value, error) {
+	if e.group == nil {
+		return nil, fmt.Errorf("misuse of aggregate function %s()", f.name)
+	}
+	if f.name == "count" && f.star {
+		return int64(len(e.group)), nil
+	}
+	if len(f.args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", f.name)
+	}
+	var agg value
+	count := int64(0)
+	for _, row := range e.group {
+		v, err := f.args[0].eval(&rowEnv{db: e.db, table: e.table, row: row})
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		count++
+		switch {
+		case agg == nil:
+			agg = numeric(v)
+		case f.name == "min" && compare(v, agg) < 0, f.name == "max" && compare(v, agg) > 0:
+			agg = v
+		case f.name == "sum":
+			agg, _ = arithmetic("+", agg, numeric(v))
+		}
+	}
+	if f.name == "count" {
+		return count, nil
+	}
+	return agg, nil
+}
+
+// matches reports whether a row satisfies a where clause
+func (db *database) matches(t *table, row []value, where expr) (bool, error) {
+	if where == nil {
+		return true, nil
+	}
+	v, err := where.eval(&rowEnv{db: db, table: t, row: row})
+	if err != nil {
+		return false, err
+	}
+	return v != nil && truthy(v), nil
+}
+
+func (db *database) selectRows(stmt *selectStmt) (*result, error) {
+	t := &table{schema: &tableSchema{index: map[string]int{}}, rows: [][]value{{}}}
+	if stmt.from != nil {
+		var err error
+		if t, err = db.resolve(*stmt.from); err != nil {
+			return nil, err
+		}
+	}
+	var rows [][]value
+	for _, row := range t.rows {
+		ok, err := db.matches(t, row, stmt.where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+	// expand projections
+	var columns []string
+	var exprs []expr
+	aggregate := false
+	for _, proj := range stmt.projections {
+		if proj.star {
+			if stmt.from == nil {
+				return nil, fmt.Errorf("no tables specified")
+			}
+			for _, col := range t.schema.columns {
+				columns = append(columns, col.name)
+				exprs = append(exprs, &colExpr{name: col.name})
+			}
+			continue
+		}
+		columns = append(columns, proj.name)
+		exprs = append(exprs, proj.x)
+		aggregate = aggregate || hasAggregate(proj.x)
+	}
+	type output struct {
+		env    *rowEnv
+		values []value
+	}
+	var out []output
+	if aggregate {
+		env := &rowEnv{db: db, table: t, group: rows}
+		if len(rows) > 0 {
+			env.row = rows[len(rows)-1]
+		}
+		if rows == nil {
+			env.group = [][]value{}
+		}
+		rows = [][]value{env.row}
+		values, err := project(env, exprs)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, output{env, values})
+	} else {
+		for _, row := range rows {
+			env := &rowEnv{db: db, table: t, row: row}
+			values, err := project(env, exprs)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, output{env, values})
+		}
+	}
+	if len(stmt.orderBy) > 0 {
+		var sortErr error
+		key := func(o output, term orderTerm) value {
+			if lit, ok := term.x.(*litExpr); ok {
+				if n, ok := lit.v.(int64); ok && n >= 1 && int(n) <= len(o.values) {
+					return o.values[n-1]
+				}
+			}
+			v, err := term.x.eval(o.env)
+			if err != nil {
+				sortErr = err
+			}
+			return v
+		}
+		sort.SliceStable(out, func(i, j int) bool {
+			for _, term := range stmt.orderBy {
+				a, b := key(out[i], term), key(out[j], term)
+				c := 0
+				switch {
+				case a == nil && b == nil:
+				case a == nil:
+					c = -1
+				case b == nil:
+					c = 1
+				default:
+					c = compare(a, b)
+				}
+				if term.desc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+		if sortErr != nil {
+			return nil, sortErr
+		}
+	}
+	offset, limit := 0, len(out)
+	if stmt.offset != nil {
+		v, err := stmt.offset.eval(&rowEnv{db: db})
+		if err != nil {
+			return nil, err
+		}
+		n, _ := numeric(v).(int64)
+		offset = int(n)
+	}
+	if stmt.limit != nil {
+		v, err := stmt.limit.eval(&rowEnv{db: db})
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := numeric(v).(int64); ok && n >= 0 {
+			limit = int(n)
+		}
+	}
+	res := &result{columns: columns}
+	for i := offset; i < len(out) && i < offset+limit; i++ {
+		res.rows = append(res.rows, out[i].values)
+	}
+	return res, nil
+}
+
+func project(e *rowEnv, exprs []expr) ([]value, error) {
+	values := make([]value, len(exprs))
+	for i, x := range exprs {
+		v, err := x.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// validate checks the NOT NULL and CHECK constraints of a row
+func (db *database) validate(t *table, row []value) error {
+	s := t.schema
+	for i, col := range s.columns {
+		if col.notNull && row[i] == nil {
+			return fmt.Errorf("NOT NULL constraint failed: %s.%s", s.name, col.name)
+		}
+	}
+	for _, check := range s.checks {
+		v, err := check.eval(&rowEnv{db: db, table: t, row: row})
+		if err != nil {
+			return err
+		}
+		if v != nil && !truthy(v) {
+			return fmt.Errorf("CHECK constraint failed: %s", s.name)
+		}
+	}
+	return nil
+}
+
+// conflicts returns the indexes of rows that share a unique key with row
+func conflicts(t *table, rows [][]value, row []value) []int {
+	var found []int
+	for i, other := range rows {
+		for _, key := range t.schema.unique {
+			same := true
+			for _, col := range key {
+				if row[col] == nil || other[col] == nil || compare(row[col], other[col]) != 0 {
+					same = false
+					break
+				}
+			}
+			if same {
+				found = append(found, i)
+				break
+			}
+		}
+	}
+	return found
+}
+
+func uniqueError(t *table, rows [][]value, row []value) error {
+	for _, key := range t.schema.unique {
+		for _, other := range rows {
+			same := true
+			for _, col := range key {
+				if row[col] == nil || other[col] == nil || compare(row[col], other[col]) != 0 {
+					same = false
+					break
+				}
+			}
+			if same {
+				names := make([]string, len(key))
+				for i, col := range key {
+					names[i] = t.schema.name + "." + t.schema.columns[col].name
+				}
+				return fmt.Errorf("UNIQUE constraint failed: %s", strings.Join(names, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func (db *database) insert(stmt *insertStmt) (*result, error) {
+	t, err := db.resolve(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	s := t.schema
+	targets := make([]int, 0, len(s.columns))
+	if stmt.columns == nil {
+		for i := range s.columns {
+			targets = append(targets, i)
+		}
+	} else {
+		for _, name := range stmt.columns {
+			i := s.column(name)
+			if i < 0 {
+				return nil, fmt.Errorf("table %s has no column named %s", s.name, name)
+			}
+			targets = append(targets, i)
+		}
+	}
+	var input [][]value
+	if stmt.query != nil {
+		res, err := db.selectRows(stmt.query)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.columns) != len(targets) {
+			return nil, fmt.Errorf("table %s has %d columns but %d values were supplied", s.name, len(targets), len(res.columns))
+		}
+		input = res.rows
+	} else {
+		for _, exprs := range stmt.rows {
+			if len(exprs) != len(targets) {
+				if stmt.columns == nil {
+					return nil, fmt.Errorf("table %s has %d columns but %d values were supplied", s.name, len(targets), len(exprs))
+				}
+				return nil, fmt.Errorf("%d values for %d columns", len(exprs), len(targets))
+			}
+			values, err := project(&rowEnv{db: db}, exprs)
+			if err != nil {
+				return nil, err
+			}
+			input = append(input, values)
+		}
+	}
+	// statements are atomic, so work on a copy of the rows
+	rows := append([][]value(nil), t.rows...)
+	res := &result{}
+	for _, values := range input {
+		row := make([]value, len(s.columns))
+		for i, col := range s.columns {
+			row[i] = col.def
+		}
+		for i, target := range targets {
+			row[target] = s.columns[target].affinity(values[i])
+		}
+		for i, col := range s.columns {
+			if col.autoinc && row[i] == nil {
+				next := int64(1)
+				for _, other := range rows {
+					if n, ok := other[i].(int64); ok && n >= next {
+						next = n + 1
+					}
+				}
+				row[i] = next
+			}
+			if col.pk > 0 && col.autoinc {
+				res.insertID, _ = row[i].(int64)
+			}
+		}
+		if err := db.validate(t, row); err != nil {
+			return nil, err
+		}
+		if found := conflicts(t, rows, row); len(found) > 0 {
+			switch stmt.conflict {
+			case "ignore":
+				continue
+			case "replace":
+				for i := len(found) - 1; i >= 0; i-- {
+					rows = append(rows[:found[i]], rows[found[i]+1:]...)
+				}
+			default:
+				return nil, uniqueError(t, rows, row)
+			}
+		}
+		rows = append(rows, row)
+		res.affected++
+	}
+	t.rows = rows
+	return res, nil
+}
+
+func (db *database) delete(stmt *deleteStmt) (*result, error) {
+	t, err := db.resolve(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	var kept [][]value
+	res := &result{}
+	for _, row := range t.rows {
+		ok, err := db.matches(t, row, stmt.where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res.affected++
+			continue
+		}
+		kept = append(kept, row)
+	}
+	t.rows = kept
+	return res, nil
+}
+
+func (db *database) update(stmt *updateStmt) (*result, error) {
+	t, err := db.resolve(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	s := t.schema
+	for _, set := range stmt.set {
+		if s.column(set.column) < 0 {
+			return nil, fmt.Errorf("no such column: %s", set.column)
+		}
+	}
+	rows := make([][]value, len(t.rows))
+	res := &result{}
+	for i, row := range t.rows {
+		rows[i] = row
+		ok, err := db.matches(t, row, stmt.where)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		updated := append([]value(nil), row...)
+		for _, set := range stmt.set {
+			v, err := set.x.eval(&rowEnv{db: db, table: t, row: row})
+			if err != nil {
+				return nil, err
+			}
+			col := s.column(set.column)
+			updated[col] = s.columns[col].affinity(v)
+		}
+		if err := db.validate(t, updated); err != nil {
+			return nil, err
+		}
+		rows[i] = updated
+		res.affected++
+	}
+	for i, row := range rows {
+		if err := uniqueError(t, rows[:i], row); err != nil {
+			return nil, err
+		}
+	}
+	t.rows = rows
+	return res, nil
+}
+
+func (db *database) pragma(stmt *pragmaStmt) (*result, error) {
+	if stmt.name != "table_info" {
+		// like SQLite, unknown pragmas are ignored
+		return &result{}, nil
+	}
+	res := &result{columns: []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}}
+	name := tableName{name: stmt.arg}
+	if i := strings.Index(stmt.arg, "."); i >= 0 {
+		name = tableName{strings.ToLower(stmt.arg[:i]), stmt.arg[i+1:]}
+	}
+	t, err := db.resolve(name)
+	if err != nil {
+		return res, nil
+	}
+	res.rows = t.schema.tableInfo()
+	return res, nil
+}
+
+func (db *database) showTables(stmt *showTablesStmt) (*result, error) {
+	var names []string
+	switch stmt.schema {
+	case "", "main":
+		for _, name := range configTables {
+			names = append(names, name, "runtime_"+name)
+		}
+	case "disk":
+		names = append(names, configTables...)
+	case "stats":
+		names = append(names, statsTables...)
+	case "monitor":
+		names = append(names, monitorTables...)
+	default:
+		return nil, fmt.Errorf("unknown database %s", stmt.schema)
+	}
+	sort.Strings(names)
+	res := &result{columns: []string{"tables"}}
+	for _, name := range names {
+		res.rows = append(res.rows, []value{name})
+	}
+	return res, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
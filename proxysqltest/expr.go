@@ -0,0 +1,524 @@
+package proxysqltest
+
+// this file is for values, and the expressions used in where clauses,
+// projections and check constraints
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// a value is one of nil (NULL), int64, float64 or string, as in SQLite
+type value interface{}
+
+// env resolves the names an expression refers to
+type env interface {
+	column(table, name string) (value, error)
+	variable(name string) (value, error)
+	aggregate(f *funcExpr) (value, error)
+}
+
+type expr interface {
+	eval(e env) (value, error)
+}
+
+type litExpr struct {
+	v value
+}
+
+type colExpr struct {
+	table string
+	name  string
+}
+
+type varExpr struct {
+	name string
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binExpr struct {
+	op   string
+	l, r expr
+}
+
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+type likeExpr struct {
+	x, pattern, escape expr
+	not                bool
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+type betweenExpr struct {
+	x, lo, hi expr
+	not       bool
+}
+
+type funcExpr struct {
+	name string
+	args []expr
+	star bool
+}
+
+var aggregates = map[string]bool{"count": true, "min": true, "max": true, "sum": true}
+
+func (x *litExpr) eval(e env) (value, error) {
+	return x.v, nil
+}
+
+func (x *colExpr) eval(e env) (value, error) {
+	return e.column(x.table, x.name)
+}
+
+func (x *varExpr) eval(e env) (value, error) {
+	return e.variable(x.name)
+}
+
+func (x *unaryExpr) eval(e env) (value, error) {
+	v, err := x.x.eval(e)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	switch x.op {
+	case "-":
+		switch n := numeric(v).(type) {
+		case int64:
+			return -n, nil
+		case float64:
+			return -n, nil
+		}
+		return int64(0), nil
+	case "not":
+		return boolValue(!truthy(v)), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", x.op)
+}
+
+func (x *binExpr) eval(e env) (value, error) {
+	l, err := x.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	// and/or short circuit, with NULL treated as unknown
+	switch x.op {
+	case "and":
+		if l != nil && !truthy(l) {
+			return int64(0), nil
+		}
+		r, err := x.r.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && !truthy(r) {
+			return int64(0), nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return int64(1), nil
+	case "or":
+		if l != nil && truthy(l) {
+			return int64(1), nil
+		}
+		r, err := x.r.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && truthy(r) {
+			return int64(1), nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return int64(0), nil
+	}
+	r, err := x.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	switch x.op {
+	case "=", "==":
+		return boolValue(compare(l, r) == 0), nil
+	case "!=", "<>":
+		return boolValue(compare(l, r) != 0), nil
+	case "<":
+		return boolValue(compare(l, r) < 0), nil
+	case "<=":
+		return boolValue(compare(l, r) <= 0), nil
+	case ">":
+		return boolValue(compare(l, r) > 0), nil
+	case ">=":
+		return boolValue(compare(l, r) >= 0), nil
+	case "||":
+		return text(l) + text(r), nil
+	}
+	return arithmetic(x.op, numeric(l), numeric(r))
+}
+
+func (x *inExpr) eval(e env) (value, error) {
+	v, err := x.x.eval(e)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	sawNull := false
+	for _, item := range x.list {
+		iv, err := item.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		if iv == nil {
+			sawNull = true
+			continue
+		}
+		if compare(v, iv) == 0 {
+			return boolValue(!x.not), nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+	return boolValue(x.not), nil
+}
+
+func (x *likeExpr) eval(e env) (value, error) {
+	v, err := x.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	p, err := x.pattern.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || p == nil {
+		return nil, nil
+	}
+	escape := byte(0)
+	if x.escape != nil {
+		ev, err := x.escape.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		if s := text(ev); len(s) == 1 {
+			escape = s[0]
+		} else {
+			return nil, fmt.Errorf("ESCAPE expression must be a single character")
+		}
+	}
+	matched := like(strings.ToLower(text(p)), strings.ToLower(text(v)), escape)
+	return boolValue(matched != x.not), nil
+}
+
+func (x *isNullExpr) eval(e env) (value, error) {
+	v, err := x.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	return boolValue((v == nil) != x.not), nil
+}
+
+func (x *betweenExpr) eval(e env) (value, error) {
+	v, err := x.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	lo, err := x.lo.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := x.hi.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || lo == nil || hi == nil {
+		return nil, nil
+	}
+	in := compare(v, lo) >= 0 && compare(v, hi) <= 0
+	return boolValue(in != x.not), nil
+}
+
+func (x *funcExpr) eval(e env) (value, error) {
+	if aggregates[x.name] {
+		return e.aggregate(x)
+	}
+	args := make([]value, len(x.args))
+	for i, arg := range x.args {
+		v, err := arg.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	arity := map[string]int{"upper": 1, "lower": 1, "length": 1, "abs": 1, "ifnull": 2, "instr": 2}
+	if n, fixed := arity[x.name]; fixed && n != len(args) {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", x.name)
+	}
+	switch x.name {
+	case "upper", "lower", "length", "abs":
+		if args[0] == nil {
+			return nil, nil
+		}
+		switch x.name {
+		case "upper":
+			return strings.ToUpper(text(args[0])), nil
+		case "lower":
+			return strings.ToLower(text(args[0])), nil
+		case "length":
+			return int64(len(text(args[0]))), nil
+		}
+		if n, ok := numeric(args[0]).(float64); ok {
+			if n < 0 {
+				return -n, nil
+			}
+			return n, nil
+		}
+		n, _ := numeric(args[0]).(int64)
+		if n < 0 {
+			return -n, nil
+		}
+		return n, nil
+	case "ifnull", "coalesce":
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	case "instr":
+		if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return int64(strings.Index(text(args[0]), text(args[1])) + 1), nil
+	}
+	return nil, fmt.Errorf("no such function: %s", x.name)
+}
+
+// reports whether an expression uses an aggregate function
+func hasAggregate(x expr) bool {
+	switch x := x.(type) {
+	case *funcExpr:
+		if aggregates[x.name] {
+			return true
+		}
+		for _, arg := range x.args {
+			if hasAggregate(arg) {
+				return true
+			}
+		}
+	case *unaryExpr:
+		return hasAggregate(x.x)
+	case *binExpr:
+		return hasAggregate(x.l) || hasAggregate(x.r)
+	}
+	return false
+}
+
+func boolValue(b bool) value {
+	if b {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func truthy(v value) bool {
+	switch n := numeric(v).(type) {
+	case int64:
+		return n != 0
+	case float64:
+		return n != 0
+	}
+	return false
+}
+
+// numeric converts a value to int64 or float64 where it looks like a number,
+// leaving other values unchanged
+func numeric(v value) value {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	s = strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return v
+}
+
+func isNumber(v value) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v value) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// compare orders two non NULL values. Numbers compare numerically, a string
+// that looks like a number compares as one against a number, and otherwise
+// numbers sort before strings
+func compare(a, b value) int {
+	if isNumber(a) != isNumber(b) {
+		if isNumber(a) {
+			b = numeric(b)
+		} else {
+			a = numeric(a)
+		}
+	}
+	switch {
+	case isNumber(a) && isNumber(b):
+		if x, ok := a.(int64); ok {
+			if y, ok := b.(int64); ok {
+				switch {
+				case x < y:
+					return -1
+				case x > y:
+					return 1
+				}
+				return 0
+			}
+		}
+		x, y := toFloat(a), toFloat(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case isNumber(a):
+		return -1
+	case isNumber(b):
+		return 1
+	}
+	return strings.Compare(text(a), text(b))
+}
+
+func arithmetic(op string, l, r value) (value, error) {
+	if !isNumber(l) {
+		l = int64(0)
+	}
+	if !isNumber(r) {
+		r = int64(0)
+	}
+	x, xok := l.(int64)
+	y, yok := r.(int64)
+	if xok && yok {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			if y == 0 {
+				return nil, nil
+			}
+			return x / y, nil
+		case "%":
+			if y == 0 {
+				return nil, nil
+			}
+			return x % y, nil
+		}
+	}
+	fx, fy := toFloat(l), toFloat(r)
+	switch op {
+	case "+":
+		return fx + fy, nil
+	case "-":
+		return fx - fy, nil
+	case "*":
+		return fx * fy, nil
+	case "/", "%":
+		if fy == 0 {
+			return nil, nil
+		}
+		if op == "%" {
+			return int64(fx) % int64(fy), nil
+		}
+		return fx / fy, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+// text renders a value the way it is sent to clients
+func text(v value) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// like matches SQL LIKE patterns, where % matches any run of characters and
+// _ matches a single one
+func like(pattern, s string, escape byte) bool {
+	for len(pattern) > 0 {
+		c := pattern[0]
+		switch {
+		case escape != 0 && c == escape && len(pattern) > 1:
+			if len(s) == 0 || s[0] != pattern[1] {
+				return false
+			}
+			pattern, s = pattern[2:], s[1:]
+		case c == '%':
+			for len(pattern) > 0 && pattern[0] == '%' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if like(pattern, s[i:], escape) {
+					return true
+				}
+			}
+			return false
+		case c == '_':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		default:
+			if len(s) == 0 || s[0] != c {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
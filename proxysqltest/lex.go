@@ -0,0 +1,137 @@
+package proxysqltest
+
+// this file is for splitting admin statements into tokens
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokSymbol
+	tokVariable
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// is reports whether the token is the given keyword or symbol, ignoring case
+func (t token) is(s string) bool {
+	return (t.kind == tokIdent || t.kind == tokSymbol) && strings.EqualFold(t.text, s)
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of statement"
+	}
+	return t.text
+}
+
+var symbols = []string{"<=", ">=", "<>", "!=", "==", "||", "(", ")", ",", ";", "*", "=", "<", ">", "+", "-", "/", "%", "."}
+
+func lex(sql string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unrecognized token: \"%s\"", sql[i:])
+			}
+			i += end + 4
+		case c == '\'' || c == '"':
+			text, n, err := lexQuoted(sql[i:], c)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, text})
+			i += n
+		case c == '`':
+			text, n, err := lexQuoted(sql[i:], c)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokIdent, text})
+			i += n
+		case c == '@' && strings.HasPrefix(sql[i:], "@@"):
+			j := i + 2
+			for j < len(sql) && (isIdentChar(sql[j]) || sql[j] == '-' || sql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokVariable, strings.ToLower(sql[i+2 : j])})
+			i = j
+		case isDigit(c):
+			j := i
+			for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, sql[i:j]})
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, sql[i:j]})
+			i = j
+		default:
+			matched := false
+			for _, s := range symbols {
+				if strings.HasPrefix(sql[i:], s) {
+					tokens = append(tokens, token{tokSymbol, s})
+					i += len(s)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unrecognized token: \"%c\"", c)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// reads a quoted string starting at s[0], where a doubled quote is an
+// escaped quote. Returns the unquoted text and the length consumed
+func lexQuoted(s string, quote byte) (string, int, error) {
+	var b strings.Builder
+	i := 1
+	for i < len(s) {
+		if s[i] == quote {
+			if i+1 < len(s) && s[i+1] == quote {
+				b.WriteByte(quote)
+				i += 2
+				continue
+			}
+			return b.String(), i + 1, nil
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return "", 0, fmt.Errorf("unrecognized token: \"%s\"", s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
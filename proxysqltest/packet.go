@@ -0,0 +1,210 @@
+package proxysqltest
+
+// this file is for reading and writing MySQL protocol packets
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net"
+)
+
+const (
+	clientLongPassword     = 0x00000001
+	clientFoundRows        = 0x00000002
+	clientLongFlag         = 0x00000004
+	clientConnectWithDB    = 0x00000008
+	clientProtocol41       = 0x00000200
+	clientSSL              = 0x00000800
+	clientTransactions     = 0x00002000
+	clientSecureConn       = 0x00008000
+	clientMultiResults     = 0x00020000
+	clientPluginAuth       = 0x00080000
+	clientPluginAuthLenEnc = 0x00200000
+
+	serverCapabilities = clientLongPassword | clientFoundRows | clientLongFlag | clientConnectWithDB |
+		clientProtocol41 | clientTransactions | clientSecureConn | clientMultiResults | clientPluginAuth | clientPluginAuthLenEnc
+
+	statusAutocommit = 0x0002
+
+	comQuit        = 0x01
+	comInitDB      = 0x02
+	comQuery       = 0x03
+	comPing        = 0x0e
+	comStmtPrepare = 0x16
+
+	typeVarString = 0xfd
+	charsetUTF8   = 33
+
+	maxPacketSize = 1<<24 - 1
+)
+
+type packetConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	seq  byte
+}
+
+func newPacketConn(conn net.Conn) *packetConn {
+	return &packetConn{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// readPacket reads a whole payload, joining packets split at 16MB
+func (c *packetConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return nil, err
+		}
+		size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		c.seq = header[3] + 1
+		data := make([]byte, size)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		payload = append(payload, data...)
+		if size < maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+func (c *packetConn) writePacket(payload []byte) error {
+	for {
+		size := len(payload)
+		if size > maxPacketSize {
+			size = maxPacketSize
+		}
+		header := []byte{byte(size), byte(size >> 8), byte(size >> 16), c.seq}
+		c.seq++
+		if _, err := c.conn.Write(append(header, payload[:size]...)); err != nil {
+			return err
+		}
+		payload = payload[size:]
+		if size < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+func (c *packetConn) writeOK(affected, insertID int64) error {
+	p := []byte{0x00}
+	p = appendLenEncInt(p, uint64(affected))
+	p = appendLenEncInt(p, uint64(insertID))
+	p = append(p, byte(statusAutocommit), byte(statusAutocommit>>8), 0, 0)
+	return c.writePacket(p)
+}
+
+func (c *packetConn) writeError(code uint16, state, message string) error {
+	p := []byte{0xff, byte(code), byte(code >> 8), '#'}
+	p = append(p, state...)
+	p = append(p, message...)
+	return c.writePacket(p)
+}
+
+func (c *packetConn) writeEOF() error {
+	return c.writePacket([]byte{0xfe, 0, 0, byte(statusAutocommit), byte(statusAutocommit >> 8)})
+}
+
+// writeResult sends a text result set where every column is a string,
+// as ProxySQL's admin interface does
+func (c *packetConn) writeResult(table string, res *result) error {
+	if err := c.writePacket(appendLenEncInt(nil, uint64(len(res.columns)))); err != nil {
+		return err
+	}
+	for _, name := range res.columns {
+		p := appendLenEncString(nil, "def")
+		p = appendLenEncString(p, "main")
+		p = appendLenEncString(p, table)
+		p = appendLenEncString(p, table)
+		p = appendLenEncString(p, name)
+		p = appendLenEncString(p, name)
+		p = append(p, 0x0c, charsetUTF8, 0)
+		p = append(p, 0xff, 0xff, 0, 0) // column length
+		p = append(p, typeVarString, 0, 0, 0, 0, 0)
+		if err := c.writePacket(p); err != nil {
+			return err
+		}
+	}
+	if err := c.writeEOF(); err != nil {
+		return err
+	}
+	for _, row := range res.rows {
+		var p []byte
+		for _, v := range row {
+			if v == nil {
+				p = append(p, 0xfb)
+				continue
+			}
+			p = appendLenEncString(p, text(v))
+		}
+		if err := c.writePacket(p); err != nil {
+			return err
+		}
+	}
+	return c.writeEOF()
+}
+
+func appendLenEncInt(b []byte, n uint64) []byte {
+	switch {
+	case n < 251:
+		return append(b, byte(n))
+	case n < 1<<16:
+		return append(b, 0xfc, byte(n), byte(n>>8))
+	case n < 1<<24:
+		return append(b, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	}
+	b = append(b, 0xfe)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+func appendLenEncString(b []byte, s string) []byte {
+	return append(appendLenEncInt(b, uint64(len(s))), s...)
+}
+
+// readLenEncInt returns the integer and the bytes it used
+func readLenEncInt(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] {
+	case 0xfc:
+		if len(b) < 3 {
+			return 0, 0
+		}
+		return uint64(b[1]) | uint64(b[2])<<8, 3
+	case 0xfd:
+		if len(b) < 4 {
+			return 0, 0
+		}
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+	case 0xfe:
+		if len(b) < 9 {
+			return 0, 0
+		}
+		return binary.LittleEndian.Uint64(b[1:9]), 9
+	}
+	return uint64(b[0]), 1
+}
+
+// nativePassword computes the mysql_native_password response to a scramble:
+// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+func nativePassword(scramble []byte, password string) []byte {
+	if password == "" {
+		return nil
+	}
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	h := sha1.New()
+	h.Write(scramble)
+	h.Write(stage2[:])
+	token := h.Sum(nil)
+	for i := range token {
+		token[i] ^= stage1[i]
+	}
+	return token
+}
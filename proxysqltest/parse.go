@@ -0,0 +1,729 @@
+package proxysqltest
+
+// this file is for parsing the SQL statements the admin interface accepts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type statement interface{}
+
+type tableName struct {
+	schema string
+	name   string
+}
+
+func (t tableName) String() string {
+	if t.schema == "" || t.schema == "main" {
+		return t.name
+	}
+	return t.schema + "." + t.name
+}
+
+type projection struct {
+	x     expr
+	name  string
+	star  bool
+	table string // for table.*
+}
+
+type orderTerm struct {
+	x    expr
+	desc bool
+}
+
+type selectStmt struct {
+	projections []projection
+	from        *tableName
+	where       expr
+	orderBy     []orderTerm
+	limit       expr
+	offset      expr
+}
+
+type insertStmt struct {
+	conflict string // "", "replace" or "ignore"
+	table    tableName
+	columns  []string
+	rows     [][]expr
+	query    *selectStmt
+}
+
+type deleteStmt struct {
+	table tableName
+	where expr
+}
+
+type assignment struct {
+	column string
+	x      expr
+}
+
+type updateStmt struct {
+	table tableName
+	set   []assignment
+	where expr
+}
+
+type pragmaStmt struct {
+	name string
+	arg  string
+}
+
+type showTablesStmt struct {
+	schema string
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(sql string) (statement, error) {
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	// allow a single trailing semicolon
+	if n := len(p.tokens); n > 1 && p.tokens[n-2].is(";") {
+		p.tokens = append(p.tokens[:n-2], p.tokens[n-1])
+	}
+	var stmt statement
+	switch {
+	case p.peek().is("select"):
+		stmt, err = p.parseSelect()
+	case p.peek().is("insert"), p.peek().is("replace"):
+		stmt, err = p.parseInsert()
+	case p.peek().is("delete"):
+		stmt, err = p.parseDelete()
+	case p.peek().is("update"):
+		stmt, err = p.parseUpdate()
+	case p.peek().is("pragma"):
+		stmt, err = p.parsePragma()
+	case p.peek().is("show"):
+		stmt, err = p.parseShow()
+	default:
+		return nil, p.syntaxError()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.syntaxError()
+	}
+	return stmt, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given keyword or symbol
+func (p *parser) accept(s string) bool {
+	if p.peek().is(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+func (p *parser) syntaxError() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("incomplete input")
+	}
+	return fmt.Errorf("near \"%s\": syntax error", t.text)
+}
+
+var reserved = map[string]bool{
+	"select": true, "from": true, "where": true, "and": true, "or": true, "not": true,
+	"in": true, "like": true, "is": true, "null": true, "order": true, "by": true,
+	"limit": true, "offset": true, "insert": true, "into": true, "values": true,
+	"delete": true, "update": true, "set": true, "between": true, "escape": true,
+	"asc": true, "desc": true, "as": true,
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent || reserved[strings.ToLower(t.text)] {
+		return "", p.syntaxError()
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) tableName() (tableName, error) {
+	name, err := p.ident()
+	if err != nil {
+		return tableName{}, err
+	}
+	if p.accept(".") {
+		table, err := p.ident()
+		if err != nil {
+			return tableName{}, err
+		}
+		return tableName{strings.ToLower(name), table}, nil
+	}
+	return tableName{name: name}, nil
+}
+
+func (p *parser) parseSelect() (*selectStmt, error) {
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	stmt := &selectStmt{}
+	for {
+		proj, err := p.parseProjection()
+		if err != nil {
+			return nil, err
+		}
+		stmt.projections = append(stmt.projections, proj)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("from") {
+		table, err := p.tableName()
+		if err != nil {
+			return nil, err
+		}
+		stmt.from = &table
+	}
+	if p.accept("where") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.where = where
+	}
+	if p.accept("order") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			term := orderTerm{x: x}
+			if p.accept("desc") {
+				term.desc = true
+			} else {
+				p.accept("asc")
+			}
+			stmt.orderBy = append(stmt.orderBy, term)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("limit") {
+		limit, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.limit = limit
+		if p.accept("offset") {
+			if stmt.offset, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		} else if p.accept(",") {
+			// limit offset, count
+			stmt.offset = limit
+			if stmt.limit, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseProjection() (projection, error) {
+	if p.accept("*") {
+		return projection{star: true}, nil
+	}
+	// table.*
+	if p.peek().kind == tokIdent && p.tokens[p.pos+1].is(".") && p.tokens[p.pos+2].is("*") {
+		table := p.next().text
+		p.pos += 2
+		return projection{star: true, table: table}, nil
+	}
+	start := p.pos
+	x, err := p.parseExpr()
+	if err != nil {
+		return projection{}, err
+	}
+	proj := projection{x: x}
+	if p.accept("as") {
+		name := p.next()
+		if name.kind != tokIdent && name.kind != tokString {
+			return projection{}, p.syntaxError()
+		}
+		proj.name = name.text
+	} else if p.peek().kind == tokIdent && !reserved[strings.ToLower(p.peek().text)] {
+		proj.name = p.next().text
+	} else if col, ok := x.(*colExpr); ok {
+		proj.name = col.name
+	} else {
+		proj.name = p.source(start, p.pos)
+	}
+	return proj, nil
+}
+
+// source rebuilds the text of tokens[start:end] for naming result columns
+func (p *parser) source(start, end int) string {
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		t := p.tokens[i]
+		switch {
+		case t.kind == tokString:
+			b.WriteString("'" + strings.Replace(t.text, "'", "''", -1) + "'")
+		case t.kind == tokVariable:
+			b.WriteString("@@" + t.text)
+		default:
+			b.WriteString(t.text)
+		}
+		if i+1 < end && t.kind != tokSymbol && !p.tokens[i+1].is("(") && !p.tokens[i+1].is(")") && !p.tokens[i+1].is(",") {
+			b.WriteString(" ")
+		}
+	}
+	return b.String()
+}
+
+func (p *parser) parseInsert() (*insertStmt, error) {
+	stmt := &insertStmt{}
+	if p.accept("replace") {
+		stmt.conflict = "replace"
+	} else {
+		p.next()
+		if p.accept("or") {
+			switch {
+			case p.accept("replace"):
+				stmt.conflict = "replace"
+			case p.accept("ignore"):
+				stmt.conflict = "ignore"
+			default:
+				return nil, p.syntaxError()
+			}
+		}
+	}
+	if err := p.expect("into"); err != nil {
+		return nil, err
+	}
+	table, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.table = table
+	if p.accept("(") {
+		for {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			stmt.columns = append(stmt.columns, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().is("select") {
+		query, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		stmt.query = query
+		return stmt, nil
+	}
+	if err := p.expect("values"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		row, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		stmt.rows = append(stmt.rows, row)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseDelete() (*deleteStmt, error) {
+	p.next()
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	table, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &deleteStmt{table: table}
+	if p.accept("where") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseUpdate() (*updateStmt, error) {
+	p.next()
+	table, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &updateStmt{table: table}
+	if err := p.expect("set"); err != nil {
+		return nil, err
+	}
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.set = append(stmt.set, assignment{col, x})
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("where") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parsePragma() (*pragmaStmt, error) {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	// pragma disk.table_info(mysql_servers)
+	schema := ""
+	if p.accept(".") {
+		schema = name
+		if name, err = p.ident(); err != nil {
+			return nil, err
+		}
+	}
+	stmt := &pragmaStmt{name: strings.ToLower(name)}
+	if p.accept("(") {
+		arg := p.next()
+		if arg.kind != tokIdent && arg.kind != tokString {
+			return nil, p.syntaxError()
+		}
+		stmt.arg = arg.text
+		// pragma table_info(disk.mysql_servers)
+		if p.accept(".") {
+			table := p.next()
+			if table.kind != tokIdent {
+				return nil, p.syntaxError()
+			}
+			stmt.arg += "." + table.text
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if schema != "" {
+		stmt.arg = schema + "." + stmt.arg
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseShow() (*showTablesStmt, error) {
+	p.next()
+	if err := p.expect("tables"); err != nil {
+		return nil, err
+	}
+	stmt := &showTablesStmt{}
+	if p.accept("from") || p.accept("in") {
+		schema, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		stmt.schema = strings.ToLower(schema)
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseExprList() ([]expr, error) {
+	var list []expr
+	for {
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, x)
+		if !p.accept(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &binExpr{"or", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &binExpr{"and", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("not") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{"not", x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokSymbol && (t.text == "=" || t.text == "==" || t.text == "!=" || t.text == "<>" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+			p.next()
+			r, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			l = &binExpr{t.text, l, r}
+		case t.is("is"):
+			p.next()
+			not := p.accept("not")
+			if err := p.expect("null"); err != nil {
+				return nil, err
+			}
+			l = &isNullExpr{l, not}
+		case t.is("not") || t.is("in") || t.is("like") || t.is("between"):
+			not := p.accept("not")
+			switch {
+			case p.accept("in"):
+				if err := p.expect("("); err != nil {
+					return nil, err
+				}
+				var list []expr
+				if !p.peek().is(")") {
+					if list, err = p.parseExprList(); err != nil {
+						return nil, err
+					}
+				}
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+				l = &inExpr{l, list, not}
+			case p.accept("like"):
+				pattern, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				like := &likeExpr{x: l, pattern: pattern, not: not}
+				if p.accept("escape") {
+					if like.escape, err = p.parseAdditive(); err != nil {
+						return nil, err
+					}
+				}
+				l = like
+			case p.accept("between"):
+				lo, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect("and"); err != nil {
+					return nil, err
+				}
+				hi, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				l = &betweenExpr{l, lo, hi, not}
+			default:
+				return nil, p.syntaxError()
+			}
+		default:
+			return l, nil
+		}
+	}
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	l, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("+") || p.peek().is("-") || p.peek().is("||") {
+		op := p.next().text
+		r, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &binExpr{op, l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("*") || p.peek().is("/") || p.peek().is("%") {
+		op := p.next().text
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &binExpr{op, l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.accept("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{"-", x}, nil
+	}
+	if p.accept("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &litExpr{i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unrecognized token: \"%s\"", t.text)
+		}
+		return &litExpr{f}, nil
+	case tokString:
+		p.next()
+		return &litExpr{t.text}, nil
+	case tokVariable:
+		p.next()
+		return &varExpr{t.text}, nil
+	case tokSymbol:
+		if p.accept("(") {
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	case tokIdent:
+		if p.accept("null") {
+			return &litExpr{nil}, nil
+		}
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept("(") {
+			f := &funcExpr{name: strings.ToLower(name)}
+			if p.accept("*") {
+				f.star = true
+			} else if !p.peek().is(")") {
+				if f.args, err = p.parseExprList(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+		if p.accept(".") {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			return &colExpr{name, col}, nil
+		}
+		return &colExpr{name: name}, nil
+	}
+	return nil, p.syntaxError()
+}
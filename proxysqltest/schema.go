@@ -0,0 +1,315 @@
+package proxysqltest
+
+// this file is for the tables of the admin interface, built from the same
+// CREATE TABLE statements that ProxySQL uses so that constraints match
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type column struct {
+	name    string
+	typ     string
+	notNull bool
+	def     value
+	defSQL  string
+	pk      int
+	autoinc bool
+}
+
+type tableSchema struct {
+	name    string
+	columns []column
+	checks  []expr
+	unique  [][]int
+	index   map[string]int
+}
+
+// configuration tables, which have memory, disk and runtime copies
+var configTables = []string{
+	"mysql_servers",
+	"mysql_users",
+	"mysql_replication_hostgroups",
+	"mysql_query_rules",
+	"global_variables",
+	"proxysql_servers",
+}
+
+var statsTables = []string{
+	"stats_mysql_connection_pool",
+	"stats_mysql_global",
+	"stats_mysql_commands_counters",
+	"stats_mysql_query_digest",
+	"stats_mysql_processlist",
+}
+
+var monitorTables = []string{
+	"mysql_server_connect_log",
+	"mysql_server_ping_log",
+}
+
+// returns the CREATE TABLE statements of the given major version
+func tableDefinitions(major int) []string {
+	gtidPort := ""
+	checkType := ""
+	userComment := ""
+	maxConnUsed := ""
+	if major >= 2 {
+		gtidPort = "gtid_port INT CHECK ((gtid_port <> port OR gtid_port=0) AND gtid_port >= 0 AND gtid_port <= 65535) NOT NULL DEFAULT 0 , "
+		checkType = "check_type VARCHAR CHECK (LOWER(check_type) IN ('read_only','innodb_read_only','super_read_only')) NOT NULL DEFAULT 'read_only' , "
+		userComment = " , comment VARCHAR NOT NULL DEFAULT ''"
+		maxConnUsed = "MaxConnUsed INT , "
+	}
+	return []string{
+		"CREATE TABLE mysql_servers (hostgroup_id INT CHECK (hostgroup_id>=0) NOT NULL DEFAULT 0 , hostname VARCHAR NOT NULL , port INT CHECK (port >= 0 AND port <= 65535) NOT NULL DEFAULT 3306 , " + gtidPort + "status VARCHAR CHECK (UPPER(status) IN ('ONLINE','SHUNNED','OFFLINE_SOFT', 'OFFLINE_HARD')) NOT NULL DEFAULT 'ONLINE' , weight INT CHECK (weight >= 0 AND weight <=10000000) NOT NULL DEFAULT 1 , compression INT CHECK (compression >=0 AND compression <= 102400) NOT NULL DEFAULT 0 , max_connections INT CHECK (max_connections >=0) NOT NULL DEFAULT 1000 , max_replication_lag INT CHECK (max_replication_lag >= 0 AND max_replication_lag <= 126144000) NOT NULL DEFAULT 0 , use_ssl INT CHECK (use_ssl IN(0,1)) NOT NULL DEFAULT 0 , max_latency_ms INT UNSIGNED CHECK (max_latency_ms>=0) NOT NULL DEFAULT 0 , comment VARCHAR NOT NULL DEFAULT '' , PRIMARY KEY (hostgroup_id, hostname, port) )",
+		"CREATE TABLE mysql_users (username VARCHAR NOT NULL , password VARCHAR , active INT CHECK (active IN (0,1)) NOT NULL DEFAULT 1 , use_ssl INT CHECK (use_ssl IN (0,1)) NOT NULL DEFAULT 0 , default_hostgroup INT NOT NULL DEFAULT 0 , default_schema VARCHAR , schema_locked INT CHECK (schema_locked IN (0,1)) NOT NULL DEFAULT 0 , transaction_persistent INT CHECK (transaction_persistent IN (0,1)) NOT NULL DEFAULT 1 , fast_forward INT CHECK (fast_forward IN (0,1)) NOT NULL DEFAULT 0 , backend INT CHECK (backend IN (0,1)) NOT NULL DEFAULT 1 , frontend INT CHECK (frontend IN (0,1)) NOT NULL DEFAULT 1 , max_connections INT CHECK (max_connections >=0) NOT NULL DEFAULT 10000" + userComment + " , PRIMARY KEY (username, backend) , UNIQUE (username, frontend))",
+		"CREATE TABLE mysql_replication_hostgroups (writer_hostgroup INT CHECK (writer_hostgroup>=0) NOT NULL PRIMARY KEY , reader_hostgroup INT NOT NULL CHECK (reader_hostgroup<>writer_hostgroup AND reader_hostgroup>=0) , " + checkType + "comment VARCHAR NOT NULL DEFAULT '' , UNIQUE (reader_hostgroup))",
+		"CREATE TABLE mysql_query_rules (rule_id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL , active INT CHECK (active IN (0,1)) NOT NULL DEFAULT 0 , username VARCHAR , schemaname VARCHAR , flagIN INT CHECK (flagIN >= 0) NOT NULL DEFAULT 0 , client_addr VARCHAR , proxy_addr VARCHAR , proxy_port INT , digest VARCHAR , match_digest VARCHAR , match_pattern VARCHAR , negate_match_pattern INT CHECK (negate_match_pattern IN (0,1)) NOT NULL DEFAULT 0 , re_modifiers VARCHAR DEFAULT 'CASELESS' , flagOUT INT CHECK (flagOUT >= 0) , replace_pattern VARCHAR , destination_hostgroup INT DEFAULT NULL , cache_ttl INT CHECK(cache_ttl > 0) , reconnect INT CHECK (reconnect IN (0,1)) DEFAULT NULL , timeout INT UNSIGNED , retries INT CHECK (retries>=0 AND retries <=1000) , delay INT UNSIGNED , next_query_flagIN INT UNSIGNED , mirror_flagOUT INT UNSIGNED , mirror_hostgroup INT UNSIGNED , error_msg VARCHAR , OK_msg VARCHAR , sticky_conn INT CHECK (sticky_conn IN (0,1)) , multiplex INT CHECK (multiplex IN (0,1,2)) , log INT CHECK (log IN (0,1)) , apply INT CHECK(apply IN (0,1)) NOT NULL DEFAULT 0 , comment VARCHAR)",
+		"CREATE TABLE global_variables (variable_name VARCHAR NOT NULL PRIMARY KEY , variable_value VARCHAR NOT NULL)",
+		"CREATE TABLE proxysql_servers (hostname VARCHAR NOT NULL , port INT NOT NULL DEFAULT 6032 , weight INT CHECK (weight >= 0) NOT NULL DEFAULT 0 , comment VARCHAR NOT NULL DEFAULT '' , PRIMARY KEY (hostname, port) )",
+		"CREATE TABLE stats_mysql_connection_pool (hostgroup INT , srv_host VARCHAR , srv_port INT , status VARCHAR , ConnUsed INT , ConnFree INT , ConnOK INT , ConnERR INT , " + maxConnUsed + "Queries INT , Bytes_data_sent INT , Bytes_data_recv INT , Latency_us INT)",
+		"CREATE TABLE stats_mysql_global (Variable_Name VARCHAR NOT NULL PRIMARY KEY , Variable_Value VARCHAR NOT NULL)",
+		"CREATE TABLE stats_mysql_commands_counters (Command VARCHAR NOT NULL PRIMARY KEY , Total_Time_us INT NOT NULL , Total_cnt INT NOT NULL , cnt_100us INT NOT NULL , cnt_500us INT NOT NULL , cnt_1ms INT NOT NULL , cnt_5ms INT NOT NULL , cnt_10ms INT NOT NULL , cnt_50ms INT NOT NULL , cnt_100ms INT NOT NULL , cnt_500ms INT NOT NULL , cnt_1s INT NOT NULL , cnt_5s INT NOT NULL , cnt_10s INT NOT NULL , cnt_INFs INT NOT NULL)",
+		"CREATE TABLE stats_mysql_query_digest (hostgroup INT , schemaname VARCHAR NOT NULL , username VARCHAR NOT NULL , digest VARCHAR NOT NULL , digest_text VARCHAR NOT NULL , count_star INTEGER NOT NULL , first_seen INTEGER NOT NULL , last_seen INTEGER NOT NULL , sum_time INTEGER NOT NULL , min_time INTEGER NOT NULL , max_time INTEGER NOT NULL , PRIMARY KEY(hostgroup, schemaname, username, digest))",
+		"CREATE TABLE stats_mysql_processlist (ThreadID INT NOT NULL , SessionID INTEGER PRIMARY KEY , user VARCHAR , db VARCHAR , cli_host VARCHAR , cli_port INT , hostgroup INT , l_srv_host VARCHAR , l_srv_port INT , srv_host VARCHAR , srv_port INT , command VARCHAR , time_ms INT NOT NULL , info VARCHAR)",
+		"CREATE TABLE mysql_server_connect_log (hostname VARCHAR NOT NULL , port INT NOT NULL DEFAULT 3306 , time_start_us INT NOT NULL DEFAULT 0 , connect_success_time_us INT DEFAULT 0 , connect_error VARCHAR , PRIMARY KEY (hostname, port, time_start_us))",
+		"CREATE TABLE mysql_server_ping_log (hostname VARCHAR NOT NULL , port INT NOT NULL DEFAULT 3306 , time_start_us INT NOT NULL DEFAULT 0 , ping_success_time_us INT DEFAULT 0 , ping_error VARCHAR , PRIMARY KEY (hostname, port, time_start_us))",
+	}
+}
+
+// parses a CREATE TABLE statement
+func parseSchema(ddl string) (*tableSchema, error) {
+	tokens, err := lex(ddl)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if err := p.expect("create"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("table"); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	s := &tableSchema{name: name, index: make(map[string]int)}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var pk []int
+	for {
+		switch {
+		case p.accept("primary"):
+			if err := p.expect("key"); err != nil {
+				return nil, err
+			}
+			if pk, err = p.columnList(s); err != nil {
+				return nil, err
+			}
+		case p.accept("unique"):
+			cols, err := p.columnList(s)
+			if err != nil {
+				return nil, err
+			}
+			s.unique = append(s.unique, cols)
+		case p.peek().is("check"):
+			check, err := p.check()
+			if err != nil {
+				return nil, err
+			}
+			s.checks = append(s.checks, check)
+		default:
+			col, unique, check, err := p.columnDefinition()
+			if err != nil {
+				return nil, err
+			}
+			if check != nil {
+				s.checks = append(s.checks, check)
+			}
+			s.index[strings.ToLower(col.name)] = len(s.columns)
+			if col.pk > 0 {
+				pk = []int{len(s.columns)}
+			}
+			if unique {
+				s.unique = append(s.unique, []int{len(s.columns)})
+			}
+			s.columns = append(s.columns, col)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	for i, col := range pk {
+		s.columns[col].pk = i + 1
+	}
+	if pk != nil {
+		s.unique = append([][]int{pk}, s.unique...)
+	}
+	return s, nil
+}
+
+func (p *parser) columnList(s *tableSchema) ([]int, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var cols []int
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		i, ok := s.index[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("no such column: %s", name)
+		}
+		cols = append(cols, i)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return cols, p.expect(")")
+}
+
+func (p *parser) check() (expr, error) {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return x, p.expect(")")
+}
+
+func (p *parser) columnDefinition() (column, bool, expr, error) {
+	var (
+		col    column
+		unique bool
+		check  expr
+		err    error
+	)
+	if col.name, err = p.ident(); err != nil {
+		return col, false, nil, err
+	}
+	// the declared type is every word up to the first constraint
+	var typ []string
+	for p.peek().kind == tokIdent && !isConstraintKeyword(p.peek()) {
+		typ = append(typ, strings.ToUpper(p.next().text))
+	}
+	col.typ = strings.Join(typ, " ")
+	for {
+		switch {
+		case p.peek().is("check"):
+			if check, err = p.check(); err != nil {
+				return col, false, nil, err
+			}
+		case p.accept("not"):
+			if err := p.expect("null"); err != nil {
+				return col, false, nil, err
+			}
+			col.notNull = true
+		case p.accept("null"):
+		case p.accept("default"):
+			start := p.pos
+			x, err := p.parseUnary()
+			if err != nil {
+				return col, false, nil, err
+			}
+			if col.def, err = x.eval(nil); err != nil {
+				return col, false, nil, err
+			}
+			col.defSQL = p.source(start, p.pos)
+		case p.accept("primary"):
+			if err := p.expect("key"); err != nil {
+				return col, false, nil, err
+			}
+			col.pk = 1
+		case p.accept("autoincrement"):
+			col.autoinc = true
+		case p.accept("unique"):
+			unique = true
+		default:
+			return col, unique, check, nil
+		}
+	}
+}
+
+func isConstraintKeyword(t token) bool {
+	for _, k := range []string{"check", "not", "null", "default", "primary", "autoincrement", "unique"} {
+		if t.is(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns a copy of the schema under another name, for runtime_ and disk.
+// copies of configuration tables
+func (s *tableSchema) renamed(name string) *tableSchema {
+	c := *s
+	c.name = name
+	return &c
+}
+
+// returns the index of a column, or -1
+func (s *tableSchema) column(name string) int {
+	if i, ok := s.index[strings.ToLower(name)]; ok {
+		return i
+	}
+	return -1
+}
+
+// applies the column's type affinity to a value, as SQLite does on storage
+func (c column) affinity(v value) value {
+	switch {
+	case v == nil:
+		return nil
+	case strings.Contains(c.typ, "INT"):
+		switch n := numeric(v).(type) {
+		case int64:
+			return n
+		case float64:
+			if n == float64(int64(n)) {
+				return int64(n)
+			}
+			return n
+		}
+	case strings.Contains(c.typ, "CHAR") || strings.Contains(c.typ, "TEXT"):
+		if isNumber(v) {
+			return text(v)
+		}
+	}
+	return v
+}
+
+// rows of the table_info pragma for this schema
+func (s *tableSchema) tableInfo() [][]value {
+	rows := make([][]value, len(s.columns))
+	for i, col := range s.columns {
+		var def value
+		if col.defSQL != "" {
+			def = col.defSQL
+		}
+		rows[i] = []value{int64(i), col.name, col.typ, boolValue(col.notNull), def, int64(col.pk)}
+	}
+	return rows
+}
+
+// parses the major and minor numbers from versions like 2.0.12-38-g58a909a
+func parseVersion(version string) (int, int) {
+	parts := strings.SplitN(version, ".", 3)
+	major, _ := strconv.Atoi(parts[0])
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(strings.TrimFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	}
+	return major, minor
+}
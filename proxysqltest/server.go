@@ -0,0 +1,351 @@
+// Package proxysqltest provides an in-process server that speaks the MySQL
+// protocol and implements enough of ProxySQL's admin interface to test code
+// that uses proxysql.ProxySQL without a ProxySQL container.
+//
+// The server keeps memory, disk and runtime copies of the configuration
+// tables (mysql_servers, mysql_users, mysql_replication_hostgroups,
+// mysql_query_rules, global_variables and proxysql_servers), understands the
+// LOAD and SAVE commands that copy between them, and serves stats and monitor
+// tables with canned data. Tables are created from the same definitions that
+// ProxySQL uses, so constraint violations fail as they would in ProxySQL.
+package proxysqltest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ErrDropConnection can be returned from a query hook to close the client's
+// connection without a response, as though ProxySQL had gone away
+var ErrDropConnection = errors.New("drop connection")
+
+// ErrDropResponse can be returned from a query hook to run the query, and then
+// close the client's connection without a response, as though the connection
+// was lost after ProxySQL applied the query
+var ErrDropResponse = errors.New("drop response")
+
+// Error is a MySQL error sent to the client. Return one from a query hook to
+// control the error number and SQL state that the client receives. Other
+// errors are sent the way ProxySQL reports admin errors, as error 1045
+type Error struct {
+	Code    uint16
+	State   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Code, e.Message)
+}
+
+// Server is an in-process ProxySQL admin interface listening on localhost
+type Server struct {
+	listener net.Listener
+	db       *database
+	version  string
+	socket   string
+	wg       sync.WaitGroup
+
+	mut      sync.Mutex
+	user     string
+	password string
+	hook     func(string) error
+	queries  []string
+	conns    map[net.Conn]struct{}
+	nextID   uint32
+	closed   bool
+}
+
+// ServerOpts is a type of function that configures a Server in NewServer
+type ServerOpts func(*Server) *Server
+
+// Version sets the ProxySQL version that the server reports, and whose table
+// definitions it uses. The default is 1.4.16
+func Version(v string) ServerOpts {
+	return func(s *Server) *Server {
+		s.version = v
+		return s
+	}
+}
+
+// Credentials sets the admin user and password the server accepts.
+// The default is admin:admin, like ProxySQL
+func Credentials(user, password string) ServerOpts {
+	return func(s *Server) *Server {
+		s.user = user
+		s.password = password
+		return s
+	}
+}
+
+// Socket makes the server listen on a unix socket at path, like ProxySQL's
+// admin socket, instead of on TCP
+func Socket(path string) ServerOpts {
+	return func(s *Server) *Server {
+		s.socket = path
+		return s
+	}
+}
+
+// NewServer starts a server listening on a random port of 127.0.0.1, or on
+// the unix socket given with Socket. Call Close to stop it
+func NewServer(opts ...ServerOpts) (*Server, error) {
+	s := &Server{
+		version:  "1.4.16",
+		user:     "admin",
+		password: "admin",
+		conns:    make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	db, err := newDatabase(s.version)
+	if err != nil {
+		return nil, err
+	}
+	s.db = db
+	if s.socket != "" {
+		s.listener, err = net.Listen("unix", s.socket)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server is listening on, or the path of its
+// unix socket
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// DSN returns a DSN for proxysql.NewProxySQL that connects to this server
+func (s *Server) DSN() string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.socket != "" {
+		return fmt.Sprintf("%s:%s@unix(%s)/", s.user, s.password, s.Addr())
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s)/", s.user, s.password, s.Addr())
+}
+
+// Version returns the ProxySQL version the server reports
+func (s *Server) Version() string {
+	return s.version
+}
+
+// SetCredentials changes the admin user and password that new connections
+// must use. Connections that are already open are not affected
+func (s *Server) SetCredentials(user, password string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.user = user
+	s.password = password
+}
+
+// SetQueryHook sets a function that is called with every query before it is
+// run. If the hook returns an error the query is not run, and the error is
+// sent to the client instead. Pass nil to remove the hook
+func (s *Server) SetQueryHook(hook func(query string) error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.hook = hook
+}
+
+// Queries returns every query the server has received, in order
+func (s *Server) Queries() []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// Close stops the server and closes every open connection
+func (s *Server) Close() error {
+	s.mut.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mut.Unlock()
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mut.Lock()
+		if s.closed {
+			s.mut.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.nextID++
+		id := s.nextID
+		s.mut.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mut.Lock()
+				delete(s.conns, conn)
+				s.mut.Unlock()
+				conn.Close()
+			}()
+			s.handle(newPacketConn(conn), id)
+		}()
+	}
+}
+
+func (s *Server) handle(c *packetConn, id uint32) {
+	if !s.handshake(c, id) {
+		return
+	}
+	for {
+		payload, err := c.readPacket()
+		if err != nil || len(payload) == 0 {
+			return
+		}
+		switch payload[0] {
+		case comQuit:
+			return
+		case comPing, comInitDB:
+			err = c.writeOK(0, 0)
+		case comQuery:
+			err = s.query(c, string(payload[1:]))
+		case comStmtPrepare:
+			err = c.writeError(1045, "28000", "ProxySQL Admin Error: prepared statements are not supported")
+		default:
+			err = c.writeError(1047, "08S01", "Unknown command")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handshake(c *packetConn, id uint32) bool {
+	scramble := make([]byte, 20)
+	rand.Read(scramble)
+	for i := range scramble {
+		// the scramble must not contain NUL bytes
+		scramble[i] = scramble[i]%94 + 33
+	}
+	p := []byte{10}
+	p = append(p, s.version...)
+	p = append(p, 0, byte(id), byte(id>>8), byte(id>>16), byte(id>>24))
+	p = append(p, scramble[:8]...)
+	capabilities := uint32(serverCapabilities)
+	p = append(p, 0, byte(capabilities), byte(capabilities>>8), charsetUTF8)
+	p = append(p, byte(statusAutocommit), byte(statusAutocommit>>8))
+	p = append(p, byte(capabilities>>16), byte(capabilities>>24), 21)
+	p = append(p, make([]byte, 10)...)
+	p = append(p, scramble[8:]...)
+	p = append(p, 0)
+	p = append(p, "mysql_native_password"...)
+	p = append(p, 0)
+	c.seq = 0
+	if c.writePacket(p) != nil {
+		return false
+	}
+
+	resp, err := c.readPacket()
+	if err != nil || len(resp) < 32 {
+		return false
+	}
+	flags := uint32(resp[0]) | uint32(resp[1])<<8 | uint32(resp[2])<<16 | uint32(resp[3])<<24
+	rest := resp[32:]
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 {
+		return false
+	}
+	user := string(rest[:end])
+	rest = rest[end+1:]
+	var auth []byte
+	switch {
+	case flags&clientPluginAuthLenEnc != 0:
+		n, used := readLenEncInt(rest)
+		if used == 0 || int(n) > len(rest)-used {
+			return false
+		}
+		auth = rest[used : used+int(n)]
+	case flags&clientSecureConn != 0 && len(rest) > 0:
+		n := int(rest[0])
+		if n > len(rest)-1 {
+			return false
+		}
+		auth = rest[1 : 1+n]
+	default:
+		if end = bytes.IndexByte(rest, 0); end >= 0 {
+			auth = rest[:end]
+		}
+	}
+
+	s.mut.Lock()
+	expectedUser, password := s.user, s.password
+	s.mut.Unlock()
+	if user != expectedUser || !bytes.Equal(auth, nativePassword(scramble, password)) {
+		usingPassword := "NO"
+		if len(auth) > 0 {
+			usingPassword = "YES"
+		}
+		c.writeError(1045, "28000", fmt.Sprintf("ProxySQL Error: Access denied for user '%s' (using password: %s)", user, usingPassword))
+		return false
+	}
+	return c.writeOK(0, 0) == nil
+}
+
+func (s *Server) query(c *packetConn, sql string) error {
+	s.mut.Lock()
+	s.queries = append(s.queries, sql)
+	hook := s.hook
+	s.mut.Unlock()
+	if hook != nil {
+		if err := hook(sql); err != nil {
+			if err == ErrDropConnection {
+				return err
+			}
+			if err == ErrDropResponse {
+				s.db.exec(sql)
+				return ErrDropConnection
+			}
+			if e, ok := err.(*Error); ok {
+				return c.writeError(e.Code, e.State, e.Message)
+			}
+			return c.writeError(1045, "28000", "ProxySQL Admin Error: "+err.Error())
+		}
+	}
+	res, err := s.db.exec(sql)
+	if err != nil {
+		return c.writeError(1045, "28000", "ProxySQL Admin Error: "+err.Error())
+	}
+	if res.columns == nil {
+		return c.writeOK(res.affected, res.insertID)
+	}
+	return c.writeResult(resultTable(sql), res)
+}
+
+// resultTable names the table that a result set's columns come from
+func resultTable(sql string) string {
+	fields := strings.Fields(strings.ToLower(sql))
+	for i, field := range fields {
+		if field == "from" && i+1 < len(fields) {
+			return strings.TrimRight(fields[i+1], ";")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,373 @@
+package proxysqltest
+
+import (
+	"database/sql"
+	"errors"
+	_ "github.com/go-sql-driver/mysql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func setup(t *testing.T, opts ...ServerOpts) (*Server, *sql.DB) {
+	s, err := NewServer(opts...)
+	if err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	db, err := sql.Open("mysql", s.DSN())
+	if err != nil {
+		t.Fatalf("bad dsn: %v", err)
+	}
+	return s, db
+}
+
+func teardown(s *Server, db *sql.DB) {
+	db.Close()
+	s.Close()
+}
+
+// queries rows and returns them as strings, with NULL as "NULL"
+func queryStrings(t *testing.T, db *sql.DB, query string) [][]string {
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("error running %q: %v", query, err)
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	var result [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatalf("error scanning %q: %v", query, err)
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = v.String
+			if !v.Valid {
+				row[i] = "NULL"
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("error reading %q: %v", query, err)
+	}
+	return result
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string) sql.Result {
+	res, err := db.Exec(query)
+	if err != nil {
+		t.Fatalf("error running %q: %v", query, err)
+	}
+	return res
+}
+
+func TestPingAndVersion(t *testing.T) {
+	s, db := setup(t, Version("2.0.12-38-g58a909a"))
+	defer teardown(s, db)
+	if err := db.Ping(); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	rows := queryStrings(t, db, "select @@version")
+	if len(rows) != 1 || rows[0][0] != "2.0.12-38-g58a909a" {
+		t.Fatalf("did not report version: %v", rows)
+	}
+	rows = queryStrings(t, db, "select variable_value from global_variables where variable_name = 'admin-version'")
+	if len(rows) != 1 || rows[0][0] != "2.0.12-38-g58a909a" {
+		t.Fatalf("did not report admin-version: %v", rows)
+	}
+}
+
+func TestRejectsBadCredentials(t *testing.T) {
+	s, err := NewServer(Credentials("remote-admin", "password"))
+	if err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	defer s.Close()
+	db, _ := sql.Open("mysql", "remote-admin:wrong@tcp("+s.Addr()+")/")
+	defer db.Close()
+	if err := db.Ping(); err == nil || !strings.Contains(err.Error(), "Access denied") {
+		t.Fatalf("did not deny bad password: %v", err)
+	}
+	good, _ := sql.Open("mysql", s.DSN())
+	defer good.Close()
+	if err := good.Ping(); err != nil {
+		t.Fatalf("did not accept configured credentials: %v", err)
+	}
+	s.SetCredentials("remote-admin", "rotated")
+	rotated, _ := sql.Open("mysql", "remote-admin:rotated@tcp("+s.Addr()+")/")
+	defer rotated.Close()
+	if err := rotated.Ping(); err != nil {
+		t.Fatalf("did not accept changed credentials: %v", err)
+	}
+}
+
+func TestInsertSelectAndDefaults(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	res := mustExec(t, db, "insert into mysql_servers (hostgroup_id, hostname, port) values (1, 'a', 3306), (1, 'b', 3307)")
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("did not report rows affected: %d", n)
+	}
+	rows := queryStrings(t, db, "select * from mysql_servers where hostname = 'b'")
+	expected := [][]string{{"1", "b", "3307", "ONLINE", "1", "0", "1000", "0", "0", "0", ""}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("did not fill in defaults: %v", rows)
+	}
+}
+
+func TestConstraintsMatchProxySQL(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into mysql_servers (hostname) values ('a')")
+	tests := map[string]string{
+		"insert into mysql_servers (hostname) values ('a')":                     "UNIQUE constraint failed: mysql_servers.hostgroup_id, mysql_servers.hostname, mysql_servers.port",
+		"insert into mysql_servers (hostname, port) values ('b', 70000)":        "CHECK constraint failed: mysql_servers",
+		"insert into mysql_servers (hostname, status) values ('b', 'BROKEN')":   "CHECK constraint failed: mysql_servers",
+		"insert into mysql_servers (port) values (3306)":                        "NOT NULL constraint failed: mysql_servers.hostname",
+		"insert into mysql_servers (hostname, nope) values ('b', 1)":            "table mysql_servers has no column named nope",
+		"select * from not_a_table":                                             "no such table: not_a_table",
+		"delete from mysql_servers where nope = 1":                              "no such column: nope",
+		"selec * from mysql_servers":                                            "near \"selec\": syntax error",
+		"update mysql_servers set hostname = 'a' where hostname = 'b' or 1 = 1": "",
+	}
+	for query, expected := range tests {
+		_, err := db.Exec(query)
+		if expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %v", query, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "Error 1045") || !strings.Contains(err.Error(), "ProxySQL Admin Error: "+expected) {
+			t.Errorf("did not receive %q for %q: %v", expected, query, err)
+		}
+	}
+}
+
+func TestMultiRowInsertIsAtomic(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into mysql_servers (hostname) values ('b')")
+	if _, err := db.Exec("insert into mysql_servers (hostname) values ('a'), ('b'), ('c')"); err == nil {
+		t.Fatal("did not fail on duplicate row")
+	}
+	rows := queryStrings(t, db, "select hostname from mysql_servers")
+	if !reflect.DeepEqual(rows, [][]string{{"b"}}) {
+		t.Fatalf("rows before the failure were kept: %v", rows)
+	}
+}
+
+func TestLoadAndSaveCopyBetweenLayers(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into mysql_servers (hostname) values ('a')")
+	if rows := queryStrings(t, db, "select hostname from runtime_mysql_servers"); len(rows) != 0 {
+		t.Fatalf("runtime changed before load: %v", rows)
+	}
+	mustExec(t, db, "load mysql servers to runtime")
+	mustExec(t, db, "insert into mysql_servers (hostname) values ('b')")
+	if rows := queryStrings(t, db, "select hostname from runtime_mysql_servers"); !reflect.DeepEqual(rows, [][]string{{"a"}}) {
+		t.Fatalf("runtime was not loaded from memory: %v", rows)
+	}
+	if rows := queryStrings(t, db, "select hostname from disk.mysql_servers"); len(rows) != 0 {
+		t.Fatalf("disk changed before save: %v", rows)
+	}
+	mustExec(t, db, "SAVE MYSQL SERVERS TO DISK")
+	if rows := queryStrings(t, db, "select count(*) from disk.mysql_servers"); rows[0][0] != "2" {
+		t.Fatalf("disk was not saved from memory: %v", rows)
+	}
+	mustExec(t, db, "delete from mysql_servers")
+	mustExec(t, db, "save mysql servers from runtime")
+	if rows := queryStrings(t, db, "select hostname from mysql_servers"); !reflect.DeepEqual(rows, [][]string{{"a"}}) {
+		t.Fatalf("memory was not saved from runtime: %v", rows)
+	}
+	mustExec(t, db, "load mysql servers from disk")
+	if rows := queryStrings(t, db, "select count(*) from mysql_servers"); rows[0][0] != "2" {
+		t.Fatalf("memory was not loaded from disk: %v", rows)
+	}
+	if _, err := db.Exec("load mysql servers to disk"); err == nil {
+		t.Fatal("did not reject load to disk")
+	}
+}
+
+func TestWritesToRuntimeHaveNoEffect(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into runtime_mysql_servers (hostname) values ('a')")
+	if rows := queryStrings(t, db, "select * from runtime_mysql_servers"); len(rows) != 0 {
+		t.Fatalf("write to runtime had an effect: %v", rows)
+	}
+}
+
+func TestVariablesModulesCopyOnlyTheirPrefix(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "SET mysql-monitor_password = 'secret'")
+	mustExec(t, db, "update global_variables set variable_value = 'false' where variable_name = 'admin-read_only'")
+	mustExec(t, db, "load mysql variables to runtime")
+	rows := queryStrings(t, db, "select variable_name, variable_value from runtime_global_variables where variable_name in ('mysql-monitor_password', 'admin-read_only') order by variable_name")
+	if !reflect.DeepEqual(rows, [][]string{{"admin-read_only", "false"}, {"mysql-monitor_password", "secret"}}) {
+		t.Fatalf("did not load mysql variables: %v", rows)
+	}
+	mustExec(t, db, "update global_variables set variable_value = 'true' where variable_name = 'admin-read_only'")
+	mustExec(t, db, "load mysql variables to runtime")
+	rows = queryStrings(t, db, "select variable_value from runtime_global_variables where variable_name = 'admin-read_only'")
+	if rows[0][0] != "false" {
+		t.Fatalf("loading mysql variables changed admin variables: %v", rows)
+	}
+}
+
+func TestWhereOrderAndLimit(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into mysql_servers (hostgroup_id, hostname, weight, status) values (1, 'db-1', 0, 'ONLINE'), (1, 'db-2', 5, 'SHUNNED'), (2, 'db-3', 10, 'OFFLINE_SOFT'), (2, 'web-1', 3, 'ONLINE')")
+	tests := map[string][][]string{
+		"select hostname from mysql_servers where weight > 0 and status in ('ONLINE','SHUNNED') order by hostname":    {{"db-2"}, {"web-1"}},
+		"select hostname from mysql_servers where hostname LIKE 'DB-%' order by weight desc limit 2":                  {{"db-3"}, {"db-2"}},
+		"select hostname from mysql_servers where (hostgroup_id = 1 or hostgroup_id = 2) and not hostname like 'db%'": {{"web-1"}},
+		"select hostname from mysql_servers where status not in ('ONLINE') order by 1 limit 1 offset 1":               {{"db-3"}},
+		"select count(*), max(weight) from mysql_servers where hostgroup_id = 2":                                      {{"2", "10"}},
+		"select hostname from mysql_servers where weight between 3 and 5 order by hostname":                           {{"db-2"}, {"web-1"}},
+		"select hostname from mysql_servers where comment = '' and hostgroup_id = '1' order by hostname desc":         {{"db-2"}, {"db-1"}},
+	}
+	for query, expected := range tests {
+		if rows := queryStrings(t, db, query); !reflect.DeepEqual(rows, expected) {
+			t.Errorf("unexpected rows for %q: %v", query, rows)
+		}
+	}
+}
+
+func TestUpdateAndDeleteReportRowsAffected(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into mysql_servers (hostname) values ('a'), ('b'), ('c')")
+	res := mustExec(t, db, "update mysql_servers set status = 'OFFLINE_SOFT', weight = weight + 1 where hostname != 'a'")
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("update did not report rows affected: %d", n)
+	}
+	if rows := queryStrings(t, db, "select weight from mysql_servers where status = 'OFFLINE_SOFT'"); !reflect.DeepEqual(rows, [][]string{{"2"}, {"2"}}) {
+		t.Fatalf("update did not apply: %v", rows)
+	}
+	if _, err := db.Exec("update mysql_servers set hostname = 'a'"); err == nil {
+		t.Fatal("update did not enforce primary key")
+	}
+	res = mustExec(t, db, "delete from mysql_servers where status = 'OFFLINE_SOFT'")
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("delete did not report rows affected: %d", n)
+	}
+}
+
+func TestQueryRulesAutoincrement(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into mysql_query_rules (active, match_digest, destination_hostgroup, apply) values (1, '^SELECT', 1, 1)")
+	res := mustExec(t, db, "insert into mysql_query_rules (active, match_digest, apply) values (1, '^SELECT .* FOR UPDATE', 1)")
+	if id, _ := res.LastInsertId(); id != 2 {
+		t.Fatalf("did not assign next rule_id: %d", id)
+	}
+	rows := queryStrings(t, db, "select rule_id, destination_hostgroup, re_modifiers from mysql_query_rules order by rule_id")
+	if !reflect.DeepEqual(rows, [][]string{{"1", "1", "CASELESS"}, {"2", "NULL", "CASELESS"}}) {
+		t.Fatalf("unexpected query rules: %v", rows)
+	}
+}
+
+func TestTableInfoFollowsVersion(t *testing.T) {
+	for version, expected := range map[string]int{"1.4.16": 11, "2.0.12": 12, "3.0.1": 12} {
+		s, db := setup(t, Version(version))
+		rows := queryStrings(t, db, "PRAGMA table_info(mysql_servers)")
+		if len(rows) != expected {
+			t.Errorf("version %s had %d columns: %v", version, len(rows), rows)
+		}
+		if rows[0][1] != "hostgroup_id" || rows[0][5] != "1" || rows[1][3] != "1" || rows[2][4] != "3306" {
+			t.Errorf("unexpected table info for version %s: %v", version, rows[:3])
+		}
+		if disk := queryStrings(t, db, "PRAGMA disk.table_info(mysql_servers)"); !reflect.DeepEqual(disk, rows) {
+			t.Errorf("disk table info for version %s differs: %v", version, disk)
+		}
+		teardown(s, db)
+	}
+}
+
+func TestStatsAndMonitorTablesHaveCannedData(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mustExec(t, db, "insert into mysql_servers (hostgroup_id, hostname) values (0, 'a'), (1, 'a')")
+	mustExec(t, db, "load mysql servers to runtime")
+	rows := queryStrings(t, db, "select hostgroup, srv_host, srv_port, status, ConnUsed from stats_mysql_connection_pool order by hostgroup")
+	if !reflect.DeepEqual(rows, [][]string{{"0", "a", "3306", "ONLINE", "0"}, {"1", "a", "3306", "ONLINE", "0"}}) {
+		t.Fatalf("connection pool did not reflect runtime: %v", rows)
+	}
+	rows = queryStrings(t, db, "select Variable_Value from stats.stats_mysql_global where Variable_Name = 'Questions'")
+	if len(rows) != 1 {
+		t.Fatalf("stats_mysql_global had no Questions: %v", rows)
+	}
+	rows = queryStrings(t, db, "select hostname, ping_error from monitor.mysql_server_ping_log")
+	if !reflect.DeepEqual(rows, [][]string{{"a", "NULL"}}) {
+		t.Fatalf("ping log did not reflect runtime: %v", rows)
+	}
+}
+
+func TestQueryHookAndLog(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	mockErr := errors.New("mock")
+	s.SetQueryHook(func(query string) error {
+		if strings.HasPrefix(query, "save") {
+			return mockErr
+		}
+		if strings.HasPrefix(query, "load") {
+			return &Error{Code: 2013, State: "HY000", Message: "Lost connection"}
+		}
+		return nil
+	})
+	if _, err := db.Exec("save mysql servers to disk"); err == nil || !strings.Contains(err.Error(), "ProxySQL Admin Error: mock") {
+		t.Fatalf("did not return hook error: %v", err)
+	}
+	if _, err := db.Exec("load mysql servers to runtime"); err == nil || !strings.Contains(err.Error(), "Error 2013") {
+		t.Fatalf("did not return hook error code: %v", err)
+	}
+	mustExec(t, db, "delete from mysql_servers")
+	expected := []string{"save mysql servers to disk", "load mysql servers to runtime", "delete from mysql_servers"}
+	if !reflect.DeepEqual(s.Queries(), expected) {
+		t.Fatalf("did not log queries: %v", s.Queries())
+	}
+	s.SetQueryHook(func(string) error { return ErrDropConnection })
+	db.SetMaxIdleConns(0)
+	if _, err := db.Exec("delete from mysql_servers"); err == nil {
+		t.Fatal("did not drop connection")
+	}
+	s.SetQueryHook(func(string) error { return ErrDropResponse })
+	if _, err := db.Exec("insert into mysql_servers (hostname) values ('a')"); err == nil {
+		t.Fatal("did not drop connection after the insert")
+	}
+	s.SetQueryHook(nil)
+	if rows := queryStrings(t, db, "select hostname from mysql_servers"); len(rows) != 1 {
+		t.Fatalf("did not run the insert before dropping the connection: %v", rows)
+	}
+}
+
+func TestShowTables(t *testing.T) {
+	s, db := setup(t)
+	defer teardown(s, db)
+	rows := queryStrings(t, db, "show tables from disk")
+	if len(rows) != len(configTables) {
+		t.Fatalf("unexpected disk tables: %v", rows)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	s, db := setup(t, Socket(path))
+	defer teardown(s, db)
+	if s.Addr() != path || !strings.Contains(s.DSN(), "@unix("+path+")/") {
+		t.Fatalf("server is not on the socket: %s, %s", s.Addr(), s.DSN())
+	}
+	mustExec(t, db, "insert into mysql_servers (hostname) values ('a')")
+}
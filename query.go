@@ -5,7 +5,6 @@ package proxysql
 import (
 	"bytes"
 	"fmt"
-	"reflect"
 )
 
 // the type of queries we want to build are as follows:
@@ -20,6 +19,10 @@ type hostQuery struct {
 	table           string
 	host            *Host
 	specifiedFields []string
+	predicates      []Predicate
+	orderBy         []orderTerm
+	limit           int
+	hasLimit        bool
 }
 
 // HostOpts is a type of function that is called with a hostQuery struct to
@@ -40,25 +43,13 @@ func buildSpecifiedColumns(specifiedFields []string) string {
 	return fmt.Sprintf("(%s)", buffer.String())
 }
 
-func valueAsString(opts *hostQuery, field string) string {
-	var stringValue string
-	r := reflect.ValueOf(opts.host)
-	val := reflect.Indirect(r).FieldByName(field)
-	if val.Type().Name() == "int" {
-		stringValue = fmt.Sprintf("%v", val)
-	} else if val.Type().Name() == "string" {
-		stringValue = fmt.Sprintf("'%s'", val.String())
-	}
-	return stringValue
-}
-
 // given a host and specifiedFields it builds a string like
 // (b, 'd', f)
 // where b, d, and f are values of type int, string, int
 func buildSpecifiedValues(opts *hostQuery) string {
 	var buffer bytes.Buffer
 	for pos, field := range opts.specifiedFields {
-		buffer.WriteString(valueAsString(opts, field))
+		buffer.WriteString(literal(columnValue(opts.host, field)))
 		if pos != len(opts.specifiedFields)-1 {
 			buffer.WriteString(", ")
 		}
@@ -66,32 +57,27 @@ func buildSpecifiedValues(opts *hostQuery) string {
 	return fmt.Sprintf("(%s)", buffer.String())
 }
 
-// given a host and specifiedFields, build a string like
-// a1 = b1 and a2 = b2
-func buildSpecifiedValuesWhere(opts *hostQuery) string {
-	var buffer bytes.Buffer
-	for pos, field := range opts.specifiedFields {
-		buffer.WriteString(fmt.Sprintf("%s = ", field))
-		buffer.WriteString(valueAsString(opts, field))
-		if pos != len(opts.specifiedFields)-1 {
-			buffer.WriteString(" and ")
-		}
-	}
-	return buffer.String()
-}
-
 func buildInsertQuery(opts *hostQuery) string {
 	return fmt.Sprintf("insert into %s %s values %s", opts.table, buildSpecifiedColumns(opts.specifiedFields), buildSpecifiedValues(opts))
 }
 
-// builds a select query that only takes in to account the specified columns
+// builds a select query that only takes in to account the specified columns,
+// predicates, ordering and limit
 func buildSelectQuery(opts *hostQuery) string {
-	return fmt.Sprintf("select * from %s where %s", opts.table, buildSpecifiedValuesWhere(opts))
+	return servers(nil, opts.table).selectQuery(opts.tableQuery())
 }
 
-// builds a delete query
+// builds a where clause that matches the row an insert query adds, with
+// every column, as the columns that were not specified take the values of
+// DefaultHost. Matching only the specified columns would also match other
+// rows, like a host with the same hostname on another port
+func buildInsertedWhere(opts *hostQuery) string {
+	return " where " + servers(nil, opts.table).rowWhere(rowFromHost(opts.host))
+}
+
+// builds a delete query, ignoring ordering and limit
 func buildDeleteQuery(opts *hostQuery) string {
-	return fmt.Sprintf("delete from %s where %s", opts.table, buildSpecifiedValuesWhere(opts))
+	return fmt.Sprintf("delete from %s%s", opts.table, opts.tableQuery().whereClause())
 }
 
 // use this when building queries, include the value if it is specified.
@@ -109,7 +95,8 @@ func HostgroupID(h int) HostOpts {
 }
 
 // Table sets the table in a query
-// One of 'runtime_mysql_servers' or 'mysql_servers'
+// One of 'mysql_servers', 'runtime_mysql_servers' or 'disk.mysql_servers'.
+// Only mysql_servers can be written, the others can only be read
 func Table(t string) HostOpts {
 	return func(opts *hostQuery) *hostQuery {
 		return opts.Table(t)
@@ -272,13 +259,76 @@ func buildAndParseHostQuery(setters ...HostOpts) (*hostQuery, error) {
 
 // same as above but mandatory hostname
 func buildAndParseHostQueryWithHostname(setters ...HostOpts) (*hostQuery, error) {
+	opts := defaultHostQuery()
+	for _, setter := range setters {
+		setter(opts)
+	}
+	if err := validateHostQuery(opts, validateHostname, validateHostnameFormat); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// ParsedHostOpts is the validated result of applying a set of HostOpts.
+// It exposes how ProxySQL interprets HostOpts, so that other implementations
+// of Client can select hosts exactly the way ProxySQL does
+type ParsedHostOpts struct {
+	opts *hostQuery
+}
+
+// ParseHostOpts applies and validates the given HostOpts.
+// This will return the same validation errors that HostsLike does
+func ParseHostOpts(setters ...HostOpts) (*ParsedHostOpts, error) {
 	opts, err := buildAndParseHostQuery(setters...)
 	if err != nil {
 		return nil, err
 	}
+	return &ParsedHostOpts{opts}, nil
+}
 
-	if err = validateHostname(opts); err != nil {
-		return nil, err
+// Table returns the table that the HostOpts refer to
+func (p *ParsedHostOpts) Table() string {
+	return p.opts.table
+}
+
+// Host returns a copy of the host described by the HostOpts.
+// Fields that were not specified hold the values from DefaultHost
+func (p *ParsedHostOpts) Host() *Host {
+	host := *p.opts.host
+	return &host
+}
+
+// Fields returns the columns that were specified, in the order they were
+// specified. The table, and columns in predicates, are not included
+func (p *ParsedHostOpts) Fields() []string {
+	return append([]string(nil), p.opts.specifiedFields...)
+}
+
+// TableOnly reports whether the HostOpts specify nothing but the table,
+// as All requires
+func (p *ParsedHostOpts) TableOnly() bool {
+	return p.opts.tableOnly()
+}
+
+// Matches reports whether the given host has the same value as the HostOpts
+// for every specified column, and satisfies every predicate from Where.
+// Ordering and limits are not taken in to account, see Select
+func (p *ParsedHostOpts) Matches(h *Host) bool {
+	return p.opts.matches(h)
+}
+
+// Select returns the hosts that match, ordered and limited as ProxySQL
+// would return them from HostsLike. The hosts are not copied
+func (p *ParsedHostOpts) Select(hosts []*Host) []*Host {
+	selected := make([]*Host, 0)
+	for _, host := range hosts {
+		if p.opts.matches(host) {
+			selected = append(selected, host)
+		}
 	}
-	return opts, nil
+	p.opts.sortHosts(selected)
+	if p.opts.limited() && len(selected) > p.opts.limit {
+		selected = selected[:p.opts.limit]
+	}
+	return selected
 }
@@ -1,6 +1,7 @@
 package proxysql
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -115,7 +116,7 @@ func TestBuildAndParseEmptyHostQuery(t *testing.T) {
 
 func TestBuildAndParseEmptyHostQueryWithHostnameFailsHostnameValidation(t *testing.T) {
 	opts, err := buildAndParseHostQueryWithHostname()
-	if err != ErrConfigNoHostname {
+	if !errors.Is(err, ErrConfigNoHostname) {
 		t.Logf("did not get expected err: %v", err)
 		t.Fail()
 	}
@@ -126,7 +127,7 @@ func TestBuildAndParseEmptyHostQueryWithHostnameFailsHostnameValidation(t *testi
 
 func TestBuildAndParseHostQueryWithHostnameFailsWhenParentFails(t *testing.T) {
 	opts, err := buildAndParseHostQueryWithHostname(Port(1), Port(2))
-	if err != ErrConfigDuplicateSpec {
+	if !errors.Is(err, ErrConfigDuplicateSpec) {
 		t.Logf("did not get expected err: %v", err)
 		t.Fail()
 	}
@@ -159,7 +160,7 @@ func TestBuildAndParseHostQueryWithHostgroupID(t *testing.T) {
 
 func TestBuildAndParseHostQueryError(t *testing.T) {
 	opts, err := buildAndParseHostQuery(HostgroupID(-1))
-	if err != ErrConfigBadHostgroupID {
+	if !errors.Is(err, ErrConfigBadHostgroupID) {
 		t.Logf("did not receive expected err: %v", err)
 		t.Fail()
 	}
@@ -198,7 +199,7 @@ func TestBuildSpecifiedColumnsDifferentOrder(t *testing.T) {
 
 func TestBuildSpecifiedColumnsDoesntGiveUsDuplicates(t *testing.T) {
 	opts, err := buildAndParseHostQuery(Port(1), HostgroupID(12), Port(2))
-	if err != ErrConfigDuplicateSpec {
+	if !errors.Is(err, ErrConfigDuplicateSpec) {
 		t.Logf("unexpected parse error: %v", err)
 		t.Fail()
 	}
@@ -317,3 +318,44 @@ func TestBuildDeleteQueryLimit(t *testing.T) {
 		}
 	}
 }
+
+func TestParseHostOptsExposesQuery(t *testing.T) {
+	parsed, err := ParseHostOpts(Table("runtime_mysql_servers"), Port(3307), Hostname("host"))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if parsed.Table() != "runtime_mysql_servers" {
+		t.Fatalf("did not expose table: %s", parsed.Table())
+	}
+	if !reflect.DeepEqual(parsed.Fields(), []string{"port", "hostname"}) {
+		t.Fatalf("did not expose fields in order: %v", parsed.Fields())
+	}
+	if !reflect.DeepEqual(parsed.Host(), DefaultHost().SetPort(3307).SetHostname("host")) {
+		t.Fatalf("did not expose host: %v", parsed.Host())
+	}
+	parsed.Host().SetPort(1)
+	if parsed.Host().Port() != 3307 {
+		t.Fatal("host returned was not a copy")
+	}
+}
+
+func TestParseHostOptsPropagatesValidationError(t *testing.T) {
+	parsed, err := ParseHostOpts(Port(-1))
+	if !errors.Is(err, ErrConfigBadPort) || parsed != nil {
+		t.Fatalf("did not receive validation error: %v, %v", parsed, err)
+	}
+}
+
+func TestParsedHostOptsMatchesOnSpecifiedFields(t *testing.T) {
+	parsed, _ := ParseHostOpts(HostgroupID(1), Hostname("host"))
+	if !parsed.Matches(DefaultHost().SetHostgroupID(1).SetHostname("host").SetWeight(3)) {
+		t.Fatal("did not match host with same specified fields")
+	}
+	if parsed.Matches(DefaultHost().SetHostgroupID(2).SetHostname("host")) {
+		t.Fatal("matched host with different hostgroup")
+	}
+	empty, _ := ParseHostOpts()
+	if !empty.Matches(DefaultHost().SetHostname("anything")) {
+		t.Fatal("empty opts did not match every host")
+	}
+}
@@ -0,0 +1,226 @@
+package proxysql
+
+// this file is for planning and applying the changes that make the hosts in
+// part of mysql_servers match a desired list
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPlanStale is returned by Apply when the hosts in the scope of a plan
+// changed after it was made
+var ErrPlanStale = errors.New("Stale plan, the hosts in its scope changed after it was made")
+
+// Plan is the changes that make the hosts in a scope of mysql_servers match
+// a desired list of hosts. Make one with ProxySQL.Plan, show it, and apply it
+// with ProxySQL.Apply. Hosts are matched to the desired ones by Host.Key
+type Plan struct {
+	// Inserts are the desired hosts whose keys are not in the scope
+	Inserts Hosts
+	// Updates are the hosts in the scope whose keys are desired, but whose
+	// other columns differ from the desired ones
+	Updates []HostUpdate
+	// Deletes are the hosts in the scope whose keys are not desired
+	Deletes Hosts
+	// Drift is the hosts in the scope whose rows in memory and runtime
+	// differ, such as changes that were not persisted, or servers that
+	// ProxySQL shunned. Applying a plan with changes loads memory to runtime
+	Drift []HostDrift
+
+	scope   []HostOpts
+	current Hosts
+}
+
+// HostUpdate is a host whose columns change to those of New
+type HostUpdate struct {
+	Old   *Host
+	New   *Host
+	Diffs []FieldDiff
+}
+
+// HostDrift is a server whose rows in memory and runtime differ. Memory or
+// Runtime is nil if the server is only in the other
+type HostDrift struct {
+	Key     HostKey
+	Memory  *Host
+	Runtime *Host
+	// Diffs are the columns that differ from memory to runtime
+	Diffs []FieldDiff
+}
+
+// Empty reports whether the plan changes nothing. A plan without changes can
+// still report Drift
+func (pl *Plan) Empty() bool {
+	return len(pl.Inserts) == 0 && len(pl.Updates) == 0 && len(pl.Deletes) == 0
+}
+
+// String returns the plan with a line for each change, starting with + for
+// an insert, ~ for an update, - for a delete and ! for drift. Updates and
+// drift list the columns that differ, like
+//
+//	~ db-2:3306 in hostgroup 1 (weight: 1 -> 5)
+func (pl *Plan) String() string {
+	var lines []string
+	for _, h := range pl.Inserts {
+		lines = append(lines, fmt.Sprintf("+ %s", h.Key()))
+	}
+	for _, u := range pl.Updates {
+		lines = append(lines, fmt.Sprintf("~ %s (%s)", u.New.Key(), joinDiffs(u.Diffs)))
+	}
+	for _, h := range pl.Deletes {
+		lines = append(lines, fmt.Sprintf("- %s", h.Key()))
+	}
+	for _, d := range pl.Drift {
+		switch {
+		case d.Runtime == nil:
+			lines = append(lines, fmt.Sprintf("! %s is not in runtime", d.Key))
+		case d.Memory == nil:
+			lines = append(lines, fmt.Sprintf("! %s is only in runtime", d.Key))
+		default:
+			lines = append(lines, fmt.Sprintf("! %s drifted (%s)", d.Key, joinDiffs(d.Diffs)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func joinDiffs(diffs []FieldDiff) string {
+	parts := make([]string, len(diffs))
+	for i, d := range diffs {
+		parts[i] = d.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Plan reads the hosts of mysql_servers that match the scope, with HostsLike,
+// and returns the changes that make them match desired. The scope is given
+// as HostOpts like those of HostsLike, such as HostgroupID(1), or
+// Where(In("hostgroup_id", 1, 2)), and hosts outside of it are never changed.
+// With no scope, every host is in it.
+// This will return ErrPlanBadScope if the scope gives Table or Limit, and a
+// *HostError if a desired host is not valid, does not match the scope
+// (ErrPlanOutOfScope), or has the key of an earlier one
+// (ErrPlanDuplicateHost). This propagates errors from HostsLike
+func (p *ProxySQL) Plan(desired Hosts, scope ...HostOpts) (*Plan, error) {
+	return p.PlanContext(context.Background(), desired, scope...)
+}
+
+// PlanContext is Plan with a context
+func (p *ProxySQL) PlanContext(ctx context.Context, desired Hosts, scope ...HostOpts) (plan *Plan, err error) {
+	op := p.begin(ctx, "Plan")
+	defer op.end(&err)
+	hostq, err := buildAndParseHostQuery(scope...)
+	if err != nil {
+		return nil, err
+	}
+	if hostq.table != "mysql_servers" || hostq.limited() {
+		return nil, invalidField("scope", nil, ErrPlanBadScope)
+	}
+	op.annotate(hostAttributes(hostq)...)
+	keys := make(map[HostKey]bool, len(desired))
+	for i, host := range desired {
+		err := host.Valid()
+		switch {
+		case err != nil:
+		case !hostq.matches(host):
+			err = invalidField("scope", host.Key().String(), ErrPlanOutOfScope)
+		case keys[host.Key()]:
+			err = invalidField("key", host.Key().String(), ErrPlanDuplicateHost)
+		}
+		if err != nil {
+			return nil, &HostError{Host: host, Index: i, Err: err}
+		}
+		keys[host.Key()] = true
+	}
+	current, err := p.HostsLikeContext(op.ctx, scope...)
+	if err != nil {
+		return nil, err
+	}
+	runtime, err := p.HostsLikeContext(op.ctx, append(scope[:len(scope):len(scope)], Table("runtime_mysql_servers"))...)
+	if err != nil {
+		return nil, err
+	}
+	plan = &Plan{
+		Inserts: desired.SubtractByKey(current),
+		Deletes: Hosts(current).SubtractByKey(desired),
+		Drift:   drift(current, runtime),
+		scope:   scope,
+		current: current,
+	}
+	for _, host := range desired.IntersectByKey(current) {
+		old := Hosts(current).Find(host.Key())
+		if diffs := old.Diff(host); diffs != nil {
+			plan.Updates = append(plan.Updates, HostUpdate{Old: old, New: host, Diffs: diffs})
+		}
+	}
+	op.annotate(Attribute{AttributeRows, int64(len(plan.Inserts) + len(plan.Updates) + len(plan.Deletes))})
+	return plan, nil
+}
+
+// drift returns the servers whose rows differ between memory and runtime
+func drift(memory, runtime Hosts) []HostDrift {
+	var drifts []HostDrift
+	for _, m := range memory {
+		r := runtime.Find(m.Key())
+		if r == nil {
+			drifts = append(drifts, HostDrift{Key: m.Key(), Memory: m})
+		} else if diffs := m.Diff(r); diffs != nil {
+			drifts = append(drifts, HostDrift{Key: m.Key(), Memory: m, Runtime: r, Diffs: diffs})
+		}
+	}
+	for _, r := range runtime.SubtractByKey(memory) {
+		drifts = append(drifts, HostDrift{Key: r.Key(), Runtime: r})
+	}
+	return drifts
+}
+
+// Apply makes the changes of a plan as one ChangeSet, deleting, then
+// updating, then inserting hosts, and persists them once. Nothing is done
+// for a plan without changes.
+// This will return ErrPlanNil for a nil plan, and ErrPlanStale, and change
+// nothing, if the hosts in the scope of the plan are not what they were when
+// it was made. The hosts are compared under the same lock that the changes
+// are made with. This propagates errors from reading the hosts and from
+// ChangeSet.Apply
+func (p *ProxySQL) Apply(plan *Plan) error {
+	return p.ApplyContext(context.Background(), plan)
+}
+
+// ApplyContext is Apply with a context
+func (p *ProxySQL) ApplyContext(ctx context.Context, plan *Plan) (err error) {
+	op := p.begin(ctx, "Apply")
+	defer op.end(&err)
+	if plan == nil {
+		return invalidField("plan", nil, ErrPlanNil)
+	}
+	if plan.Empty() {
+		return nil
+	}
+	op.annotate(Attribute{AttributeRows, int64(len(plan.Inserts) + len(plan.Updates) + len(plan.Deletes))})
+	hostq, err := buildAndParseHostQuery(plan.scope...)
+	if err != nil {
+		return err
+	}
+	// the hosts are read again under the lock that the changes are made
+	// with, so that nothing changes them in between
+	changes := p.NewChangeSet().require(func(ctx context.Context, p *ProxySQL) error {
+		current, err := hostsLike(ctx, p, hostq)
+		if err != nil {
+			return err
+		}
+		if len(current) != len(plan.current) || len(Hosts(current).Subtract(plan.current)) != 0 {
+			return ErrPlanStale
+		}
+		return nil
+	})
+	for _, host := range plan.Deletes {
+		changes.RemoveHost(host)
+	}
+	for _, update := range plan.Updates {
+		changes.UpdateHost(update.Old, update.New)
+	}
+	changes.AddHosts(plan.Inserts...)
+	return changes.ApplyContext(op.ctx)
+}
@@ -0,0 +1,164 @@
+package proxysql
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPlanAndApply(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.AddHosts(
+		DefaultHost().SetHostname("kept").SetHostgroupID(1),
+		DefaultHost().SetHostname("updated").SetHostgroupID(1),
+		DefaultHost().SetHostname("removed").SetHostgroupID(1),
+		DefaultHost().SetHostname("other").SetHostgroupID(2),
+	)
+	conn.PersistChanges()
+	desired := Hosts{
+		DefaultHost().SetHostname("kept").SetHostgroupID(1),
+		DefaultHost().SetHostname("updated").SetHostgroupID(1).SetWeight(5),
+		DefaultHost().SetHostname("added").SetHostgroupID(1),
+	}
+	plan, err := conn.Plan(desired, HostgroupID(1))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(plan.Inserts) != 1 || plan.Inserts[0].Hostname() != "added" {
+		t.Fatalf("unexpected inserts: %v", plan.Inserts)
+	}
+	if len(plan.Updates) != 1 || plan.Updates[0].Old.Hostname() != "updated" || len(plan.Updates[0].Diffs) != 1 {
+		t.Fatalf("unexpected updates: %+v", plan.Updates)
+	}
+	if len(plan.Deletes) != 1 || plan.Deletes[0].Hostname() != "removed" {
+		t.Fatalf("unexpected deletes: %v", plan.Deletes)
+	}
+	if len(plan.Drift) != 0 || plan.Empty() {
+		t.Fatalf("unexpected drift: %+v", plan.Drift)
+	}
+	expected := "+ added:3306 in hostgroup 1\n~ updated:3306 in hostgroup 1 (weight: 1 -> 5)\n- removed:3306 in hostgroup 1"
+	if plan.String() != expected {
+		t.Fatalf("unexpected plan:\n%s", plan)
+	}
+	before := countQueries(server.Queries(), "load mysql servers to runtime")
+	if err := conn.Apply(plan); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if n := countQueries(server.Queries(), "load mysql servers to runtime") - before; n != 1 {
+		t.Fatalf("expected a single persist, got %d", n)
+	}
+	hosts, _ := conn.HostsLike(HostgroupID(1))
+	if len(hosts) != 3 || len(desired.Subtract(hosts)) != 0 {
+		t.Fatalf("hosts do not match the desired ones: %v", hosts)
+	}
+	if other, _ := conn.HostsLike(HostgroupID(2)); len(other) != 1 {
+		t.Fatalf("host outside of the scope was changed: %v", other)
+	}
+	plan, err = conn.Plan(desired, HostgroupID(1))
+	if err != nil || !plan.Empty() || len(plan.Drift) != 0 {
+		t.Fatalf("applied plan did not converge: %v, %v", plan, err)
+	}
+}
+
+func TestPlanReportsDrift(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.AddHosts(DefaultHost().SetHostname("loaded"), DefaultHost().SetHostname("changed"))
+	conn.PersistChanges()
+	conn.RemoveHostsLike(Hostname("loaded"))
+	conn.AddHost(Hostname("new"))
+	changed := DefaultHost().SetHostname("changed")
+	conn.Conn().Exec("update mysql_servers set status = 'OFFLINE_SOFT' where hostname = 'changed'")
+	plan, err := conn.Plan(Hosts{changed.Clone().SetStatus("OFFLINE_SOFT"), DefaultHost().SetHostname("new")})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !plan.Empty() {
+		t.Fatalf("plan was not empty: %v", plan)
+	}
+	drifted := make(map[string]HostDrift)
+	for _, d := range plan.Drift {
+		drifted[d.Key.Hostname] = d
+	}
+	if len(drifted) != 3 || drifted["loaded"].Memory != nil || drifted["new"].Runtime != nil || len(drifted["changed"].Diffs) != 1 {
+		t.Fatalf("unexpected drift: %+v", plan.Drift)
+	}
+	for _, line := range []string{"! changed:3306 in hostgroup 0 drifted (status: OFFLINE_SOFT -> ONLINE)", "! new:3306 in hostgroup 0 is not in runtime", "! loaded:3306 in hostgroup 0 is only in runtime"} {
+		if !strings.Contains(plan.String(), line) {
+			t.Errorf("plan does not have %q:\n%s", line, plan)
+		}
+	}
+}
+
+func TestPlanValidates(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	if _, err := conn.Plan(nil, Limit(1)); !errors.Is(err, ErrPlanBadScope) {
+		t.Fatalf("limited scope was accepted: %v", err)
+	}
+	if _, err := conn.Plan(nil, Table("runtime_mysql_servers")); !errors.Is(err, ErrPlanBadScope) {
+		t.Fatalf("scope in another table was accepted: %v", err)
+	}
+	hosts := Hosts{DefaultHost().SetHostname("a").SetHostgroupID(1), DefaultHost().SetHostname("b").SetHostgroupID(2)}
+	_, err := conn.Plan(hosts, HostgroupID(1))
+	var hostErr *HostError
+	if !errors.As(err, &hostErr) || hostErr.Index != 1 || !errors.Is(err, ErrPlanOutOfScope) {
+		t.Fatalf("host outside of the scope was accepted: %v", err)
+	}
+	hosts = Hosts{DefaultHost().SetHostname("a"), DefaultHost().SetHostname("a").SetWeight(2)}
+	if _, err := conn.Plan(hosts); !errors.Is(err, ErrPlanDuplicateHost) {
+		t.Fatalf("duplicate key was accepted: %v", err)
+	}
+	if _, err := conn.Plan(Hosts{DefaultHost().SetHostname("a").SetPort(-1)}); !errors.Is(err, ErrConfigBadPort) {
+		t.Fatalf("invalid host was accepted: %v", err)
+	}
+	if err := conn.Apply(nil); !errors.Is(err, ErrPlanNil) || ErrorClass(err) != ErrorClassValidation {
+		t.Fatalf("nil plan was accepted: %v", err)
+	}
+}
+
+func TestApplyChecksPlanUnderLock(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	plan, err := conn.Plan(Hosts{DefaultHost().SetHostname("a")})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// the hosts are read again under the write lock that Apply changes them
+	// with, so no reader could take the lock then
+	var unlocked atomic.Int32
+	server.SetQueryHook(func(q string) error {
+		if strings.HasPrefix(q, "select") && mut.TryRLock() {
+			mut.RUnlock()
+			unlocked.Add(1)
+		}
+		return nil
+	})
+	if err := conn.Apply(plan); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if n := unlocked.Load(); n != 0 {
+		t.Fatalf("%d selects were run without the write lock", n)
+	}
+}
+
+func TestApplyRejectsStalePlan(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	plan, err := conn.Plan(Hosts{DefaultHost().SetHostname("a")})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	conn.AddHost(Hostname("b"))
+	if err := conn.Apply(plan); err != ErrPlanStale {
+		t.Fatalf("stale plan was applied: %v", err)
+	}
+	if hosts, _ := conn.HostsLike(Hostname("a")); len(hosts) != 0 {
+		t.Fatal("stale plan changed ProxySQL")
+	}
+	if err := conn.Apply(&Plan{}); err != nil {
+		t.Fatalf("empty plan failed: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package proxysql
+
+// this file is for removing secrets from statements before they are reported
+
+import (
+	"regexp"
+	"strings"
+)
+
+// columns and variables whose values are secret, like mysql_users.password
+// and admin-admin_credentials
+var secretPattern = regexp.MustCompile(`(?i)password|credentials|secret`)
+
+const redacted = "'<redacted>'"
+
+type sqlToken struct {
+	text       string
+	start, end int
+	literal    bool
+}
+
+// redact replaces the string literals in a statement that hold secrets with
+// '<redacted>'. These are the values of secret columns in inserts, updates
+// and comparisons, and every value in a statement that compares
+// variable_name to a secret variable, as in
+//
+//	update global_variables set variable_value = 'pw' where variable_name = 'mysql-monitor_password'
+//
+// Other literals that mention secrets, like comments, do not hide the rest of
+// the statement. Statements may be fragments, like the where clause of one
+func redact(statement string) string {
+	tokens := sqlTokens(statement)
+	secret := make(map[int]bool)
+	namesSecret := false
+	for i, token := range tokens {
+		if !token.literal {
+			continue
+		}
+		column := comparedColumn(tokens, i)
+		if column < 0 {
+			continue
+		}
+		// password = 'pw', password != 'pw', password in ('a', 'pw')
+		if secretPattern.MatchString(tokens[column].text) {
+			secret[i] = true
+		}
+		// variable_name = 'mysql-monitor_password'
+		if strings.EqualFold(tokens[column].text, "variable_name") && secretPattern.MatchString(token.text) {
+			namesSecret = true
+		}
+	}
+	for _, i := range secretInsertValues(tokens) {
+		secret[i] = true
+	}
+	if namesSecret {
+		for i, token := range tokens {
+			if token.literal && !secretPattern.MatchString(token.text) {
+				secret[i] = true
+			}
+		}
+	}
+	if len(secret) == 0 {
+		return statement
+	}
+	var b strings.Builder
+	last := 0
+	for i, token := range tokens {
+		if secret[i] {
+			b.WriteString(statement[last:token.start])
+			b.WriteString(redacted)
+			last = token.end
+		}
+	}
+	b.WriteString(statement[last:])
+	return b.String()
+}
+
+// comparedColumn returns the index of the column that the literal at i is
+// compared to, with an operator like =, !=, <= or like, or in a list of in,
+// or -1 if it is not compared to a column
+func comparedColumn(tokens []sqlToken, i int) int {
+	j := i - 1
+	for j >= 0 && (tokens[j].literal || tokens[j].text == ",") {
+		j--
+	}
+	if j >= 1 && tokens[j].text == "(" && strings.EqualFold(tokens[j-1].text, "in") {
+		j -= 2
+	} else if j = i - 1; j >= 0 && strings.EqualFold(tokens[j].text, "like") {
+		j--
+	} else {
+		for j >= 0 && !tokens[j].literal && strings.Contains("=!<>", tokens[j].text) {
+			j--
+		}
+		if j == i-1 {
+			return -1
+		}
+	}
+	if j < 0 || tokens[j].literal {
+		return -1
+	}
+	return j
+}
+
+// secretInsertValues returns the tokens of an insert's values that are in
+// secret columns, or in the variable_value of a secret variable, as in
+//
+//	insert into mysql_users (username, password) values ('app', 'pw')
+//	insert into global_variables (variable_name, variable_value) values ('mysql-monitor_password', 'pw')
+func secretInsertValues(tokens []sqlToken) []int {
+	start := -1
+	for i := 0; i+2 < len(tokens); i++ {
+		if strings.EqualFold(tokens[i].text, "into") && tokens[i+2].text == "(" {
+			start = i + 3
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	var columns []string
+	i := start
+	for ; i < len(tokens) && tokens[i].text != ")"; i++ {
+		if tokens[i].text != "," {
+			columns = append(columns, tokens[i].text)
+		}
+	}
+	if i+1 >= len(tokens) || !strings.EqualFold(tokens[i+1].text, "values") {
+		return nil
+	}
+	var secret []int
+	depth, pos := 0, 0
+	// the literals of the row, by column
+	var row map[string]int
+	namesSecret := false
+	for i += 2; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+			if depth == 1 {
+				pos, row, namesSecret = 0, make(map[string]int), false
+			}
+		case ")":
+			depth--
+			if value, ok := row["variable_value"]; depth == 0 && namesSecret && ok {
+				secret = append(secret, value)
+			}
+		case ",":
+			if depth == 1 {
+				pos++
+			}
+		default:
+			if !tokens[i].literal || depth != 1 || pos >= len(columns) {
+				continue
+			}
+			column := strings.ToLower(columns[pos])
+			row[column] = i
+			if secretPattern.MatchString(column) {
+				secret = append(secret, i)
+			}
+			if column == "variable_name" && secretPattern.MatchString(tokens[i].text) {
+				namesSecret = true
+			}
+		}
+	}
+	return secret
+}
+
+// sqlTokens splits a statement into string literals, words and punctuation.
+// The text of a literal is its value, without quotes
+func sqlTokens(s string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			var value strings.Builder
+			j := i + 1
+			for j < len(s) {
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						value.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				value.WriteByte(s[j])
+				j++
+			}
+			end := j + 1
+			if end > len(s) {
+				end = len(s)
+			}
+			tokens = append(tokens, sqlToken{value.String(), i, end, true})
+			i = end
+		case isWordByte(c):
+			j := i
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{s[i:j], i, j, false})
+			i = j
+		default:
+			tokens = append(tokens, sqlToken{s[i : i+1], i, i + 1, false})
+			i++
+		}
+	}
+	return tokens
+}
+
+// words include the - in variable names like mysql-monitor_password, and the
+// . in qualified names like disk.mysql_users
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.' || c == '@' || c == '`'
+}
@@ -0,0 +1,245 @@
+package proxysql
+
+// this file is for retrying statements that fail while ProxySQL is restarting
+// or its admin interface is busy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// RetryPolicy is how a client retries statements that fail with transient
+// errors. Statements that change nothing when run twice, like selects,
+// deletes, updates, and LOAD and SAVE commands, are retried. Inserts are
+// retried only after checking that the failed attempt did not insert the
+// rows, and if it did, the insert is treated as having succeeded
+type RetryPolicy struct {
+	// MaxAttempts is the most times a statement is run. 1 or less disables
+	// retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait before any retry
+	MaxBackoff time.Duration
+	// Multiplier is what the wait is multiplied by after each retry
+	Multiplier float64
+	// Jitter is the fraction of each wait, in [0, 1], that is randomized, so
+	// that clients restarting together do not retry together
+	Jitter float64
+	// Retryable reports whether an error is transient. nil uses IsRetryable
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy returns a policy that makes 4 attempts, waiting 100ms,
+// then 200ms, then 400ms, each randomized by up to 20%
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// SetRetryPolicy sets how the client retries statements that fail with
+// transient errors. Clients do not retry unless this is called. Zero values
+// of InitialBackoff, MaxBackoff and Multiplier are taken from
+// DefaultRetryPolicy.
+func (p *ProxySQL) SetRetryPolicy(policy RetryPolicy) {
+	defaults := DefaultRetryPolicy()
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = defaults.InitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaults.MaxBackoff
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = defaults.Multiplier
+	}
+	policy.Jitter = math.Max(0, math.Min(1, policy.Jitter))
+	p.settingsMut.Lock()
+	defer p.settingsMut.Unlock()
+	p.retryPolicy = policy
+}
+
+// RetryPolicy returns the policy set with SetRetryPolicy
+func (p *ProxySQL) RetryPolicy() RetryPolicy {
+	p.settingsMut.RLock()
+	defer p.settingsMut.RUnlock()
+	return p.retryPolicy
+}
+
+// MySQL error numbers that mean the statement could succeed if it were run
+// again: too many connections, the server shutting down, lock and connection
+// timeouts, and the client errors for a lost or refused connection
+var retryableCodes = map[uint16]bool{
+	1040: true, // ER_CON_COUNT_ERROR
+	1053: true, // ER_SERVER_SHUTDOWN
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+	2002: true, // CR_CONNECTION_ERROR
+	2003: true, // CR_CONN_HOST_ERROR
+	2006: true, // CR_SERVER_GONE_ERROR
+	2013: true, // CR_SERVER_LOST
+	9001: true, // ProxySQL's max connect timeout
+}
+
+// IsRetryable reports whether err is transient: a lost, refused or reset
+// connection, a network timeout, or a MySQL error such as too many
+// connections. Other network errors, like a host that can not be resolved,
+// are not transient. Errors from the admin interface rejecting a statement, which
+// ProxySQL reports as error 1045, are not transient
+func IsRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &mysqlErr):
+		return retryableCodes[mysqlErr.Number]
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+func (r RetryPolicy) retryable(err error) bool {
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff is the wait after the given failed attempt, starting from 1
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(r.InitialBackoff) * math.Pow(r.Multiplier, float64(attempt-1))
+	wait = math.Min(wait, float64(r.MaxBackoff))
+	// spread the wait evenly over wait ± Jitter * wait
+	wait += wait * r.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(wait)
+}
+
+// retry calls run until it succeeds, fails with an error that is not
+// retryable, or the policy runs out of attempts. run is told whether an
+// earlier attempt failed. Nothing is retried unless safe is true, or once
+// ctx is done, but the client fails over after any retryable error. The
+// lock is let go while backing off, so that other calls are not held up
+func retry(ctx context.Context, p *ProxySQL, safe bool, run func(retrying bool) error) error {
+	policy := p.RetryPolicy()
+	for attempt := 1; ; attempt++ {
+		err := run(attempt > 1)
+		if err == nil || !policy.retryable(err) {
+			return err
+		}
+		p.failover(ctx)
+		if !safe || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		if backOff(ctx, policy.backoff(attempt)) != nil {
+			return err
+		}
+	}
+}
+
+// backOff waits for d, without the lock of the operation of ctx, if it may
+// be let go. This returns ctx's error if ctx is done first
+func backOff(ctx context.Context, d time.Duration) error {
+	if o := operationOf(ctx); o != nil {
+		defer o.release()()
+	}
+	return sleep(ctx, d)
+}
+
+// sleepContext waits for d, or until ctx is done, returning ctx's error
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// execRetrying runs a statement, retrying it by the client's policy. Inserts
+// are only retried when landed is given. Before an insert is retried, landed
+// is called to check whether the failed attempt inserted the rows anyway,
+// and if it did the statement is not run again, and the result is nil
+func execRetrying(ctx context.Context, p *ProxySQL, statement string, landed func() (bool, error)) (sql.Result, error) {
+	var result sql.Result
+	insert := isInsert(statement)
+	err := retry(ctx, p, !insert || landed != nil, func(retrying bool) error {
+		if retrying && insert {
+			done, err := landed()
+			if err != nil || done {
+				// the failed attempt inserted the rows
+				if o := operationOf(ctx); o != nil && done {
+					o.ran(statement)
+				}
+				result = nil
+				return err
+			}
+		}
+		var err error
+		result, err = execStatement(ctx, p, statement)
+		return err
+	})
+	return result, err
+}
+
+// queryRetrying runs a query, retrying it by the client's policy. Errors
+// from reading the rows it returns are not retried
+func queryRetrying(ctx context.Context, p *ProxySQL, queryString string) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := retry(ctx, p, true, func(bool) error {
+		var err error
+		rows, err = queryStatement(ctx, p, queryString)
+		return err
+	})
+	return rows, err
+}
+
+// rowsLanded returns a check for execRetrying that reports whether at least n
+// rows of the table match a where clause like " where a = 1"
+func rowsLanded(ctx context.Context, p *ProxySQL, table, where string, n int) func() (bool, error) {
+	return func() (bool, error) {
+		var count int
+		countQuery := fmt.Sprintf("select count(*) from %s%s", table, where)
+		rows, err := queryStatement(ctx, p, countQuery)
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			return false, rowsErr(rows)
+		}
+		if err := scanRows(rows, &count); err != nil {
+			return false, err
+		}
+		return count >= n, nil
+	}
+}
+
+// statements other than inserts have the same effect when they are run again
+func isInsert(statement string) bool {
+	fields := strings.Fields(statement)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "insert")
+}
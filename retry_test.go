@@ -0,0 +1,257 @@
+package proxysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/kirinrastogi/proxysql-go/proxysqltest"
+)
+
+func TestIsRetryable(t *testing.T) {
+	retryable := []error{
+		driver.ErrBadConn,
+		mysql.ErrInvalidConn,
+		syscall.ECONNREFUSED,
+		&net.OpError{Op: "dial", Err: syscall.ECONNRESET},
+		&net.OpError{Op: "read", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}},
+		&mysql.MySQLError{Number: 1040, Message: "Too many connections"},
+		&mysql.MySQLError{Number: 2013, Message: "Lost connection"},
+		opError("mysql_servers", "delete from mysql_servers", mysql.ErrInvalidConn),
+	}
+	for _, err := range retryable {
+		if !IsRetryable(err) {
+			t.Errorf("%v was not retryable", err)
+		}
+	}
+	permanent := []error{
+		nil,
+		errors.New("mock"),
+		ErrConfigBadPort,
+		&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "db-1", IsNotFound: true}},
+		&mysql.MySQLError{Number: 1045, Message: "ProxySQL Admin Error: near \"x\": syntax error"},
+		opError("mysql_servers", "insert into mysql_servers", &mysql.MySQLError{Number: 1045}),
+	}
+	for _, err := range permanent {
+		if IsRetryable(err) {
+			t.Errorf("%v was retryable", err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, wait := range expected {
+		if backoff := policy.backoff(i + 1); backoff != wait*time.Millisecond {
+			t.Errorf("attempt %d waited %v, expected %v", i+1, backoff, wait*time.Millisecond)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if backoff := policy.backoff(2); backoff < 100*time.Millisecond || backoff > 300*time.Millisecond {
+			t.Fatalf("jittered wait %v is not within 50%% of 200ms", backoff)
+		}
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	p := &ProxySQL{}
+	if p.RetryPolicy().MaxAttempts > 1 {
+		t.Fatal("clients retry by default")
+	}
+	p.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Jitter: 2})
+	policy := p.RetryPolicy()
+	defaults := DefaultRetryPolicy()
+	if policy.MaxAttempts != 3 || policy.InitialBackoff != defaults.InitialBackoff || policy.MaxBackoff != defaults.MaxBackoff ||
+		policy.Multiplier != defaults.Multiplier || policy.Jitter != 1 {
+		t.Fatalf("zero values were not defaulted: %+v", policy)
+	}
+}
+
+// failFirst returns a query hook that returns err for the first n queries
+// that start with prefix
+func failFirst(n int, prefix string, err error) func(string) error {
+	return func(q string) error {
+		if strings.HasPrefix(q, prefix) && n > 0 {
+			n--
+			return err
+		}
+		return nil
+	}
+}
+
+func countQueries(queries []string, prefix string) int {
+	count := 0
+	for _, q := range queries {
+		if strings.HasPrefix(q, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func retrySetup(t *testing.T) (*ProxySQL, *proxysqltest.Server, *[]time.Duration) {
+	conn, server := serverSetup(t)
+	conn.Conn().SetMaxIdleConns(0)
+	conn.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	waits := &[]time.Duration{}
+	sleep = func(_ context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	return conn, server, waits
+}
+
+func TestRetryLostConnection(t *testing.T) {
+	conn, server, waits := retrySetup(t)
+	defer resetHelpers()
+	defer serverTeardown(conn, server)
+	conn.AddHost(Hostname("db-1"))
+	server.SetQueryHook(failFirst(2, "delete", proxysqltest.ErrDropConnection))
+	if err := conn.RemoveHostsLike(Hostname("db-1")); err != nil {
+		t.Fatalf("delete was not retried: %v", err)
+	}
+	if len(*waits) != 2 || (*waits)[0] != time.Millisecond || (*waits)[1] != 2*time.Millisecond {
+		t.Fatalf("unexpected waits: %v", *waits)
+	}
+	server.SetQueryHook(failFirst(1, "select", &proxysqltest.Error{Code: 1040, State: "08004", Message: "Too many connections"}))
+	if hosts, err := conn.All(); err != nil || len(hosts) != 0 {
+		t.Fatalf("select was not retried: %v, %v", hosts, err)
+	}
+	server.SetQueryHook(failFirst(1, "load", proxysqltest.ErrDropConnection))
+	if err := conn.PersistChanges(); err != nil {
+		t.Fatalf("load was not retried: %v", err)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	conn, server, waits := retrySetup(t)
+	defer resetHelpers()
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(failFirst(10, "delete", proxysqltest.ErrDropConnection))
+	before := len(server.Queries())
+	err := conn.Clear()
+	if !errors.Is(err, mysql.ErrInvalidConn) {
+		t.Fatalf("expected the connection error, got: %v", err)
+	}
+	if attempts := countQueries(server.Queries()[before:], "delete"); attempts != 3 || len(*waits) != 2 {
+		t.Fatalf("made %d attempts and %d waits, expected 3 and 2", attempts, len(*waits))
+	}
+	// admin errors are not transient
+	server.SetQueryHook(failFirst(10, "delete", errors.New("no such table")))
+	before = len(server.Queries())
+	if err := conn.Clear(); err == nil || countQueries(server.Queries()[before:], "delete") != 1 {
+		t.Fatalf("admin error was retried: %v", err)
+	}
+}
+
+func TestRetryBacksOffWithoutTheLock(t *testing.T) {
+	conn, server, _ := retrySetup(t)
+	defer resetHelpers()
+	defer serverTeardown(conn, server)
+	var unlocked []bool
+	sleep = func(context.Context, time.Duration) error {
+		locked := !mut.TryLock()
+		if !locked {
+			mut.Unlock()
+		}
+		unlocked = append(unlocked, !locked)
+		return nil
+	}
+	conn.AddHost(Hostname("db-1"))
+	server.SetQueryHook(failFirst(1, "delete", proxysqltest.ErrDropConnection))
+	if err := conn.RemoveHostsLike(Hostname("db-1")); err != nil {
+		t.Fatalf("delete was not retried: %v", err)
+	}
+	// change sets keep the lock, so that nothing runs between their changes
+	conn.AddHost(Hostname("db-1"))
+	server.SetQueryHook(failFirst(1, "delete", proxysqltest.ErrDropConnection))
+	if err := conn.NewChangeSet().RemoveHostsLike(Hostname("db-1")).Apply(); err != nil {
+		t.Fatalf("change set was not retried: %v", err)
+	}
+	if len(unlocked) != 2 || !unlocked[0] || unlocked[1] {
+		t.Fatalf("expected the lock to be let go only outside of change sets: %v", unlocked)
+	}
+}
+
+func TestRetryBackoffStopsWithContext(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+	server.SetQueryHook(failFirst(10, "delete", proxysqltest.ErrDropConnection))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := conn.RemoveHostsLikeContext(ctx, Hostname("db-1")); !errors.Is(err, mysql.ErrInvalidConn) {
+		t.Fatalf("expected the connection error, got: %v", err)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Fatalf("backoff did not stop when the context was done, waited %v", waited)
+	}
+}
+
+func TestRetryInsertThatLanded(t *testing.T) {
+	conn, server, _ := retrySetup(t)
+	defer resetHelpers()
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(failFirst(1, "insert", proxysqltest.ErrDropResponse))
+	if err := conn.AddHost(Hostname("db-1"), Port(3307)); err != nil {
+		t.Fatalf("insert was not checked: %v", err)
+	}
+	queries := server.Queries()
+	if countQueries(queries, "insert") != 1 || countQueries(queries, "select count(*) from mysql_servers where hostgroup_id = 0 and hostname = 'db-1' and port = 3307 and status = 'ONLINE'") != 1 {
+		t.Fatalf("insert that landed was run again: %v", queries)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 1 {
+		t.Fatalf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestRetryInsertNextToSimilarHost(t *testing.T) {
+	conn, server, _ := retrySetup(t)
+	defer resetHelpers()
+	defer serverTeardown(conn, server)
+	conn.AddHost(Hostname("db-1"), Port(3307))
+	server.SetQueryHook(failFirst(1, "insert", proxysqltest.ErrDropConnection))
+	if err := conn.AddHost(Hostname("db-1")); err != nil {
+		t.Fatalf("insert was not retried: %v", err)
+	}
+	if n := countQueries(server.Queries(), "insert"); n != 3 {
+		t.Fatalf("expected the insert to be run again, inserts were run %d times", n)
+	}
+	if hosts, _ := conn.HostsLike(Hostname("db-1"), Port(3306)); len(hosts) != 1 {
+		t.Fatalf("host was not inserted: %v", hosts)
+	}
+}
+
+func TestRetryInsertThatDidNotLand(t *testing.T) {
+	conn, server, _ := retrySetup(t)
+	defer resetHelpers()
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(failFirst(1, "insert", proxysqltest.ErrDropConnection))
+	hosts := []*Host{DefaultHost().SetHostname("db-1"), DefaultHost().SetHostname("db-2")}
+	if err := conn.AddHosts(hosts...); err != nil {
+		t.Fatalf("insert was not retried: %v", err)
+	}
+	if n := countQueries(server.Queries(), "insert"); n != 2 {
+		t.Fatalf("expected the batch to be inserted twice, was inserted %d times", n)
+	}
+	if all, _ := conn.All(); !Hosts(all).Equal(hosts) {
+		t.Fatalf("unexpected hosts: %v", all)
+	}
+	// changes in a change set are retried too
+	server.SetQueryHook(failFirst(1, "insert", proxysqltest.ErrDropResponse))
+	if err := conn.NewChangeSet().AddHost(Hostname("db-3")).Apply(); err != nil {
+		t.Fatalf("change set insert was not checked: %v", err)
+	}
+	if all, _ := conn.All(); len(all) != 3 {
+		t.Fatalf("unexpected hosts: %v", all)
+	}
+}
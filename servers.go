@@ -0,0 +1,57 @@
+package proxysql
+
+// this file is for mapping hosts to rows of mysql_servers
+
+import (
+	"reflect"
+)
+
+// serverRow is a row of mysql_servers or runtime_mysql_servers, as a Table
+// reads and writes it
+type serverRow struct {
+	HostgroupID       int    `db:"hostgroup_id" json:"hostgroup_id"`
+	Hostname          string `db:"hostname" json:"hostname"`
+	Port              int    `db:"port" json:"port"`
+	Status            string `db:"status" json:"status"`
+	Weight            int    `db:"weight" json:"weight"`
+	Compression       int    `db:"compression" json:"compression"`
+	MaxConnections    int    `db:"max_connections" json:"max_connections"`
+	MaxReplicationLag int    `db:"max_replication_lag" json:"max_replication_lag"`
+	UseSSL            int    `db:"use_ssl" json:"use_ssl"`
+	MaxLatencyMS      int    `db:"max_latency_ms" json:"max_latency_ms"`
+	Comment           string `db:"comment" json:"comment"`
+}
+
+var serverColumns = mustTableColumns(reflect.TypeOf(serverRow{}))
+
+// the kind of each column of mysql_servers that queries can refer to
+var serverKinds = newTable[serverRow](nil, "mysql_servers", serverColumns).kinds
+
+// servers returns the TypedTable for mysql_servers or runtime_mysql_servers
+func servers(p *ProxySQL, table string) *TypedTable[serverRow] {
+	return newTable[serverRow](p, table, serverColumns)
+}
+
+func rowFromHost(h *Host) *serverRow {
+	return &serverRow{h.hostgroup_id, h.hostname, h.port, h.status, h.weight, h.compression, h.max_connections, h.max_replication_lag, h.use_ssl, h.max_latency_ms, h.comment}
+}
+
+func rowsFromHosts(hosts []*Host) []*serverRow {
+	rows := make([]*serverRow, len(hosts))
+	for i, host := range hosts {
+		rows[i] = rowFromHost(host)
+	}
+	return rows
+}
+
+func (r *serverRow) host() *Host {
+	return &Host{r.HostgroupID, r.Hostname, r.Port, r.Status, r.Weight, r.Compression, r.MaxConnections, r.MaxReplicationLag, r.UseSSL, r.MaxLatencyMS, r.Comment}
+}
+
+func hostsFromRows(rows []*serverRow) []*Host {
+	hosts := make([]*Host, len(rows))
+	for i, row := range rows {
+		hosts[i] = row.host()
+	}
+	return hosts
+}
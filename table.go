@@ -0,0 +1,587 @@
+package proxysql
+
+// this file is for typed access to any of ProxySQL's tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TypedTable is a typed view of one of ProxySQL's admin, stats or monitor
+// tables. T is a struct whose fields are mapped to columns with db tags:
+//
+//	type PoolStats struct {
+//	  Hostgroup int    `db:"hostgroup"`
+//	  Host      string `db:"srv_host"`
+//	  Port      int    `db:"srv_port"`
+//	  Status    string `db:"status"`
+//	}
+//	stats, err := NewTypedTable[PoolStats](conn, "stats_mysql_connection_pool")
+//
+// Fields without a db tag, or tagged "-", are ignored, as are columns of the
+// table that no field is mapped to. Mapped fields must be strings, integers,
+// floats or bools. NULL columns, and columns that the table does not have in
+// this version of ProxySQL, are read as zero values.
+//
+// The methods that select rows take HostOpts: Where, OrderBy, OrderByDesc
+// and Limit work on any column of the table, and the column options such
+// as Hostname select rows whose column of the same name equals the value.
+// Table can not be given, as a TypedTable has its own name
+type TypedTable[T any] struct {
+	p       *ProxySQL
+	name    string
+	columns []tableColumn
+	kinds   map[string]columnKind
+}
+
+type tableColumn struct {
+	name  string
+	index []int
+	kind  columnKind
+}
+
+type columnKind int
+
+const (
+	kindInt columnKind = iota
+	kindFloat
+	kindString
+)
+
+// RowError is returned by TypedTable.Insert when a row could not be inserted.
+// Index is the row's position in the arguments
+type RowError struct {
+	Index int
+	Err   error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the error from inserting the row
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// table names may be qualified with a schema, as in disk.mysql_servers
+var tableNamePattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*\.)?[A-Za-z_][A-Za-z0-9_]*$`)
+
+// columns of each struct type, which never change
+var tableColumnsCache sync.Map
+
+// NewTypedTable returns a TypedTable for the table called name, whose rows
+// are read into and written from values of T.
+// This will return ErrTableNoClient if p is nil, ErrTableBadName if the name
+// is not a table name, and ErrTableBadType if T can not be mapped to columns
+func NewTypedTable[T any](p *ProxySQL, name string) (*TypedTable[T], error) {
+	if p == nil {
+		return nil, ErrTableNoClient
+	}
+	if !tableNamePattern.MatchString(name) {
+		return nil, ErrTableBadName
+	}
+	columns, err := tableColumns(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return newTable[T](p, name, columns), nil
+}
+
+func newTable[T any](p *ProxySQL, name string, columns []tableColumn) *TypedTable[T] {
+	kinds := make(map[string]columnKind, len(columns))
+	for _, column := range columns {
+		kinds[column.name] = column.kind
+	}
+	return &TypedTable[T]{p: p, name: name, columns: columns, kinds: kinds}
+}
+
+// mustTableColumns is tableColumns for the row types of this package, whose
+// tags are known to be valid. It panics if they are not
+func mustTableColumns(t reflect.Type) []tableColumn {
+	columns, err := tableColumns(t)
+	if err != nil {
+		panic(fmt.Sprintf("proxysql: columns of %s: %v", t, err))
+	}
+	return columns
+}
+
+func tableColumns(t reflect.Type) ([]tableColumn, error) {
+	if cached, ok := tableColumnsCache.Load(t); ok {
+		return cached.([]tableColumn), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, ErrTableBadType
+	}
+	var columns []tableColumn
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("db")
+		if name == "" || name == "-" {
+			continue
+		}
+		if field.PkgPath != "" || seen[name] || !tableNamePattern.MatchString(name) || strings.Contains(name, ".") {
+			return nil, ErrTableBadType
+		}
+		var kind columnKind
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Bool:
+			kind = kindInt
+		case reflect.Float32, reflect.Float64:
+			kind = kindFloat
+		case reflect.String:
+			kind = kindString
+		default:
+			return nil, ErrTableBadType
+		}
+		seen[name] = true
+		columns = append(columns, tableColumn{name, field.Index, kind})
+	}
+	if len(columns) == 0 {
+		return nil, ErrTableBadType
+	}
+	tableColumnsCache.Store(t, columns)
+	return columns, nil
+}
+
+// Name returns the name of the table
+func (t *TypedTable[T]) Name() string {
+	return t.name
+}
+
+// Columns returns the columns that T's fields are mapped to, in the order of
+// the fields
+func (t *TypedTable[T]) Columns() []string {
+	names := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// Insert inserts each of the rows, several rows per statement as set by
+// ProxySQL.SetInsertBatchSize. If a statement fails, each row in it is
+// inserted on its own, so that the rows before the one that failed are still
+// inserted. Errors are returned as a *RowError.
+// This will return a *TableAccessError if the table is read only
+// This will propagate error from sql.Exec in RowError.Err
+func (t *TypedTable[T]) Insert(rows ...*T) error {
+	return t.InsertContext(context.Background(), rows...)
+}
+
+// InsertContext is Insert with a context, which its statements are run
+// with, and which holds the span that its span is a child of
+func (t *TypedTable[T]) InsertContext(ctx context.Context, rows ...*T) (err error) {
+	op := t.p.begin(ctx, "TypedTable.Insert")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, t.name}, Attribute{AttributeRows, int64(len(rows))})
+	op.param("table", t.name)
+	op.param("rows", len(rows))
+	if err := CheckWritable(t.name, "insert"); err != nil {
+		return err
+	}
+	defer op.lock()()
+	if i, err := t.insert(op.ctx, rows); err != nil {
+		return &RowError{Index: i, Err: err}
+	}
+	return nil
+}
+
+// Select returns the rows that match the options given, ordered and limited
+// as they specify.
+// This will error if the options do not pass validation
+// This will also propagate error from sql.Query, sql.Rows.Scan, sql.Rows.Err
+func (t *TypedTable[T]) Select(opts ...HostOpts) ([]*T, error) {
+	return t.SelectContext(context.Background(), opts...)
+}
+
+// SelectContext is Select with a context
+func (t *TypedTable[T]) SelectContext(ctx context.Context, opts ...HostOpts) (rows []*T, err error) {
+	op := t.p.begin(ctx, "TypedTable.Select")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, t.name})
+	q, err := t.parse(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer op.rlock()()
+	rows, err = t.selectRows(op.ctx, t.selectQuery(q))
+	op.annotate(Attribute{AttributeRows, int64(len(rows))})
+	return rows, err
+}
+
+// Count returns the number of rows that Select would return
+// This will error if the options do not pass validation
+// This will also propagate error from sql.Query, sql.Rows.Scan, sql.Rows.Err
+func (t *TypedTable[T]) Count(opts ...HostOpts) (int, error) {
+	return t.CountContext(context.Background(), opts...)
+}
+
+// CountContext is Count with a context
+func (t *TypedTable[T]) CountContext(ctx context.Context, opts ...HostOpts) (count int, err error) {
+	op := t.p.begin(ctx, "TypedTable.Count")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, t.name})
+	q, err := t.parse(opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer op.rlock()()
+	if err := scanOne(op.ctx, t.p, t.name, fmt.Sprintf("select count(*) from %s%s", t.name, q.whereClause()), &count); err != nil {
+		return 0, err
+	}
+	if q.hasLimit && count > q.limit {
+		count = q.limit
+	}
+	return count, nil
+}
+
+// Delete removes the rows that Select would return, and returns how many
+// were removed
+// This will error if the options do not pass validation, and return a
+// *TableAccessError if the table is read only
+// This will propagate error from sql.Exec, and from sql.Query,
+// sql.Rows.Scan, sql.Rows.Err when Limit is given
+func (t *TypedTable[T]) Delete(opts ...HostOpts) (int64, error) {
+	return t.DeleteContext(context.Background(), opts...)
+}
+
+// DeleteContext is Delete with a context
+func (t *TypedTable[T]) DeleteContext(ctx context.Context, opts ...HostOpts) (n int64, err error) {
+	op := t.p.begin(ctx, "TypedTable.Delete")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, t.name})
+	q, err := t.parse(opts...)
+	if err != nil {
+		return 0, err
+	}
+	op.param("table", t.name)
+	op.param("where", filterOf(q))
+	if err := CheckWritable(t.name, "delete"); err != nil {
+		return 0, err
+	}
+	defer op.lock()()
+	n, err = t.delete(op.ctx, q)
+	op.annotate(Attribute{AttributeRows, n})
+	return n, err
+}
+
+// Update sets every mapped column of the rows that Select would return to the
+// values in row, and returns how many rows were changed
+// This will error if the options do not pass validation, and return a
+// *TableAccessError if the table is read only
+// This will propagate error from sql.Exec, and from sql.Query,
+// sql.Rows.Scan, sql.Rows.Err when Limit is given
+func (t *TypedTable[T]) Update(row *T, opts ...HostOpts) (int64, error) {
+	return t.UpdateContext(context.Background(), row, opts...)
+}
+
+// UpdateContext is Update with a context
+func (t *TypedTable[T]) UpdateContext(ctx context.Context, row *T, opts ...HostOpts) (n int64, err error) {
+	op := t.p.begin(ctx, "TypedTable.Update")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, t.name})
+	q, err := t.parse(opts...)
+	if err != nil {
+		return 0, err
+	}
+	op.param("table", t.name)
+	op.param("where", filterOf(q))
+	op.param("columns", t.Columns())
+	if err := CheckWritable(t.name, "update"); err != nil {
+		return 0, err
+	}
+	defer op.lock()()
+	where, err := t.limitedWhere(op.ctx, q)
+	if err != nil || where == "" && q.hasLimit {
+		return 0, err
+	}
+	n, err = t.exec(op.ctx, fmt.Sprintf("update %s set %s%s", t.name, t.assignments(row), where))
+	op.annotate(Attribute{AttributeRows, n})
+	return n, err
+}
+
+// parse applies and validates options against the columns of the table
+func (t *TypedTable[T]) parse(setters ...HostOpts) (*tableQuery, error) {
+	opts := defaultHostQuery()
+	for _, setter := range setters {
+		setter(opts)
+	}
+	if opts.table != "mysql_servers" {
+		return nil, ErrTableNamed
+	}
+	q := opts.tableQuery()
+	invalid := &ValidationError{}
+	invalid.add(validateSpecifiedFields(opts))
+	invalid.add(q.validate(t.kinds))
+	if err := invalid.err(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// insert inserts rows in batches, and returns the index of the row that
+// failed along with the error
+func (t *TypedTable[T]) insert(ctx context.Context, rows []*T) (int, error) {
+	batchSize := t.p.insertBatchSize()
+	if batchSize < 1 {
+		batchSize = DefaultInsertBatchSize
+	}
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		err := t.insertBatch(ctx, rows[start:end])
+		if err == nil {
+			continue
+		}
+		if end-start == 1 {
+			return start, err
+		}
+		// find the row that failed the statement
+		for i := start; i < end; i++ {
+			if err := t.insertBatch(ctx, rows[i:i+1]); err != nil {
+				return i, err
+			}
+		}
+		// every row was inserted on its own
+	}
+	return -1, nil
+}
+
+// insertBatch inserts rows in one statement, which is retried if the rows
+// were not inserted
+func (t *TypedTable[T]) insertBatch(ctx context.Context, rows []*T) error {
+	statement := t.insertQuery(rows)
+	landed := rowsLanded(ctx, t.p, t.name, " where "+t.rowsWhere(rows), len(rows))
+	_, err := execRetrying(ctx, t.p, statement, landed)
+	return opError(t.name, statement, err)
+}
+
+func (t *TypedTable[T]) delete(ctx context.Context, q *tableQuery) (int64, error) {
+	where, err := t.limitedWhere(ctx, q)
+	if err != nil || where == "" && q.hasLimit {
+		return 0, err
+	}
+	return t.exec(ctx, fmt.Sprintf("delete from %s%s", t.name, where))
+}
+
+// limitedWhere returns the where clause of a query. ProxySQL does not
+// support order by or limit in deletes or updates, so when a query is
+// limited this selects the rows first and returns a clause matching exactly
+// those rows, or an empty string if there are none
+func (t *TypedTable[T]) limitedWhere(ctx context.Context, q *tableQuery) (string, error) {
+	if !q.hasLimit {
+		return q.whereClause(), nil
+	}
+	rows, err := t.selectRows(ctx, t.selectQuery(q))
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	return " where " + t.rowsWhere(rows), nil
+}
+
+// columns are selected with *, and read by name, as the columns of a table
+// differ between versions of ProxySQL
+func (t *TypedTable[T]) selectQuery(q *tableQuery) string {
+	return fmt.Sprintf("select * from %s%s%s", t.name, q.whereClause(), q.orderAndLimit())
+}
+
+// builds a string like
+// insert into table (a, b) values (1, 'c'), (2, 'd')
+func (t *TypedTable[T]) insertQuery(rows []*T) string {
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = t.values(row)
+	}
+	return fmt.Sprintf("insert into %s %s values %s", t.name, t.columnList(), strings.Join(values, ", "))
+}
+
+// builds a string like (a, b)
+func (t *TypedTable[T]) columnList() string {
+	return fmt.Sprintf("(%s)", strings.Join(t.Columns(), ", "))
+}
+
+// builds a string like (1, 'c')
+func (t *TypedTable[T]) values(row *T) string {
+	v := reflect.ValueOf(row).Elem()
+	parts := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		parts[i] = fieldLiteral(v.FieldByIndex(column.index))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(parts, ", "))
+}
+
+// builds a string like a = 1, b = 'c'
+func (t *TypedTable[T]) assignments(row *T) string {
+	return strings.Join(t.equalities(row), ", ")
+}
+
+// builds a string like a = 1 and b = 'c', which matches the row exactly
+func (t *TypedTable[T]) rowWhere(row *T) string {
+	return strings.Join(t.equalities(row), " and ")
+}
+
+// builds a string like (a = 1 and b = 'c') or (a = 2 and b = 'd')
+func (t *TypedTable[T]) rowsWhere(rows []*T) string {
+	parts := make([]string, len(rows))
+	for i, row := range rows {
+		parts[i] = fmt.Sprintf("(%s)", t.rowWhere(row))
+	}
+	return strings.Join(parts, " or ")
+}
+
+func (t *TypedTable[T]) equalities(row *T) []string {
+	v := reflect.ValueOf(row).Elem()
+	parts := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		parts[i] = fmt.Sprintf("%s = %s", column.name, fieldLiteral(v.FieldByIndex(column.index)))
+	}
+	return parts
+}
+
+// selectRows runs a query and reads each row into a T, matching the columns
+// it returns to mapped fields by name, ignoring case. Columns that no field
+// is mapped to are discarded, and fields whose column is missing are left as
+// zero values
+func (t *TypedTable[T]) selectRows(ctx context.Context, selectQuery string) ([]*T, error) {
+	rows, err := queryRetrying(ctx, t.p, selectQuery)
+	if err != nil {
+		return nil, opError(t.name, selectQuery, err)
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, opError(t.name, selectQuery, err)
+	}
+	mapped := make([]*tableColumn, len(names))
+	for i, name := range names {
+		for j := range t.columns {
+			if strings.EqualFold(name, t.columns[j].name) {
+				mapped[i] = &t.columns[j]
+				break
+			}
+		}
+	}
+	entries := make([]*T, 0)
+	for rows.Next() {
+		values := make([]sql.NullString, len(names))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := scanRows(rows, dest...); err != nil {
+			return nil, opError(t.name, selectQuery, err)
+		}
+		entry := new(T)
+		v := reflect.ValueOf(entry).Elem()
+		for i, column := range mapped {
+			if column == nil {
+				continue
+			}
+			if err := setField(v.FieldByIndex(column.index), values[i]); err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", t.name, column.name, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if rowsErr(rows) != nil && rowsErr(rows) != sql.ErrNoRows {
+		return nil, opError(t.name, selectQuery, rowsErr(rows))
+	}
+	return entries, nil
+}
+
+// exec runs a statement on the table, and returns how many rows it changed.
+// Statements are retried by the client's RetryPolicy, and a statement that
+// is retried after it was applied reports the rows the retry changed
+func (t *TypedTable[T]) exec(ctx context.Context, statement string) (int64, error) {
+	n, err := affected(execRetrying(ctx, t.p, statement, nil))
+	return n, opError(t.name, statement, err)
+}
+
+// scanOne runs a query on a table that returns a single row
+func scanOne(ctx context.Context, p *ProxySQL, table, selectQuery string, dest ...interface{}) error {
+	rows, err := queryRetrying(ctx, p, selectQuery)
+	if err != nil {
+		return opError(table, selectQuery, err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if rowsErr(rows) != nil {
+			return opError(table, selectQuery, rowsErr(rows))
+		}
+		return opError(table, selectQuery, sql.ErrNoRows)
+	}
+	return opError(table, selectQuery, scanRows(rows, dest...))
+}
+
+func affected(result sql.Result, err error) (int64, error) {
+	if err != nil || result == nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// fieldLiteral returns the value of a mapped field as an SQL literal
+func fieldLiteral(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Bool:
+		if v.Bool() {
+			return "1"
+		}
+		return "0"
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+	return quote(v.String())
+}
+
+// setField sets a mapped field from a column that ProxySQL returned
+func setField(v reflect.Value, s sql.NullString) error {
+	if !s.Valid {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s.String, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s.String, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Bool:
+		n, err := strconv.ParseInt(s.String, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetBool(n != 0)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s.String, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		v.SetString(s.String)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package proxysql
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testUser struct {
+	Username         string `db:"username"`
+	Password         string `db:"password"`
+	Active           bool   `db:"active"`
+	DefaultHostgroup int    `db:"default_hostgroup"`
+	MaxConnections   uint32 `db:"max_connections"`
+	Ignored          string
+}
+
+type testPoolStats struct {
+	Hostgroup int    `db:"hostgroup"`
+	Host      string `db:"srv_host"`
+	Port      int    `db:"srv_port"`
+	Status    string `db:"status"`
+	Queries   int64  `db:"Queries"`
+}
+
+type testPingLog struct {
+	Hostname  string  `db:"hostname"`
+	Port      int     `db:"port"`
+	Success   float64 `db:"ping_success_time_us"`
+	PingError string  `db:"ping_error"`
+}
+
+func usersSetup(t *testing.T) (*ProxySQL, *TypedTable[testUser], func()) {
+	conn, server := serverSetup(t)
+	users, err := NewTypedTable[testUser](conn, "mysql_users")
+	if err != nil {
+		t.Fatalf("could not create table: %v", err)
+	}
+	return conn, users, func() { serverTeardown(conn, server) }
+}
+
+func TestNewTypedTableValidatesNameAndType(t *testing.T) {
+	conn := shortSetup(t)
+	for _, name := range []string{"", "mysql_servers; drop", "a.b.c", "1table"} {
+		if _, err := NewTypedTable[testUser](conn, name); err != ErrTableBadName {
+			t.Errorf("name %q was not rejected: %v", name, err)
+		}
+	}
+	if _, err := NewTypedTable[testUser](nil, "mysql_users"); err != ErrTableNoClient {
+		t.Errorf("nil client was not rejected: %v", err)
+	}
+	if _, err := NewTypedTable[testUser](conn, "disk.mysql_users"); err != nil {
+		t.Errorf("qualified name was rejected: %v", err)
+	}
+	type untagged struct{ Name string }
+	type unsupported struct {
+		Tags []string `db:"tags"`
+	}
+	type unexported struct {
+		name string `db:"name"`
+	}
+	type duplicate struct {
+		A string `db:"a"`
+		B string `db:"a"`
+	}
+	if _, err := NewTypedTable[untagged](conn, "t"); err != ErrTableBadType {
+		t.Errorf("struct without tags was not rejected: %v", err)
+	}
+	if _, err := NewTypedTable[unsupported](conn, "t"); err != ErrTableBadType {
+		t.Errorf("unsupported field was not rejected: %v", err)
+	}
+	if _, err := NewTypedTable[unexported](conn, "t"); err != ErrTableBadType {
+		t.Errorf("unexported field was not rejected: %v", err)
+	}
+	if _, err := NewTypedTable[duplicate](conn, "t"); err != ErrTableBadType {
+		t.Errorf("duplicate column was not rejected: %v", err)
+	}
+	if _, err := NewTypedTable[int](conn, "t"); err != ErrTableBadType {
+		t.Errorf("non struct type was not rejected: %v", err)
+	}
+	users, _ := NewTypedTable[testUser](conn, "mysql_users")
+	if users.Name() != "mysql_users" || !reflect.DeepEqual(users.Columns(), []string{"username", "password", "active", "default_hostgroup", "max_connections"}) {
+		t.Errorf("unexpected name or columns: %s %v", users.Name(), users.Columns())
+	}
+}
+
+func TestMustTableColumnsPanicsOnBadType(t *testing.T) {
+	if columns := mustTableColumns(reflect.TypeOf(serverRow{})); len(columns) != 11 {
+		t.Errorf("unexpected columns of mysql_servers: %v", columns)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("bad type did not panic")
+		}
+	}()
+	mustTableColumns(reflect.TypeOf(0))
+}
+
+func TestTypedTableInsertAndSelect(t *testing.T) {
+	_, users, teardown := usersSetup(t)
+	defer teardown()
+	rows := []*testUser{
+		{Username: "app", Password: "it's secret", Active: true, DefaultHostgroup: 1, MaxConnections: 100},
+		{Username: "batch", Password: "pw", DefaultHostgroup: 2, MaxConnections: 5},
+		{Username: "report", Password: "pw", Active: true, DefaultHostgroup: 2, MaxConnections: 50},
+	}
+	if err := users.Insert(rows...); err != nil {
+		t.Fatalf("could not insert rows: %v", err)
+	}
+	all, err := users.Select()
+	if err != nil {
+		t.Fatalf("could not select rows: %v", err)
+	}
+	if !reflect.DeepEqual(all, rows) {
+		t.Fatalf("selected rows were not inserted rows: %v", all)
+	}
+	active, err := users.Select(Where(Eq("active", 1), Gt("max_connections", 10)), OrderByDesc("username"))
+	if err != nil {
+		t.Fatalf("could not select rows: %v", err)
+	}
+	if len(active) != 2 || active[0].Username != "report" || active[1].Username != "app" {
+		t.Fatalf("unexpected rows: %v", active)
+	}
+	// the column options select columns of the same name
+	limited, err := users.Select(MaxConnections(5))
+	if err != nil || len(limited) != 1 || limited[0].Username != "batch" {
+		t.Fatalf("unexpected rows from column option: %v, %v", limited, err)
+	}
+}
+
+func TestTypedTableInsertReportsFailingRow(t *testing.T) {
+	_, users, teardown := usersSetup(t)
+	defer teardown()
+	err := users.Insert(&testUser{Username: "a"}, &testUser{Username: "b"}, &testUser{Username: "a"})
+	rerr, ok := err.(*RowError)
+	if !ok || rerr.Index != 2 || !strings.Contains(rerr.Error(), "UNIQUE constraint failed") {
+		t.Fatalf("expected a RowError for the third row, got: %v", err)
+	}
+	if count, _ := users.Count(); count != 2 {
+		t.Fatalf("rows before the failure were not kept: %d", count)
+	}
+}
+
+func TestTypedTableCountUpdateDelete(t *testing.T) {
+	_, users, teardown := usersSetup(t)
+	defer teardown()
+	users.Insert(&testUser{Username: "a", DefaultHostgroup: 1}, &testUser{Username: "b", DefaultHostgroup: 1}, &testUser{Username: "c", DefaultHostgroup: 2})
+	count, err := users.Count(Where(Eq("default_hostgroup", 1)))
+	if err != nil || count != 2 {
+		t.Fatalf("unexpected count: %d, %v", count, err)
+	}
+	if count, _ := users.Count(Limit(1)); count != 1 {
+		t.Fatalf("count was not limited: %d", count)
+	}
+	updated, err := users.Update(&testUser{Username: "b2", DefaultHostgroup: 3}, Where(Eq("username", "b")))
+	if err != nil || updated != 1 {
+		t.Fatalf("unexpected update: %d, %v", updated, err)
+	}
+	deleted, err := users.Delete(Where(Eq("default_hostgroup", 1)), OrderBy("username"), Limit(5))
+	if err != nil || deleted != 1 {
+		t.Fatalf("unexpected delete: %d, %v", deleted, err)
+	}
+	deleted, err = users.Delete(OrderByDesc("username"), Limit(1))
+	if err != nil || deleted != 1 {
+		t.Fatalf("unexpected delete: %d, %v", deleted, err)
+	}
+	rest, err := users.Select()
+	if err != nil || len(rest) != 1 || rest[0].Username != "b2" || rest[0].DefaultHostgroup != 3 {
+		t.Fatalf("unexpected rows left: %v, %v", rest, err)
+	}
+	if deleted, err := users.Delete(Where(Eq("username", "none")), Limit(1)); err != nil || deleted != 0 {
+		t.Fatalf("unexpected delete of nothing: %d, %v", deleted, err)
+	}
+}
+
+func TestTypedTableValidatesOptions(t *testing.T) {
+	_, users, teardown := usersSetup(t)
+	defer teardown()
+	if _, err := users.Select(Table("runtime_mysql_servers")); err != ErrTableNamed {
+		t.Errorf("table option was not rejected: %v", err)
+	}
+	if _, err := users.Select(Where(Eq("hostname", "a"))); !errors.Is(err, ErrConfigBadColumn) {
+		t.Errorf("column of another table was not rejected: %v", err)
+	}
+	if _, err := users.Count(Where(Eq("username", 1))); !errors.Is(err, ErrConfigBadPredicate) {
+		t.Errorf("value of the wrong type was not rejected: %v", err)
+	}
+	if _, err := users.Delete(Comment("c")); !errors.Is(err, ErrConfigBadColumn) {
+		t.Errorf("column option of another table was not rejected: %v", err)
+	}
+	if _, err := users.Update(&testUser{}, Limit(-1)); !errors.Is(err, ErrConfigBadLimit) {
+		t.Errorf("bad limit was not rejected: %v", err)
+	}
+}
+
+func TestTypedTableReadsStatsAndMonitorTables(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	conn.AddHost(Hostname("db-1"), HostgroupID(1))
+	conn.AddHost(Hostname("db-2"), HostgroupID(2), Port(3307))
+	conn.PersistChanges()
+	pool, err := NewTypedTable[testPoolStats](conn, "stats_mysql_connection_pool")
+	if err != nil {
+		t.Fatalf("could not create table: %v", err)
+	}
+	stats, err := pool.Select(Where(Ge("hostgroup", 2)))
+	if err != nil {
+		t.Fatalf("could not select stats: %v", err)
+	}
+	if !reflect.DeepEqual(stats, []*testPoolStats{{2, "db-2", 3307, "ONLINE", 0}}) {
+		t.Fatalf("unexpected stats: %v", stats[0])
+	}
+	pings, err := NewTypedTable[testPingLog](conn, "monitor.mysql_server_ping_log")
+	if err != nil {
+		t.Fatalf("could not create table: %v", err)
+	}
+	log, err := pings.Select(Hostname("db-1"))
+	if err != nil {
+		t.Fatalf("could not select ping log: %v", err)
+	}
+	// ping_error is NULL, and read as an empty string
+	if len(log) != 1 || log[0].Port != 3306 || log[0].Success != 100 || log[0].PingError != "" {
+		t.Fatalf("unexpected ping log: %v", log)
+	}
+}
+
+func TestHostHelpersEscapeStrings(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	host := DefaultHost().SetHostname("db-1").SetComment("it's the primary")
+	if err := conn.AddHosts(host); err != nil {
+		t.Fatalf("could not add host: %v", err)
+	}
+	hosts, err := conn.HostsLike(Comment("it's the primary"))
+	if err != nil || len(hosts) != 1 || !reflect.DeepEqual(hosts[0], host) {
+		t.Fatalf("could not find host with quoted comment: %v, %v", hosts, err)
+	}
+	if err := conn.RemoveHost(host); err != nil {
+		t.Fatalf("could not remove host: %v", err)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 0 {
+		t.Fatalf("host was not removed: %v", hosts)
+	}
+}
@@ -0,0 +1,193 @@
+package proxysql
+
+// this file is for tracing the calls of a client's methods, and the
+// statements they send
+
+import (
+	"context"
+	"strings"
+)
+
+// The keys of the attributes that spans are given
+const (
+	// AttributeTable is the table a method or statement works on
+	AttributeTable = "proxysql.table"
+	// AttributeOperation is the verb of a statement, like insert or select
+	AttributeOperation = "proxysql.operation"
+	// AttributeHostgroup is the hostgroup that a method was given
+	AttributeHostgroup = "proxysql.hostgroup"
+	// AttributeRows is the number of rows a method or statement returned or
+	// changed
+	AttributeRows = "proxysql.rows"
+	// AttributeStatement is a statement, with secrets redacted
+	AttributeStatement = "db.statement"
+)
+
+// Attribute is a key and value that describes a span. Values are strings or
+// int64s
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans. A client starts a span named like proxysql.AddHost for
+// each call of its methods, and a child span named like
+// "insert mysql_servers" for each statement the method sends. Spans are
+// children of the span in the context given to the Context methods, such as
+// AddHostContext. Implementations must be safe to call concurrently
+type Tracer interface {
+	// Start starts a span that is a child of the span in ctx, and returns a
+	// context that holds it
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation that a Tracer started
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// End ends the span, with the error of the operation or nil
+	End(err error)
+}
+
+// NoopTracer starts spans that do nothing. Clients use it unless SetTracer
+// is called
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) End(error)                  {}
+
+// SetTracer traces every call of the client's methods, and every statement,
+// with t. Passing nil restores the NoopTracer.
+func (p *ProxySQL) SetTracer(t Tracer) {
+	p.settingsMut.Lock()
+	defer p.settingsMut.Unlock()
+	p.trace = t
+}
+
+func (p *ProxySQL) tracer() Tracer {
+	p.settingsMut.RLock()
+	defer p.settingsMut.RUnlock()
+	if p.trace == nil {
+		return NoopTracer{}
+	}
+	return p.trace
+}
+
+// OTelSpan is the part of an OpenTelemetry span that NewOTelTracer uses, as
+// functions, so that this package does not depend on OpenTelemetry
+type OTelSpan struct {
+	// SetAttribute sets an attribute, like span.SetAttributes does with
+	// attribute.String or attribute.Int64
+	SetAttribute func(key string, value interface{})
+	// RecordError records an error, and marks the span as failed, like
+	// span.RecordError and span.SetStatus(codes.Error, ...) do
+	RecordError func(err error)
+	// End ends the span, like span.End
+	End func()
+}
+
+// NewOTelTracer returns a Tracer that starts spans with an OpenTelemetry
+// style tracer. start starts a span as tracer.Start does, and returns its
+// context and functions that call the span:
+//
+//	tracer := otel.Tracer("proxysql")
+//	conn.SetTracer(proxysql.NewOTelTracer(func(ctx context.Context, name string) (context.Context, proxysql.OTelSpan) {
+//	  ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//	  return ctx, proxysql.OTelSpan{
+//	    SetAttribute: func(key string, value interface{}) { ... },
+//	    RecordError:  func(err error) { span.RecordError(err); span.SetStatus(codes.Error, err.Error()) },
+//	    End:          func() { span.End() },
+//	  }
+//	}))
+func NewOTelTracer(start func(ctx context.Context, name string) (context.Context, OTelSpan)) Tracer {
+	return otelTracer(start)
+}
+
+type otelTracer func(ctx context.Context, name string) (context.Context, OTelSpan)
+
+func (t otelTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	ctx, span := t(ctx, name)
+	s := otelSpan{span}
+	s.SetAttributes(attrs...)
+	return ctx, s
+}
+
+type otelSpan struct {
+	span OTelSpan
+}
+
+func (s otelSpan) SetAttributes(attrs ...Attribute) {
+	if s.span.SetAttribute == nil {
+		return
+	}
+	for _, attr := range attrs {
+		s.span.SetAttribute(attr.Key, attr.Value)
+	}
+}
+
+func (s otelSpan) End(err error) {
+	if err != nil && s.span.RecordError != nil {
+		s.span.RecordError(err)
+	}
+	if s.span.End != nil {
+		s.span.End()
+	}
+}
+
+// startStatement starts the span of a statement, named like
+// "select mysql_servers" after its verb and table
+func startStatement(ctx context.Context, p *ProxySQL, statement string) (context.Context, Span) {
+	verb, table := statementTarget(statement)
+	attrs := []Attribute{{AttributeStatement, redact(statement)}, {AttributeOperation, verb}}
+	name := verb
+	if table != "" {
+		attrs = append(attrs, Attribute{AttributeTable, table})
+		name += " " + table
+	}
+	return p.tracer().Start(ctx, name, attrs...)
+}
+
+// statementTarget returns the lower case verb of a statement, and the table
+// it reads or changes, or an empty string for statements without one, like
+// save mysql servers to disk
+func statementTarget(statement string) (string, string) {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	verb := strings.ToLower(fields[0])
+	after := ""
+	switch verb {
+	case "insert", "replace":
+		after = "into"
+	case "delete", "select":
+		after = "from"
+	case "update":
+		if len(fields) > 1 {
+			return verb, fields[1]
+		}
+	}
+	for i := 1; after != "" && i < len(fields)-1; i++ {
+		if strings.EqualFold(fields[i], after) {
+			return verb, strings.TrimSuffix(fields[i+1], ";")
+		}
+	}
+	return verb, ""
+}
+
+// hostAttributes returns the table of a host query, and its hostgroup if it
+// was specified
+func hostAttributes(hostq *hostQuery) []Attribute {
+	attrs := []Attribute{{AttributeTable, hostq.table}}
+	for _, field := range hostq.specifiedFields {
+		if field == "hostgroup_id" {
+			attrs = append(attrs, Attribute{AttributeHostgroup, int64(hostq.host.HostgroupID())})
+		}
+	}
+	return attrs
+}
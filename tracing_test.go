@@ -0,0 +1,166 @@
+package proxysql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// testTracer records every span it starts
+type testTracer struct {
+	mut   sync.Mutex
+	spans []*testSpan
+}
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	ended  bool
+	err    error
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attrs: make(map[string]interface{})}
+	span.SetAttributes(attrs...)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) End(err error) {
+	s.ended, s.err = true, err
+}
+
+func (t *testTracer) named(name string) []*testSpan {
+	var spans []*testSpan
+	for _, span := range t.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestTracerSpans(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	tracer := &testTracer{}
+	conn.SetTracer(tracer)
+	ctx, root := tracer.Start(context.Background(), "request")
+	if err := conn.AddHostContext(ctx, Hostname("db-1"), HostgroupID(2)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	hosts, err := conn.HostsLikeContext(ctx, HostgroupID(2))
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("unexpected hosts: %v, %v", hosts, err)
+	}
+	addHost := tracer.named("proxysql.AddHost")
+	if len(addHost) != 1 || addHost[0].parent != root || !addHost[0].ended || addHost[0].err != nil {
+		t.Fatalf("AddHost was not traced under the span in its context: %+v", addHost)
+	}
+	if addHost[0].attrs[AttributeTable] != "mysql_servers" || addHost[0].attrs[AttributeHostgroup] != int64(2) {
+		t.Fatalf("unexpected AddHost attributes: %v", addHost[0].attrs)
+	}
+	insert := tracer.named("insert mysql_servers")
+	if len(insert) != 1 || insert[0].parent != addHost[0] || !insert[0].ended {
+		t.Fatalf("insert was not traced under AddHost: %+v", insert)
+	}
+	if insert[0].attrs[AttributeOperation] != "insert" || insert[0].attrs[AttributeRows] != int64(1) || insert[0].attrs[AttributeStatement] == nil {
+		t.Fatalf("unexpected insert attributes: %v", insert[0].attrs)
+	}
+	hostsLike := tracer.named("proxysql.HostsLike")
+	if len(hostsLike) != 1 || hostsLike[0].attrs[AttributeRows] != int64(1) {
+		t.Fatalf("HostsLike did not report its rows: %+v", hostsLike)
+	}
+	if selects := tracer.named("select mysql_servers"); len(selects) != 1 || selects[0].parent != hostsLike[0] {
+		t.Fatalf("select was not traced under HostsLike: %+v", selects)
+	}
+	conn.AddHost(Hostname("db-2"), Port(-1))
+	failed := tracer.named("proxysql.AddHost")[1]
+	if !errors.Is(failed.err, ErrConfigBadPort) || failed.parent != nil {
+		t.Fatalf("failed AddHost did not record its error: %+v", failed)
+	}
+}
+
+func TestTracerRecordsStatementErrors(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	tracer := &testTracer{}
+	conn.SetTracer(tracer)
+	users, _ := NewTypedTable[testUser](conn, "mysql_users")
+	users.Insert(&testUser{Username: "app"}, &testUser{Username: "app"})
+	inserts := tracer.named("insert mysql_users")
+	if len(inserts) == 0 || inserts[0].err == nil || inserts[0].parent.name != "proxysql.TypedTable.Insert" {
+		t.Fatalf("failed insert was not traced: %+v", inserts)
+	}
+	conn.SetTracer(nil)
+	if _, ok := conn.tracer().(NoopTracer); !ok {
+		t.Fatalf("nil did not restore the no-op tracer: %T", conn.tracer())
+	}
+}
+
+func TestContextCancelsStatements(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := conn.AddHostContext(ctx, Hostname("db-1")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled context did not stop the insert: %v", err)
+	}
+	if hosts, _ := conn.All(); len(hosts) != 0 {
+		t.Fatalf("host was inserted: %v", hosts)
+	}
+}
+
+func TestOTelTracer(t *testing.T) {
+	var attrs []string
+	var recorded error
+	ended := false
+	tracer := NewOTelTracer(func(ctx context.Context, name string) (context.Context, OTelSpan) {
+		return context.WithValue(ctx, testSpanKey{}, name), OTelSpan{
+			SetAttribute: func(key string, value interface{}) { attrs = append(attrs, key) },
+			RecordError:  func(err error) { recorded = err },
+			End:          func() { ended = true },
+		}
+	})
+	ctx, span := tracer.Start(context.Background(), "proxysql.Clear", Attribute{AttributeTable, "mysql_servers"})
+	span.SetAttributes(Attribute{AttributeRows, int64(3)})
+	span.End(ErrTableReadOnly)
+	if ctx.Value(testSpanKey{}) != "proxysql.Clear" || len(attrs) != 2 || recorded != ErrTableReadOnly || !ended {
+		t.Fatalf("span was not adapted: %v, %v, %v", attrs, recorded, ended)
+	}
+	// functions that are not given are skipped
+	_, span = NewOTelTracer(func(ctx context.Context, _ string) (context.Context, OTelSpan) {
+		return ctx, OTelSpan{}
+	}).Start(context.Background(), "proxysql.Ping", Attribute{AttributeTable, ""})
+	span.End(errors.New("mock"))
+}
+
+func TestStatementTarget(t *testing.T) {
+	statements := map[string][2]string{
+		"insert into mysql_servers (hostname) values ('a')":         {"insert", "mysql_servers"},
+		"SELECT count(*) FROM disk.mysql_servers where port = 3306": {"select", "disk.mysql_servers"},
+		"delete from mysql_users where username = 'app'":            {"delete", "mysql_users"},
+		"update global_variables set variable_value = 'x'":          {"update", "global_variables"},
+		"save mysql servers to disk":                                {"save", ""},
+		"pragma table_info(mysql_servers)":                          {"pragma", ""},
+		"":                                                          {"", ""},
+	}
+	for statement, expected := range statements {
+		if verb, table := statementTarget(statement); verb != expected[0] || table != expected[1] {
+			t.Errorf("%q targets %s %s", statement, verb, table)
+		}
+	}
+}
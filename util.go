@@ -4,12 +4,13 @@ package proxysql
 
 import (
 	"errors"
+	"fmt"
 )
 
 type vOpts func(*hostQuery) error
 
 var (
-	ErrConfigBadTable             = errors.New("Bad table value, must be one of 'mysql_servers', 'runtime_mysql_servers'")
+	ErrConfigBadTable             = errors.New("Bad table value, must be one of 'mysql_servers', 'runtime_mysql_servers', 'disk.mysql_servers'")
 	ErrConfigBadHostgroupID       = errors.New("Bad hostgroup value, must be in [0, 2147483648]")
 	ErrConfigBadPort              = errors.New("Bad port value, must be in [0, 65535]")
 	ErrConfigBadMaxConnections    = errors.New("Bad max_connections value, must be > 0")
@@ -21,10 +22,52 @@ var (
 	ErrConfigBadMaxLatencyMS      = errors.New("Bad max_latency_ms value, must be > 0")
 	ErrConfigDuplicateSpec        = errors.New("Bad function call, a value was specified twice")
 	ErrConfigNoHostname           = errors.New("Bad hostname, must not be empty")
+	ErrConfigBadHostname          = errors.New("Bad hostname, must be an IPv4 or IPv6 address, a DNS name, or the absolute path of a unix socket")
+	ErrConfigBadSocketPort        = errors.New("Bad port value, must be 0 for a unix socket")
+	ErrConfigAllTableOnly         = errors.New("Only specify Table when calling function All")
+	ErrConfigBadColumn            = errors.New("Bad column, must be a column of mysql_servers")
+	ErrConfigBadPredicate         = errors.New("Bad predicate, values must have the type of the column, LIKE needs a string column, and IN, AND and OR need at least one value")
+	ErrConfigBadLimit             = errors.New("Bad limit value, must be >= 0")
+	ErrTableBadName               = errors.New("Bad table name, must be a name like 'mysql_servers' or 'disk.mysql_servers'")
+	ErrTableBadType               = errors.New("Bad table type, must be a struct with db tags on exported string, integer, float, or bool fields")
+	ErrTableNamed                 = errors.New("Do not specify Table for a TypedTable, it has its own name")
+	ErrTableNoClient              = errors.New("Bad client, must not be nil")
+	ErrVersionUnknown             = errors.New("Unknown version, must start with major.minor")
+	ErrConfigNoAddress            = errors.New("Bad address, must not be empty")
+	ErrConfigBadAddress           = errors.New("Bad address, must be host:port, a host, or the absolute path of a unix socket")
+	ErrConfigNoUser               = errors.New("Bad user, must give a user or a CredentialsProvider")
+	ErrConfigBadUser              = errors.New("Bad user, must not contain ':'")
+	ErrConfigBadTimeout           = errors.New("Bad timeout, must be >= 0")
+	ErrConfigBadPoolSize          = errors.New("Bad pool size, must be >= 0")
+	ErrConfigBadTLS               = errors.New("Bad TLS config, CertFile and KeyFile must be given together, and files must hold PEM certificates and keys")
+	ErrPlanBadScope               = errors.New("Bad scope, must not give Table or Limit")
+	ErrPlanOutOfScope             = errors.New("Bad host, must match the scope of the plan")
+	ErrPlanDuplicateHost          = errors.New("Bad host, must not have the key of another desired host")
+	ErrPlanNil                    = errors.New("Bad plan, must be made with Plan")
+	ErrConfigBadTTL               = errors.New("Bad ttl, must be > 0")
+	ErrConfigBadInterval          = errors.New("Bad interval, must be > 0")
+	ErrConfigBadGrace             = errors.New("Bad grace period, must be >= 0")
 
 	validationFuncs []vOpts
 )
 
+// HostError is returned by AddHosts when one of the hosts could not be
+// validated or inserted. Index is the host's position in the arguments
+type HostError struct {
+	Host  *Host
+	Index int
+	Err   error
+}
+
+func (e *HostError) Error() string {
+	return fmt.Sprintf("host %d (%s): %v", e.Index, e.Host.Key(), e.Err)
+}
+
+// Unwrap returns the error from validating or inserting the host
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
+
 func init() {
 	// add all validators to the validation array for validateHostQuery
 	validationFuncs = append(validationFuncs, validateTableOpts)
@@ -38,14 +81,18 @@ func init() {
 	validationFuncs = append(validationFuncs, validateUseSSL)
 	validationFuncs = append(validationFuncs, validateMaxLatencyMS)
 	validationFuncs = append(validationFuncs, validateSpecifiedFields)
+	validationFuncs = append(validationFuncs, validateFilters)
 }
 
 func validateTableOpts(opts *hostQuery) error {
-	return validateTable(opts.table)
+	if err := validateTable(opts.table); err != nil {
+		return invalidField("table", opts.table, err)
+	}
+	return nil
 }
 
 func validateTable(t string) error {
-	if t != "mysql_servers" && t != "runtime_mysql_servers" {
+	if t != "mysql_servers" && t != "runtime_mysql_servers" && t != "disk.mysql_servers" {
 		return ErrConfigBadTable
 	}
 	return nil
@@ -53,21 +100,21 @@ func validateTable(t string) error {
 
 func validateHostgroupID(opts *hostQuery) error {
 	if opts.host.hostgroup_id < 0 || opts.host.hostgroup_id > 2147483648 {
-		return ErrConfigBadHostgroupID
+		return invalidField("hostgroup_id", opts.host.hostgroup_id, ErrConfigBadHostgroupID)
 	}
 	return nil
 }
 
 func validatePort(opts *hostQuery) error {
 	if opts.host.port < 0 || opts.host.port > 65535 {
-		return ErrConfigBadPort
+		return invalidField("port", opts.host.port, ErrConfigBadPort)
 	}
 	return nil
 }
 
 func validateMaxConnections(opts *hostQuery) error {
 	if opts.host.max_connections < 0 {
-		return ErrConfigBadMaxConnections
+		return invalidField("max_connections", opts.host.max_connections, ErrConfigBadMaxConnections)
 	}
 	return nil
 }
@@ -75,14 +122,14 @@ func validateMaxConnections(opts *hostQuery) error {
 func validateStatus(opts *hostQuery) error {
 	s := opts.host.status
 	if s != "ONLINE" && s != "SHUNNED" && s != "OFFLINE_SOFT" && s != "OFFLINE_HARD" {
-		return ErrConfigBadStatus
+		return invalidField("status", s, ErrConfigBadStatus)
 	}
 	return nil
 }
 
 func validateWeight(opts *hostQuery) error {
 	if opts.host.weight < 0 {
-		return ErrConfigBadWeight
+		return invalidField("weight", opts.host.weight, ErrConfigBadWeight)
 	}
 	return nil
 }
@@ -90,7 +137,7 @@ func validateWeight(opts *hostQuery) error {
 func validateCompression(opts *hostQuery) error {
 	c := opts.host.compression
 	if c < 0 || c > 102400 {
-		return ErrConfigBadCompression
+		return invalidField("compression", c, ErrConfigBadCompression)
 	}
 	return nil
 }
@@ -98,7 +145,7 @@ func validateCompression(opts *hostQuery) error {
 func validateMaxReplicationLag(opts *hostQuery) error {
 	m := opts.host.max_replication_lag
 	if m < 0 || m > 126144000 {
-		return ErrConfigBadMaxReplicationLag
+		return invalidField("max_replication_lag", m, ErrConfigBadMaxReplicationLag)
 	}
 	return nil
 }
@@ -106,24 +153,24 @@ func validateMaxReplicationLag(opts *hostQuery) error {
 func validateUseSSL(opts *hostQuery) error {
 	u := opts.host.use_ssl
 	if u != 0 && u != 1 {
-		return ErrConfigBadUseSSL
+		return invalidField("use_ssl", u, ErrConfigBadUseSSL)
 	}
 	return nil
 }
 
 func validateMaxLatencyMS(opts *hostQuery) error {
 	if opts.host.max_latency_ms < 0 {
-		return ErrConfigBadMaxLatencyMS
+		return invalidField("max_latency_ms", opts.host.max_latency_ms, ErrConfigBadMaxLatencyMS)
 	}
 	return nil
 }
 
-// returns ErrConfigDuplicateSpec if a duplicate occurs
+// returns ErrConfigDuplicateSpec, as a *FieldError, if a duplicate occurs
 func validateSpecifiedFields(opts *hostQuery) error {
 	encountered := make(map[string]struct{})
 	for _, field := range opts.specifiedFields {
 		if _, exists := encountered[field]; exists {
-			return ErrConfigDuplicateSpec
+			return invalidField(field, nil, ErrConfigDuplicateSpec)
 		}
 		encountered[field] = struct{}{}
 	}
@@ -134,16 +181,17 @@ func validateSpecifiedFields(opts *hostQuery) error {
 // it is not a default validation
 func validateHostname(opts *hostQuery) error {
 	if opts.host.hostname == "" {
-		return ErrConfigNoHostname
+		return invalidField("hostname", opts.host.hostname, ErrConfigNoHostname)
 	}
 	return nil
 }
 
-func validateHostQuery(opts *hostQuery) error {
-	for _, validate := range validationFuncs {
-		if err := validate(opts); err != nil {
-			return err
-		}
+// returns a *ValidationError listing every invalid field, from the default
+// validations and any extra ones given
+func validateHostQuery(opts *hostQuery, extra ...vOpts) error {
+	invalid := &ValidationError{}
+	for _, validate := range append(validationFuncs[:len(validationFuncs):len(validationFuncs)], extra...) {
+		invalid.add(validate(opts))
 	}
-	return nil
+	return invalid.err()
 }
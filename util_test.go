@@ -1,6 +1,7 @@
 package proxysql
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -19,7 +20,7 @@ func TestValidateTableOpts(t *testing.T) {
 	for _, testCase := range tableTests {
 		obj := testCase.in
 		err := testCase.out
-		if validateTableOpts(obj) != err {
+		if !errors.Is(validateTableOpts(obj), err) {
 			t.Logf("did not match expected validation. table %s, err %v", obj.table, err)
 			t.Fail()
 		}
@@ -37,7 +38,7 @@ func TestValidateHostgroupID(t *testing.T) {
 	for _, testCase := range hostgroupTests {
 		obj := testCase.in
 		err := testCase.out
-		if validateHostgroupID(obj) != err {
+		if !errors.Is(validateHostgroupID(obj), err) {
 			t.Logf("did not match expected validation. hg %d, err %v", obj.host.hostgroup_id, err)
 			t.Fail()
 		}
@@ -56,7 +57,7 @@ func TestValidatePort(t *testing.T) {
 	for _, testCase := range portTests {
 		obj := testCase.in
 		err := testCase.out
-		if validatePort(obj) != err {
+		if !errors.Is(validatePort(obj), err) {
 			t.Logf("did not match expected validation. port %d, err %v", obj.host.port, err)
 			t.Fail()
 		}
@@ -72,7 +73,7 @@ func TestValidateSpecifiedFields(t *testing.T) {
 	for _, testCase := range specTests {
 		obj := testCase.in
 		err := testCase.out
-		if validateSpecifiedFields(obj) != err {
+		if !errors.Is(validateSpecifiedFields(obj), err) {
 			t.Logf("did not match expected validation. port %v, err %v", obj.specifiedFields, err)
 			t.Fail()
 		}
@@ -88,7 +89,7 @@ func TestValidateHostname(t *testing.T) {
 	for _, testCase := range hostnameTests {
 		obj := testCase.in
 		err := testCase.out
-		if validateHostname(obj) != err {
+		if !errors.Is(validateHostname(obj), err) {
 			t.Logf("did not match expected validation. port %s, err %v", obj.host.hostname, err)
 			t.Fail()
 		}
@@ -135,7 +136,7 @@ func TestValidateHostQuery(t *testing.T) {
 	for _, testCase := range tests {
 		obj := testCase.in
 		err := testCase.out
-		if validateHostQuery(obj) != err {
+		if !errors.Is(validateHostQuery(obj), err) {
 			t.Logf("did not match expected validation. obj %v, err %v", obj, err)
 			t.Fail()
 		}
@@ -0,0 +1,197 @@
+package proxysql
+
+// this file is for detecting the version of ProxySQL, and what it supports
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a ProxySQL version, like 2.0.12-percona-1.1
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Raw is the version as ProxySQL reports it
+	Raw string
+}
+
+// Capabilities are the features of the admin interface that differ between
+// versions of ProxySQL
+type Capabilities struct {
+	// GTIDPort is whether mysql_servers has a gtid_port column, as in 2.0
+	// and later
+	GTIDPort bool
+	// ReplicationCheckType is whether mysql_replication_hostgroups has a
+	// check_type column, as in 2.0 and later
+	ReplicationCheckType bool
+	// UserComments is whether mysql_users has a comment column, as in 2.0
+	// and later
+	UserComments bool
+	// HostgroupAttributes is whether there is a mysql_hostgroup_attributes
+	// table, as in 2.5 and later
+	HostgroupAttributes bool
+	// PostgreSQL is whether there are pgsql_ tables, as in 3.0 and later
+	PostgreSQL bool
+}
+
+// Column describes a column of a table, as PRAGMA table_info reports it
+type Column struct {
+	Name    string `db:"name"`
+	Type    string `db:"type"`
+	NotNull bool   `db:"notnull"`
+	// Default is the default value as it is written in the table's
+	// definition, or empty if there is none
+	Default string `db:"dflt_value"`
+	// PrimaryKey is the column's position in the primary key, starting at
+	// 1, or 0 if it is not part of it
+	PrimaryKey int `db:"pk"`
+}
+
+var columnColumns = mustTableColumns(reflect.TypeOf(Column{}))
+
+var versionPattern = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion parses a version as ProxySQL reports it.
+// This will return ErrVersionUnknown if it does not start with a
+// major.minor version
+func ParseVersion(raw string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if match == nil {
+		return Version{}, ErrVersionUnknown
+	}
+	v := Version{Raw: raw}
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+	}
+	return v, nil
+}
+
+// String returns the version as major.minor.patch
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is major.minor or later
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || v.Major == major && v.Minor >= minor
+}
+
+// Version returns the version of ProxySQL, from select @@version, or from
+// the admin-version variable if that fails. The version is detected once,
+// and remembered until it is detected successfully.
+// This will return ErrVersionUnknown if the version can not be parsed
+// This will propagate errors from sql.Query, sql.Rows.Scan and sql.Rows.Err
+func (p *ProxySQL) Version() (Version, error) {
+	return p.VersionContext(context.Background())
+}
+
+// VersionContext is Version with a context
+func (p *ProxySQL) VersionContext(ctx context.Context) (v Version, err error) {
+	op := p.begin(ctx, "Version")
+	defer op.end(&err)
+	p.infoMut.Lock()
+	defer p.infoMut.Unlock()
+	if p.version != nil {
+		return *p.version, nil
+	}
+	defer op.rlock()()
+	v, err = detectVersion(op.ctx, p)
+	if err != nil {
+		return Version{}, err
+	}
+	p.version = &v
+	return v, nil
+}
+
+func detectVersion(ctx context.Context, p *ProxySQL) (Version, error) {
+	var raw string
+	err := scanOne(ctx, p, "", "select @@version", &raw)
+	if err != nil {
+		if err := scanOne(ctx, p, "global_variables", "select variable_value from global_variables where variable_name = 'admin-version'", &raw); err != nil {
+			return Version{}, err
+		}
+	}
+	return ParseVersion(raw)
+}
+
+// Capabilities returns what the admin interface of ProxySQL supports. Columns
+// are found with TableColumns, and tables from the version. The capabilities
+// are detected once, and remembered until they are detected successfully.
+// This will propagate errors from Version and TableColumns
+func (p *ProxySQL) Capabilities() (Capabilities, error) {
+	return p.CapabilitiesContext(context.Background())
+}
+
+// CapabilitiesContext is Capabilities with a context
+func (p *ProxySQL) CapabilitiesContext(ctx context.Context) (c Capabilities, err error) {
+	op := p.begin(ctx, "Capabilities")
+	defer op.end(&err)
+	v, err := p.VersionContext(op.ctx)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	p.infoMut.Lock()
+	defer p.infoMut.Unlock()
+	if p.capabilities != nil {
+		return *p.capabilities, nil
+	}
+	defer op.rlock()()
+	c = Capabilities{
+		HostgroupAttributes: v.AtLeast(2, 5),
+		PostgreSQL:          v.AtLeast(3, 0),
+	}
+	columns := map[string]*bool{
+		"mysql_servers.gtid_port":                 &c.GTIDPort,
+		"mysql_replication_hostgroups.check_type": &c.ReplicationCheckType,
+		"mysql_users.comment":                     &c.UserComments,
+	}
+	for _, table := range []string{"mysql_servers", "mysql_replication_hostgroups", "mysql_users"} {
+		info, err := describeTable(op.ctx, p, table)
+		if err != nil {
+			return Capabilities{}, err
+		}
+		for _, column := range info {
+			if found, ok := columns[table+"."+column.Name]; ok {
+				*found = true
+			}
+		}
+	}
+	p.capabilities = &c
+	return c, nil
+}
+
+// TableColumns returns the columns of a table, in order, as PRAGMA table_info
+// reports them. Tables in other schemas are named like disk.mysql_servers.
+// This returns no columns if the table does not exist.
+// This will return ErrTableBadName if the name is not a table name
+// This will propagate errors from sql.Query, sql.Rows.Scan and sql.Rows.Err
+func (p *ProxySQL) TableColumns(table string) ([]*Column, error) {
+	return p.TableColumnsContext(context.Background(), table)
+}
+
+// TableColumnsContext is TableColumns with a context
+func (p *ProxySQL) TableColumnsContext(ctx context.Context, table string) (columns []*Column, err error) {
+	op := p.begin(ctx, "TableColumns")
+	defer op.end(&err)
+	op.annotate(Attribute{AttributeTable, table})
+	if !tableNamePattern.MatchString(table) {
+		return nil, ErrTableBadName
+	}
+	defer op.rlock()()
+	return describeTable(op.ctx, p, table)
+}
+
+func describeTable(ctx context.Context, p *ProxySQL, table string) ([]*Column, error) {
+	pragma := fmt.Sprintf("pragma table_info(%s)", table)
+	if i := strings.Index(table, "."); i >= 0 {
+		pragma = fmt.Sprintf("pragma %s.table_info(%s)", table[:i], table[i+1:])
+	}
+	return newTable[Column](p, table, columnColumns).selectRows(ctx, pragma)
+}
@@ -0,0 +1,134 @@
+package proxysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kirinrastogi/proxysql-go/proxysqltest"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected Version
+		err      error
+	}{
+		{"1.4.16-percona-1.1", Version{1, 4, 16, "1.4.16-percona-1.1"}, nil},
+		{"2.0.12-38-g58a909a", Version{2, 0, 12, "2.0.12-38-g58a909a"}, nil},
+		{"3.0", Version{3, 0, 0, "3.0"}, nil},
+		{"proxysql", Version{}, ErrVersionUnknown},
+		{"", Version{}, ErrVersionUnknown},
+	}
+	for _, test := range tests {
+		v, err := ParseVersion(test.raw)
+		if err != test.err || v != test.expected {
+			t.Errorf("%q parsed as %v, %v", test.raw, v, err)
+		}
+	}
+	v := Version{Major: 2, Minor: 5}
+	if !v.AtLeast(2, 0) || !v.AtLeast(2, 5) || !v.AtLeast(1, 9) || v.AtLeast(2, 6) || v.AtLeast(3, 0) {
+		t.Errorf("AtLeast is wrong for %s", v)
+	}
+}
+
+// every method on hosts must work whatever columns mysql_servers has
+func TestHostsAcrossVersions(t *testing.T) {
+	tests := []struct {
+		version      string
+		capabilities Capabilities
+	}{
+		{"1.4.16", Capabilities{}},
+		{"2.0.12", Capabilities{GTIDPort: true, ReplicationCheckType: true, UserComments: true}},
+		{"2.7.1", Capabilities{GTIDPort: true, ReplicationCheckType: true, UserComments: true, HostgroupAttributes: true}},
+		{"3.0.1", Capabilities{GTIDPort: true, ReplicationCheckType: true, UserComments: true, HostgroupAttributes: true, PostgreSQL: true}},
+	}
+	for _, test := range tests {
+		conn, server := serverSetup(t, proxysqltest.Version(test.version))
+		v, err := conn.Version()
+		if err != nil || v.String() != test.version {
+			t.Errorf("unexpected version for %s: %v, %v", test.version, v, err)
+		}
+		c, err := conn.Capabilities()
+		if err != nil || c != test.capabilities {
+			t.Errorf("unexpected capabilities for %s: %+v, %v", test.version, c, err)
+		}
+		hosts := filterHosts()
+		if err := conn.AddHosts(hosts...); err != nil {
+			t.Fatalf("could not add hosts to %s: %v", test.version, err)
+		}
+		if err := conn.PersistChanges(); err != nil {
+			t.Fatalf("could not persist changes to %s: %v", test.version, err)
+		}
+		entries, err := conn.All(Table("runtime_mysql_servers"))
+		if err != nil || !reflect.DeepEqual(entries, hosts) {
+			t.Errorf("unexpected runtime hosts for %s: %v, %v", test.version, entries, err)
+		}
+		entries, err = conn.HostsLike(HostgroupID(2), OrderBy("hostname"))
+		if err != nil || !reflect.DeepEqual(entries, []*Host{hosts[2], hosts[3]}) {
+			t.Errorf("unexpected hosts in hostgroup 2 for %s: %v, %v", test.version, entries, err)
+		}
+		if err := conn.RemoveHostsLike(Where(Ne("hostgroup_id", 1))); err != nil {
+			t.Errorf("could not remove hosts from %s: %v", test.version, err)
+		}
+		if entries, err := conn.All(); err != nil || !reflect.DeepEqual(entries, hosts[:2]) {
+			t.Errorf("unexpected hosts left in %s: %v, %v", test.version, entries, err)
+		}
+		serverTeardown(conn, server)
+	}
+}
+
+func TestVersionFallsBackToAdminVersion(t *testing.T) {
+	conn, server := serverSetup(t, proxysqltest.Version("2.0.12"))
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(func(q string) error {
+		if q == "select @@version" {
+			return errors.New("unsupported")
+		}
+		return nil
+	})
+	v, err := conn.Version()
+	if err != nil || v.Major != 2 || v.Minor != 0 || v.Patch != 12 {
+		t.Fatalf("did not read admin-version: %v, %v", v, err)
+	}
+	// the version is remembered
+	server.SetQueryHook(func(string) error { return errors.New("down") })
+	if again, err := conn.Version(); err != nil || again != v {
+		t.Fatalf("version was not remembered: %v, %v", again, err)
+	}
+}
+
+func TestVersionErrorIsNotRemembered(t *testing.T) {
+	conn, server := serverSetup(t)
+	defer serverTeardown(conn, server)
+	server.SetQueryHook(func(string) error { return errors.New("down") })
+	if _, err := conn.Version(); err == nil {
+		t.Fatalf("did not receive error when ProxySQL failed")
+	}
+	if _, err := conn.Capabilities(); err == nil {
+		t.Fatalf("did not receive error from Capabilities when ProxySQL failed")
+	}
+	server.SetQueryHook(nil)
+	if v, err := conn.Version(); err != nil || v.String() != server.Version() {
+		t.Fatalf("version was not detected after failure: %v, %v", v, err)
+	}
+}
+
+func TestTableColumns(t *testing.T) {
+	conn, server := serverSetup(t, proxysqltest.Version("2.0.12"))
+	defer serverTeardown(conn, server)
+	columns, err := conn.TableColumns("disk.mysql_servers")
+	if err != nil || len(columns) != 12 {
+		t.Fatalf("unexpected columns: %v, %v", columns, err)
+	}
+	expected := &Column{Name: "port", Type: "INT", NotNull: true, Default: "3306", PrimaryKey: 3}
+	if !reflect.DeepEqual(columns[2], expected) || columns[3].Name != "gtid_port" {
+		t.Fatalf("unexpected columns: %+v, %+v", columns[2], columns[3])
+	}
+	if columns, err := conn.TableColumns("nope"); err != nil || len(columns) != 0 {
+		t.Fatalf("unexpected columns of missing table: %v, %v", columns, err)
+	}
+	if _, err := conn.TableColumns("mysql_servers)"); err != ErrTableBadName {
+		t.Fatalf("bad table name was not rejected: %v", err)
+	}
+}